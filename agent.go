@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/agent"
+	"github.com/MovieStoreGuy/skirmish/pkg/signal"
+
+	"go.uber.org/zap"
+)
+
+// runAgent will inject the faults sent by the orchestrator into this host until the process is signaled to stop,
+// at which point every active fault is reverted.
+func runAgent(log *zap.Logger, args []string) {
+	var (
+		listen, state   string
+		tlsCert, tlsKey string
+		maxTTL          time.Duration
+	)
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	fs.StringVar(&listen, "listen", fmt.Sprintf(":%d", agent.DefaultPort), "the address to serve the agent API on")
+	fs.DurationVar(&maxTTL, "max-ttl", time.Hour, "the longest a fault can last before it is reverted, regardless of what was requested")
+	fs.StringVar(&state, "state", "/var/lib/skirmish", "the directory active faults are persisted to so they are reverted if the agent restarts")
+	fs.StringVar(&tlsCert, "tls-cert", "", "the certificate to serve the agent API over TLS with")
+	fs.StringVar(&tlsKey, "tls-key", "", "the private key of the TLS certificate")
+	fs.Parse(args)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go signal.GlobalHandler().Await(ctx, cancel, syscall.SIGABRT, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.GlobalHandler().Finalise()
+	defer cancel()
+
+	if (tlsCert == "") != (tlsKey == "") {
+		log.Error("Unable to start agent, both a TLS certificate and key are required")
+		return
+	}
+	a, err := agent.New(log, os.Getenv(agent.TokenEnv), maxTTL, state)
+	if err != nil {
+		log.Error("Unable to start agent", zap.Error(err))
+		return
+	}
+	signal.GlobalHandler().Register(a.Shutdown)
+
+	httpServer := &http.Server{
+		Addr:    listen,
+		Handler: a.Handler(),
+	}
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+	log.Info("Serving agent API", zap.String("listen", listen), zap.Duration("maxTTL", maxTTL), zap.Bool("tls", tlsCert != ""))
+	if tlsCert != "" {
+		err = httpServer.ListenAndServeTLS(tlsCert, tlsKey)
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		log.Error("Issue serving agent API", zap.Error(err))
+	}
+}
@@ -3,9 +3,16 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"net/http"
+	"os"
 	"syscall"
 
+	"github.com/MovieStoreGuy/skirmish/pkg/journal"
+	"github.com/MovieStoreGuy/skirmish/pkg/metrics"
 	"github.com/MovieStoreGuy/skirmish/pkg/orchestra"
+	"github.com/MovieStoreGuy/skirmish/pkg/provider"
+	"github.com/MovieStoreGuy/skirmish/pkg/report"
 	"github.com/MovieStoreGuy/skirmish/pkg/signal"
 	"github.com/MovieStoreGuy/skirmish/pkg/types"
 
@@ -13,27 +20,65 @@ import (
 )
 
 var (
-	planPath string
+	planPath      string
+	journalPath   string
+	providerName  string
+	metricsListen string
+	reportPath    string
 )
 
 func init() {
 	flag.StringVar(&planPath, "plan-path", "", "the path to the plan to run")
+	flag.StringVar(&journalPath, "journal", "skirmish.journal", "the path to record every change made so it can be restored")
+	flag.StringVar(&providerName, "provider", "gce", "the cloud to operate against, either gce or fake for an in memory demo")
+	flag.StringVar(&metricsListen, "metrics-listen", "", "the address to expose prometheus metrics on, disabled when empty")
+	flag.StringVar(&reportPath, "report", "", "the path to write the game day report to, the extension sets the format of either .md, .html or .json")
 }
 
 func main() {
 	flag.Parse()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	go signal.GlobalHandler().Await(ctx, cancel, syscall.SIGABRT, syscall.SIGTERM, syscall.SIGINT)
-
 	log, err := zap.NewProduction()
 	if err != nil {
 		panic(err)
 	}
 	defer log.Sync()
+
+	switch flag.Arg(0) {
+	case "restore":
+		restore(log, flag.Args()[1:])
+		return
+	case "serve":
+		serve(log, flag.Args()[1:])
+		return
+	case "plan":
+		plan(log, flag.Args()[1:])
+		return
+	case "agent":
+		runAgent(log, flag.Args()[1:])
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go signal.GlobalHandler().Await(ctx, cancel, syscall.SIGABRT, syscall.SIGTERM, syscall.SIGINT)
+
+	services, fake, err := newServices(ctx, providerName, journalPath)
+	if err != nil {
+		log.Panic("Failed to configure services", zap.Error(err))
+	}
+	defer services.Journal.Close()
+	if metricsListen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		go func() {
+			if err := http.ListenAndServe(metricsListen, mux); err != nil {
+				log.Error("Issue serving metrics", zap.Error(err))
+			}
+		}()
+	}
 	defer signal.GlobalHandler().Finalise()
 	defer cancel()
-	orc, err := orchestra.NewRunner(ctx, cancel, log)
+	orc, err := orchestra.NewRunner(ctx, cancel, log, services)
 	if err != nil {
 		log.Panic("Failed to create new orchestra runner", zap.Error(err))
 	}
@@ -49,8 +94,59 @@ func main() {
 		return
 	}
 	log.Info("Successfully validated plan")
-	if err = orc.Execute(plan); err != nil {
+	result, err := orc.Execute(plan)
+	if err != nil {
 		log.Error("Issue executing plan", zap.Error(err))
 	}
-	log.Info("finished execute")
+	log.Info("finished execute", zap.Any("result", result))
+	if reportPath != "" {
+		if err := writeReport(reportPath, result); err != nil {
+			log.Error("Issue writing report", zap.Error(err), zap.String("report", reportPath))
+		}
+	}
+	if fake != nil {
+		log.Info("Fake provider state", zap.Any("instances", fake.Instances()), zap.Strings("firewalls", fake.Firewalls()), zap.Strings("routes", fake.Routes()), zap.Any("databases", fake.Databases()), zap.Strings("cordoned", fake.Cordoned()), zap.Any("backendServices", fake.BackendServices()), zap.Any("policies", fake.Policies()))
+	}
+}
+
+// writeReport renders the result into the format implied by the path
+func writeReport(path string, result *types.PlanResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(f, report.FormatFromPath(path), result); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newServices opens the journal and configures the named provider with metrics,
+// the fake provider is returned as well so that its state can be inspected.
+func newServices(ctx context.Context, name, path string) (*types.Services, *provider.Fake, error) {
+	var (
+		services = &types.Services{}
+		fake     *provider.Fake
+	)
+	switch name {
+	case "gce":
+		if err := provider.Connect(ctx, services); err != nil {
+			return nil, nil, err
+		}
+		services.Provider = provider.NewGCE(services.Compute, services.SQLAdmin, services.Container, services.Resources)
+	case "fake":
+		fake = provider.NewFake("australia-southeast1-a", "australia-southeast1-b", "us-west1-a")
+		fake.AutoPopulate(3)
+		services.Provider = fake
+	default:
+		return nil, nil, fmt.Errorf("unknown provider %s", name)
+	}
+	services.Provider = metrics.Instrument(services.Provider)
+	jrnl, err := journal.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	services.Journal = jrnl
+	return services, fake, nil
 }
@@ -0,0 +1,280 @@
+package agent
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPort is the port the agent listens on unless configured otherwise
+	DefaultPort = 7070
+	// TokenEnv is the environment variable the agent and orchestrator read the shared token from
+	TokenEnv = "SKIRMISH_AGENT_TOKEN"
+	// CAEnv is the environment variable the orchestrator reads the path of the certificate authority that signed
+	// the agents' certificates from, the agents are reached over TLS once it is set
+	CAEnv = "SKIRMISH_AGENT_CA"
+
+	// maxFaultSize limits the size of a submitted fault
+	maxFaultSize = 1 << 16
+)
+
+// ErrReverted is returned when reverting a fault the agent has already reverted, such as once its TTL expired
+var ErrReverted = errors.New("fault already reverted")
+
+// Agent runs on a host and injects faults into it on behalf of the orchestrator,
+// every fault is reverted by the agent itself once its TTL expires.
+type Agent struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	token    string
+	maxTTL   time.Duration
+	dir      string
+	faults   map[string]*active
+	reverted map[string]time.Time
+	// injecting reserves the ids of faults being injected so the lock isn't held while they are
+	injecting map[string]struct{}
+}
+
+type active struct {
+	status Status
+	timer  *time.Timer
+	revert func() error
+}
+
+// Status is the API representation of an injected fault
+type Status struct {
+	types.Fault
+	Injected time.Time `json:"injected"`
+	Expires  time.Time `json:"expires"`
+	// Targets are the processes signaled, the file written or the device shaped by the fault
+	Targets []string `json:"targets,omitempty"`
+}
+
+// New returns an agent that only accepts requests bearing the token and caps every fault's TTL at maxTTL.
+// Faults are persisted within dir so any left active by a previous agent that didn't shut down are reverted,
+// nothing is persisted when dir is empty.
+func New(log *zap.Logger, token string, maxTTL time.Duration, dir string) (*Agent, error) {
+	if token == "" {
+		return nil, fmt.Errorf("agent requires a token set with %s", TokenEnv)
+	}
+	a := &Agent{
+		log:       log,
+		token:     token,
+		maxTTL:    maxTTL,
+		dir:       dir,
+		faults:    make(map[string]*active),
+		reverted:  make(map[string]time.Time),
+		injecting: make(map[string]struct{}),
+	}
+	if err := a.recoverFaults(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Handler returns the routes of the API, every request needs the token as a bearer token:
+//
+//	GET    /faults         list every active fault
+//	POST   /faults         inject a fault
+//	DELETE /faults/{id}    revert the fault straight away
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/faults", a.handleFaults)
+	mux.HandleFunc("/faults/", a.handleFault)
+	return a.authenticate(mux)
+}
+
+// Shutdown reverts every active fault
+func (a *Agent) Shutdown() {
+	a.lock.Lock()
+	ids := make([]string, 0, len(a.faults))
+	for id := range a.faults {
+		ids = append(ids, id)
+	}
+	a.lock.Unlock()
+	for _, id := range ids {
+		if err := a.Revert(id); err != nil {
+			a.log.Error("Failed to revert fault", zap.String("fault", id), zap.Error(err))
+		}
+	}
+}
+
+// Inject applies the fault to the host and schedules it to be reverted once its TTL expires
+func (a *Agent) Inject(fault types.Fault) (Status, error) {
+	if err := fault.Validate(); err != nil {
+		return Status{}, err
+	}
+	if fault.TTL <= 0 {
+		return Status{}, errors.New("fault requires a ttl")
+	}
+	if a.maxTTL > 0 && fault.TTL > a.maxTTL {
+		fault.TTL = a.maxTTL
+	}
+	if fault.Id == "" {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return Status{}, err
+		}
+		fault.Id = id.String()
+	}
+	a.lock.Lock()
+	_, exist := a.faults[fault.Id]
+	_, reverted := a.reverted[fault.Id]
+	if _, injecting := a.injecting[fault.Id]; exist || reverted || injecting {
+		a.lock.Unlock()
+		return Status{}, fmt.Errorf("fault %s already exists", fault.Id)
+	}
+	a.injecting[fault.Id] = struct{}{}
+	a.lock.Unlock()
+	defer func() {
+		a.lock.Lock()
+		delete(a.injecting, fault.Id)
+		a.lock.Unlock()
+	}()
+	targets, revert, err := inject(fault)
+	if err != nil {
+		return Status{}, err
+	}
+	now := time.Now()
+	f := &active{
+		status: Status{Fault: fault, Injected: now, Expires: now.Add(fault.TTL), Targets: targets},
+		revert: revert,
+	}
+	// A fault that isn't persisted would be left behind if the agent were to restart
+	if err := a.persist(stored{Status: f.status}); err != nil {
+		if rerr := revert(); rerr != nil {
+			a.log.Error("Failed to revert fault that couldn't be persisted", zap.String("fault", fault.Id), zap.Error(rerr))
+		}
+		return Status{}, fmt.Errorf("unable to persist fault: %w", err)
+	}
+	f.timer = time.AfterFunc(fault.TTL, func() {
+		if err := a.Revert(fault.Id); err != nil && !errors.Is(err, types.ErrNotFound) && !errors.Is(err, ErrReverted) {
+			a.log.Error("Failed to revert expired fault", zap.String("fault", fault.Id), zap.Error(err))
+			return
+		}
+		a.log.Info("Reverted expired fault", zap.String("fault", fault.Id), zap.String("kind", fault.Kind))
+	})
+	a.lock.Lock()
+	a.faults[fault.Id] = f
+	a.lock.Unlock()
+	a.log.Info("Injected fault", zap.String("fault", fault.Id), zap.String("kind", fault.Kind), zap.Duration("ttl", fault.TTL), zap.Strings("targets", targets))
+	return f.status, nil
+}
+
+// Revert undoes the fault, ErrReverted is returned if the fault has already been reverted
+// and types.ErrNotFound if the agent has no record of it.
+func (a *Agent) Revert(id string) error {
+	a.lock.Lock()
+	f, exist := a.faults[id]
+	delete(a.faults, id)
+	_, reverted := a.reverted[id]
+	a.lock.Unlock()
+	switch {
+	case reverted:
+		return fmt.Errorf("%w: fault %s", ErrReverted, id)
+	case !exist:
+		return fmt.Errorf("%w: fault %s", types.ErrNotFound, id)
+	}
+	f.timer.Stop()
+	if err := f.revert(); err != nil {
+		// The fault stays persisted as active so the next agent tries to revert it again
+		return err
+	}
+	now := time.Now()
+	a.lock.Lock()
+	a.reverted[id] = now
+	a.lock.Unlock()
+	if err := a.persist(stored{Status: f.status, Reverted: now}); err != nil {
+		a.log.Error("Failed to persist reverted fault", zap.String("fault", id), zap.Error(err))
+	}
+	return nil
+}
+
+// Faults returns the status of every active fault
+func (a *Agent) Faults() []Status {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	list := make([]Status, 0, len(a.faults))
+	for _, f := range a.faults {
+		list = append(list, f.status)
+	}
+	return list
+}
+
+func (a *Agent) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			fail(w, http.StatusUnauthorized, errors.New("invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Agent) handleFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		respond(w, http.StatusOK, a.Faults())
+	case http.MethodPost:
+		buff, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxFaultSize))
+		if err != nil {
+			fail(w, http.StatusBadRequest, err)
+			return
+		}
+		var fault types.Fault
+		if err := json.Unmarshal(buff, &fault); err != nil {
+			fail(w, http.StatusBadRequest, err)
+			return
+		}
+		status, err := a.Inject(fault)
+		if err != nil {
+			fail(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		respond(w, http.StatusCreated, status)
+	default:
+		fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (a *Agent) handleFault(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/faults/"), "/")
+	switch err := a.Revert(id); {
+	case errors.Is(err, ErrReverted):
+		fail(w, http.StatusGone, err)
+	case errors.Is(err, types.ErrNotFound):
+		fail(w, http.StatusNotFound, err)
+	case err != nil:
+		fail(w, http.StatusInternalServerError, err)
+	default:
+		a.log.Info("Reverted fault", zap.String("fault", id))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func respond(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func fail(w http.ResponseWriter, status int, err error) {
+	respond(w, status, map[string]string{"error": err.Error()})
+}
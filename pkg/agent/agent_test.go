@@ -0,0 +1,328 @@
+package agent
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+const token = "secret"
+
+func newAgent(t *testing.T, dir string) *Agent {
+	a, err := New(zap.NewNop(), token, time.Hour, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(a.Shutdown)
+	return a
+}
+
+// serve returns a client for the agent served over http, or https when tls is set
+func serve(t *testing.T, a *Agent, tls bool) *Client {
+	t.Setenv(TokenEnv, token)
+	var srv *httptest.Server
+	if tls {
+		srv = httptest.NewTLSServer(a.Handler())
+		ca := filepath.Join(t.TempDir(), "ca.pem")
+		cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+		if err := ioutil.WriteFile(ca, cert, 0600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv(CAEnv, ca)
+	} else {
+		srv = httptest.NewServer(a.Handler())
+		t.Setenv(CAEnv, "")
+	}
+	t.Cleanup(srv.Close)
+	c, err := NewClient(strings.TrimPrefix(srv.URL, map[bool]string{true: "https://", false: "http://"}[tls]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func diskFault(t *testing.T, megabytes int64) types.Fault {
+	return types.Fault{Id: fmt.Sprintf("fault-%d", time.Now().UnixNano()), Kind: types.FaultDisk, TTL: time.Minute, Path: t.TempDir(), Megabytes: megabytes}
+}
+
+func TestNewRequiresToken(t *testing.T) {
+	if _, err := New(zap.NewNop(), "", time.Hour, ""); err == nil {
+		t.Error("an agent without a token should fail")
+	}
+}
+
+func TestHandlerRejectsInvalidToken(t *testing.T) {
+	srv := httptest.NewServer(newAgent(t, "").Handler())
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/faults", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestClientInjectsAndReverts(t *testing.T) {
+	for _, tls := range []bool{false, true} {
+		t.Run(fmt.Sprintf("tls=%v", tls), func(t *testing.T) {
+			a := newAgent(t, t.TempDir())
+			c := serve(t, a, tls)
+			fault := diskFault(t, 1)
+			status, err := c.Inject(context.Background(), fault)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(status.Targets) != 1 {
+				t.Fatalf("targets %v, want the written file", status.Targets)
+			}
+			if len(a.Faults()) != 1 {
+				t.Errorf("agent has %d faults, want 1", len(a.Faults()))
+			}
+			if err := c.Revert(context.Background(), fault.Id); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := os.Stat(status.Targets[0]); !os.IsNotExist(err) {
+				t.Errorf("file %s still exists after revert", status.Targets[0])
+			}
+			if err := c.Revert(context.Background(), fault.Id); !errors.Is(err, ErrReverted) {
+				t.Errorf("reverting again returned %v, want %v", err, ErrReverted)
+			}
+			if err := c.Revert(context.Background(), "unknown"); !errors.Is(err, types.ErrNotFound) {
+				t.Errorf("reverting an unknown fault returned %v, want %v", err, types.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestInjectRejectsInvalidFaults(t *testing.T) {
+	a := newAgent(t, "")
+	for name, fault := range map[string]types.Fault{
+		"kind": {Kind: "everything", TTL: time.Minute},
+		"ttl":  {Kind: types.FaultMemory, Megabytes: 1},
+		"id":   {Id: "../../etc/passwd", Kind: types.FaultMemory, Megabytes: 1, TTL: time.Minute},
+	} {
+		if _, err := a.Inject(fault); err == nil {
+			t.Errorf("fault with an invalid %s should fail", name)
+		}
+	}
+	fault := diskFault(t, 1)
+	if _, err := a.Inject(fault); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := a.Inject(fault); err == nil {
+		t.Error("injecting the same fault twice should fail")
+	}
+}
+
+func TestFaultRevertedOnceExpired(t *testing.T) {
+	a := newAgent(t, "")
+	fault := diskFault(t, 1)
+	fault.TTL = 10 * time.Millisecond
+	status, err := a.Inject(fault)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(a.Faults()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := os.Stat(status.Targets[0]); !os.IsNotExist(err) {
+		t.Errorf("file %s still exists once the fault expired", status.Targets[0])
+	}
+	if err := a.Revert(fault.Id); !errors.Is(err, ErrReverted) {
+		t.Errorf("reverting an expired fault returned %v, want %v", err, ErrReverted)
+	}
+}
+
+func TestFillDiskWritesSize(t *testing.T) {
+	fault := diskFault(t, 2)
+	targets, revert, err := inject(fault)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info, err := os.Stat(targets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 2*megabyte {
+		t.Errorf("file is %d bytes, want %d", info.Size(), 2*megabyte)
+	}
+	if err := revert(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(targets[0]); !os.IsNotExist(err) {
+		t.Errorf("file %s still exists after revert", targets[0])
+	}
+}
+
+func TestFillDiskUnboundedFillsInBackground(t *testing.T) {
+	a := newAgent(t, "")
+	fault := diskFault(t, 0)
+	status, err := a.Inject(fault)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Reverting straight away stops the filling before it uses much of the disk
+	if err := a.Revert(fault.Id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(status.Targets[0]); !os.IsNotExist(err) {
+		t.Errorf("file %s still exists after revert", status.Targets[0])
+	}
+}
+
+func TestHoldMemoryAndBurnCPU(t *testing.T) {
+	for _, fault := range []types.Fault{
+		{Kind: types.FaultMemory, Megabytes: 4},
+		{Kind: types.FaultCPU, Workers: 1, Load: 10},
+	} {
+		targets, revert, err := inject(fault)
+		if err != nil {
+			t.Fatalf("%s returned %v", fault.Kind, err)
+		}
+		if len(targets) != 1 {
+			t.Errorf("%s targets %v, want a description of the load", fault.Kind, targets)
+		}
+		if err := revert(); err != nil {
+			t.Errorf("%s revert returned %v", fault.Kind, err)
+		}
+	}
+}
+
+// startProcess runs a copy of sleep under a unique name so no other process on the host is signaled
+func startProcess(t *testing.T) (string, *exec.Cmd) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep is not available")
+	}
+	buf, err := ioutil.ReadFile(sleep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("sk-%d", time.Now().UnixNano()%1e9)
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, buf, 0700); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(path, "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return name, cmd
+}
+
+// stopped reports if the process is stopped, waiting a moment for the signal to be delivered
+func stopped(t *testing.T, pid int, want bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for {
+		buf, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The state follows the command, which is wrapped in parentheses
+		stat := string(buf)
+		state := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])[0] == "T"
+		if state == want || time.Now().After(deadline) {
+			return state
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStopProcesses(t *testing.T) {
+	name, cmd := startProcess(t)
+	targets, revert, err := inject(types.Fault{Kind: types.FaultStop, Process: name})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := fmt.Sprintf("%s %d", name, cmd.Process.Pid); len(targets) != 1 || targets[0] != want {
+		t.Errorf("targets %v, want [%s]", targets, want)
+	}
+	if !stopped(t, cmd.Process.Pid, true) {
+		t.Error("process was not stopped")
+	}
+	if err := revert(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stopped(t, cmd.Process.Pid, false) {
+		t.Error("process is still stopped after revert")
+	}
+}
+
+func TestSignalProcessesWithoutMatch(t *testing.T) {
+	if _, _, err := inject(types.Fault{Kind: types.FaultKill, Process: fmt.Sprintf("none-%d", time.Now().UnixNano())}); err == nil {
+		t.Error("signaling a process that doesn't exist should fail")
+	}
+}
+
+func TestRestartedAgentRevertsPersistedFaults(t *testing.T) {
+	dir := t.TempDir()
+	previous, err := New(zap.NewNop(), token, time.Hour, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, cmd := startProcess(t)
+	disk := diskFault(t, 1)
+	written, err := previous.Inject(disk)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stop := types.Fault{Id: "stop", Kind: types.FaultStop, TTL: time.Hour, Process: name}
+	if _, err := previous.Inject(stop); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The previous agent is never shut down, as if it had crashed
+	for _, f := range previous.faults {
+		f.timer.Stop()
+	}
+
+	a := newAgent(t, dir)
+	if _, err := os.Stat(written.Targets[0]); !os.IsNotExist(err) {
+		t.Errorf("file %s left by the previous agent still exists", written.Targets[0])
+	}
+	if stopped(t, cmd.Process.Pid, false) {
+		t.Error("process stopped by the previous agent is still stopped")
+	}
+	for _, id := range []string{disk.Id, stop.Id} {
+		if err := a.Revert(id); !errors.Is(err, ErrReverted) {
+			t.Errorf("reverting %s returned %v, want %v", id, err, ErrReverted)
+		}
+	}
+	if _, err := a.Inject(stop); err == nil {
+		t.Error("a reverted fault should not be injected again")
+	}
+}
+
+func TestRestartedAgentForgetsOldTombstones(t *testing.T) {
+	dir := t.TempDir()
+	a := newAgent(t, dir)
+	if err := a.persist(stored{Status: Status{Fault: types.Fault{Id: "old"}}, Reverted: time.Now().Add(-2 * tombstoneTTL)}); err != nil {
+		t.Fatal(err)
+	}
+	newAgent(t, dir)
+	if _, err := os.Stat(filepath.Join(dir, "old.json")); !os.IsNotExist(err) {
+		t.Error("reverted fault older than the tombstone TTL was kept")
+	}
+}
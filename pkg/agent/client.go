@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+// Client sends faults to the agent running at the address
+type Client struct {
+	scheme  string
+	address string
+	token   string
+	http    *http.Client
+}
+
+// NewClient returns a client for the agent at the address, such as 10.0.0.2:7070,
+// authenticating with the token read from TokenEnv. The agent is reached over TLS when CAEnv is set.
+func NewClient(address string) (*Client, error) {
+	c := &Client{
+		scheme:  "http",
+		address: address,
+		token:   os.Getenv(TokenEnv),
+		http:    &http.Client{Timeout: time.Minute},
+	}
+	if path := os.Getenv(CAEnv); path != "" {
+		ca, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found within %s", path)
+		}
+		c.scheme = "https"
+		c.http.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	}
+	return c, nil
+}
+
+// Inject has the agent apply the fault
+func (c *Client) Inject(ctx context.Context, fault types.Fault) (*Status, error) {
+	buf, err := json.Marshal(fault)
+	if err != nil {
+		return nil, err
+	}
+	var status Status
+	if err := c.do(ctx, http.MethodPost, "/faults", buf, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Revert has the agent undo the fault straight away, ErrReverted is returned once the fault has expired
+// and types.ErrNotFound when the agent has no record of the fault.
+func (c *Client) Revert(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/faults/"+id, nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, c.scheme+"://"+c.address+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&msg)
+		switch resp.StatusCode {
+		case http.StatusGone:
+			return fmt.Errorf("%w: %s", ErrReverted, msg.Error)
+		case http.StatusNotFound:
+			return fmt.Errorf("%w: %s", types.ErrNotFound, msg.Error)
+		}
+		return fmt.Errorf("agent %s responded %s: %s", c.address, resp.Status, msg.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+const (
+	megabyte = 1 << 20
+	// burnPeriod is how often a cpu worker alternates between burning and idling to reach its load
+	burnPeriod = 100 * time.Millisecond
+)
+
+// inject applies the fault to the host, returning what was targeted and how to revert it
+func inject(fault types.Fault) ([]string, func() error, error) {
+	switch fault.Kind {
+	case types.FaultCPU:
+		return burnCPU(fault.Workers, fault.Load)
+	case types.FaultMemory:
+		return holdMemory(fault.Megabytes)
+	case types.FaultDisk:
+		return fillDisk(fault.Path, fault.Id, fault.Megabytes)
+	case types.FaultKill:
+		return signalProcesses(fault.Process, syscall.SIGKILL)
+	case types.FaultStop:
+		return signalProcesses(fault.Process, syscall.SIGSTOP)
+	case types.FaultNetem:
+		return applyNetem(fault.Netem)
+	}
+	return nil, nil, fmt.Errorf("unknown fault %s", fault.Kind)
+}
+
+// recoverFault reverts a fault injected by a previous agent from what it targeted. The cpu and memory faults ended with
+// the agent that held them and killed processes can't be brought back, so there is nothing to revert for them.
+func recoverFault(status Status) error {
+	switch status.Kind {
+	case types.FaultDisk:
+		for _, path := range status.Targets {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	case types.FaultStop:
+		var pids []int
+		for _, target := range status.Targets {
+			// Each target is the process name followed by its pid
+			fields := strings.Fields(target)
+			if len(fields) == 0 {
+				continue
+			}
+			pid, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return fmt.Errorf("unable to find the pid of %s: %w", target, err)
+			}
+			pids = append(pids, pid)
+		}
+		return resume(pids, syscall.SIGSTOP)
+	case types.FaultNetem:
+		for _, device := range status.Targets {
+			if err := recoverNetem(device); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// burnCPU keeps the workers busy for load percent of every period until reverted
+func burnCPU(workers, load int) ([]string, func() error, error) {
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	if load == 0 {
+		load = 100
+	}
+	busy := burnPeriod * time.Duration(load) / 100
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < workers; i++ {
+		go func() {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			for ctx.Err() == nil {
+				start := time.Now()
+				for time.Since(start) < busy {
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(burnPeriod - busy):
+				}
+			}
+		}()
+	}
+	return []string{fmt.Sprintf("%d cores at %d%%", workers, load)}, func() error {
+		cancel()
+		return nil
+	}, nil
+}
+
+// holdMemory allocates the memory and writes to every page so it is resident until reverted
+func holdMemory(megabytes int64) ([]string, func() error, error) {
+	held := make([][]byte, 0, megabytes)
+	for i := int64(0); i < megabytes; i++ {
+		chunk := make([]byte, megabyte)
+		for p := 0; p < len(chunk); p += os.Getpagesize() {
+			chunk[p] = 1
+		}
+		held = append(held, chunk)
+	}
+	return []string{fmt.Sprintf("%dMB", megabytes)}, func() error {
+		held = nil
+		debug.FreeOSMemory()
+		return nil
+	}, nil
+}
+
+// fillDisk writes a file of the size into the directory, the file is removed when reverted. When the size is zero
+// the filesystem is filled in the background instead, since that can take longer than the orchestrator waits for.
+func fillDisk(dir, id string, megabytes int64) ([]string, func() error, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	path := filepath.Join(dir, "skirmish-fill-"+id)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	if megabytes == 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer f.Close()
+			chunk := make([]byte, megabyte)
+			// Writing stops once the filesystem is full or the fault is reverted
+			for ctx.Err() == nil {
+				if _, err := f.Write(chunk); err != nil {
+					break
+				}
+			}
+			f.Sync()
+		}()
+		return []string{path}, func() error {
+			cancel()
+			<-done
+			return os.Remove(path)
+		}, nil
+	}
+	revert := func() error {
+		return os.Remove(path)
+	}
+	chunk := make([]byte, megabyte)
+	for i := int64(0); i < megabytes; i++ {
+		if _, err = f.Write(chunk); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		revert()
+		return nil, nil, err
+	}
+	return []string{path}, revert, nil
+}
+
+// signalProcesses sends the signal to every process with the name, stopped processes are continued when reverted
+func signalProcesses(name string, sig syscall.Signal) ([]string, func() error, error) {
+	pids, err := findProcesses(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(pids) == 0 {
+		return nil, nil, fmt.Errorf("no processes named %s", name)
+	}
+	var (
+		targets  []string
+		signaled []int
+	)
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, sig); err != nil {
+			// The process may have exited since it was found
+			if errors.Is(err, syscall.ESRCH) {
+				continue
+			}
+			resume(signaled, sig)
+			return nil, nil, fmt.Errorf("unable to signal %s %d: %w", name, pid, err)
+		}
+		signaled = append(signaled, pid)
+		targets = append(targets, fmt.Sprintf("%s %d", name, pid))
+	}
+	return targets, func() error {
+		return resume(signaled, sig)
+	}, nil
+}
+
+// resume continues the processes if they were stopped, killed processes have nothing to revert
+func resume(pids []int, sig syscall.Signal) error {
+	if sig != syscall.SIGSTOP {
+		return nil
+	}
+	var failed []string
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, syscall.SIGCONT); err != nil && !errors.Is(err, syscall.ESRCH) {
+			failed = append(failed, fmt.Sprintf("%d: %v", pid, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to continue processes %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// findProcesses returns the pid of every process whose command or executable has the name,
+// the agent itself and init are never returned.
+func findProcesses(name string) ([]int, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == 1 || pid == os.Getpid() {
+			continue
+		}
+		comm, err := ioutil.ReadFile(filepath.Join("/proc", entry.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		cmdline, _ := ioutil.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		argv0 := strings.SplitN(string(cmdline), "\x00", 2)[0]
+		if strings.TrimSpace(string(comm)) == name || (argv0 != "" && filepath.Base(argv0) == name) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+// shapedBand is the prio band the filtered traffic is sent to, the default priority map only uses the first three bands
+const shapedBand = "1:4"
+
+// applyNetem replaces the root qdisc of the device with netem, when the traffic is scoped to ranges or ports
+// a prio qdisc sends only the matching traffic through netem. Reverting deletes the root qdisc, which
+// removes the filters with it and puts the device back to its default qdisc.
+func applyNetem(netem *types.Netem) ([]string, func() error, error) {
+	device := netem.Device
+	if device == "" {
+		var err error
+		if device, err = defaultDevice(); err != nil {
+			return nil, nil, err
+		}
+	}
+	revert := func() error {
+		return tc("qdisc", "del", "dev", device, "root")
+	}
+	var commands [][]string
+	if len(netem.Ranges) == 0 && len(netem.Ports) == 0 {
+		commands = append(commands, append([]string{"qdisc", "add", "dev", device, "root", "handle", "1:", "netem"}, netemArgs(netem)...))
+	} else {
+		commands = append(commands,
+			[]string{"qdisc", "add", "dev", device, "root", "handle", "1:", "prio", "bands", "4"},
+			append([]string{"qdisc", "add", "dev", device, "parent", shapedBand, "handle", "40:", "netem"}, netemArgs(netem)...),
+		)
+		for _, match := range netemMatches(netem) {
+			filter := []string{"filter", "add", "dev", device, "parent", "1:", "protocol", "ip", "prio", "1", "u32"}
+			filter = append(filter, match...)
+			commands = append(commands, append(filter, "flowid", shapedBand))
+		}
+	}
+	for i, args := range commands {
+		if err := tc(args...); err != nil {
+			// The first command failing means the device's qdisc was never replaced, such as when it is already shaped
+			if i > 0 {
+				revert()
+			}
+			return nil, nil, err
+		}
+	}
+	return []string{device}, revert, nil
+}
+
+// recoverNetem deletes the root qdisc of the device left by a previous agent, as long as it is still the qdisc the
+// agent created rather than one that has replaced it since.
+func recoverNetem(device string) error {
+	out, err := exec.Command("tc", "qdisc", "show", "dev", device).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("tc qdisc show dev %s: %v: %s", device, err, strings.TrimSpace(string(out)))
+	}
+	if !shapedRoot(string(out)) {
+		return nil
+	}
+	return tc("qdisc", "del", "dev", device, "root")
+}
+
+// shapedRoot reports if the qdiscs shown by tc have the root qdisc applyNetem creates
+func shapedRoot(show string) bool {
+	for _, line := range strings.Split(show, "\n") {
+		fields := strings.Fields(line)
+		// Such as: qdisc netem 1: root refcnt 2 limit 1000 delay 200ms
+		if len(fields) >= 4 && fields[0] == "qdisc" && fields[2] == "1:" && fields[3] == "root" {
+			return fields[1] == "netem" || fields[1] == "prio"
+		}
+	}
+	return false
+}
+
+// netemArgs converts the netem into the arguments of tc's netem qdisc
+func netemArgs(netem *types.Netem) []string {
+	var args []string
+	if netem.Delay > 0 {
+		args = append(args, "delay", micros(netem.Delay))
+		if netem.Jitter > 0 {
+			args = append(args, micros(netem.Jitter))
+		}
+	}
+	if netem.Loss > 0 {
+		args = append(args, "loss", percent(netem.Loss))
+	}
+	if netem.Corrupt > 0 {
+		args = append(args, "corrupt", percent(netem.Corrupt))
+	}
+	if netem.Rate != "" {
+		args = append(args, "rate", netem.Rate)
+	}
+	return args
+}
+
+// netemMatches returns the u32 matches of every range and port combination
+func netemMatches(netem *types.Netem) [][]string {
+	var ranges, ports [][]string
+	for _, cidr := range netem.Ranges {
+		ranges = append(ranges, []string{"match", "ip", "dst", cidr})
+	}
+	for _, port := range netem.Ports {
+		ports = append(ports, []string{"match", "ip", "dport", strconv.Itoa(port), "0xffff"})
+	}
+	switch {
+	case len(ranges) == 0:
+		return ports
+	case len(ports) == 0:
+		return ranges
+	}
+	var matches [][]string
+	for _, r := range ranges {
+		for _, p := range ports {
+			matches = append(matches, append(append([]string(nil), r...), p...))
+		}
+	}
+	return matches
+}
+
+// defaultDevice returns the interface of the default IPv4 route
+func defaultDevice() (string, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[1] == "00000000" {
+			return fields[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("no default route to find the device from")
+}
+
+func tc(args ...string) error {
+	out, err := exec.Command("tc", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("tc %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func micros(d time.Duration) string {
+	return strconv.FormatInt(d.Microseconds(), 10) + "us"
+}
+
+func percent(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64) + "%"
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+func TestShapedRoot(t *testing.T) {
+	for show, want := range map[string]bool{
+		"qdisc netem 1: root refcnt 2 limit 1000 delay 200ms\n":                                                                          true,
+		"qdisc prio 1: root refcnt 2 bands 4 priomap 1 2 2 2 1 2 0 0 1 1 1 1 1 1 1 1\nqdisc netem 40: parent 1:4 limit 1000 loss 2.5%\n": true,
+		"qdisc noqueue 0: root refcnt 2\n":                             false,
+		"qdisc mq 0: root\nqdisc fq_codel 0: parent :1 limit 10240p\n": false,
+		// A netem qdisc that isn't the one the agent creates is left alone
+		"qdisc netem 8001: root refcnt 2 limit 1000 delay 10ms\n": false,
+		"": false,
+	} {
+		if got := shapedRoot(show); got != want {
+			t.Errorf("shapedRoot(%q) = %v, want %v", show, got, want)
+		}
+	}
+}
+
+func TestNetemArgs(t *testing.T) {
+	netem := &types.Netem{Delay: 200 * time.Millisecond, Jitter: 50 * time.Millisecond, Loss: 2.5, Corrupt: 0.1, Rate: "1mbit"}
+	want := []string{"delay", "200000us", "50000us", "loss", "2.5%", "corrupt", "0.1%", "rate", "1mbit"}
+	if got := netemArgs(netem); !reflect.DeepEqual(got, want) {
+		t.Errorf("netemArgs = %v, want %v", got, want)
+	}
+}
+
+func TestNetemMatches(t *testing.T) {
+	for name, c := range map[string]struct {
+		netem *types.Netem
+		want  [][]string
+	}{
+		"ranges and ports": {
+			netem: &types.Netem{Ranges: []string{"10.0.0.0/8"}, Ports: []int{5432, 6379}},
+			want: [][]string{
+				{"match", "ip", "dst", "10.0.0.0/8", "match", "ip", "dport", "5432", "0xffff"},
+				{"match", "ip", "dst", "10.0.0.0/8", "match", "ip", "dport", "6379", "0xffff"},
+			},
+		},
+		"ranges": {
+			netem: &types.Netem{Ranges: []string{"10.0.0.0/8", "192.168.0.0/16"}},
+			want:  [][]string{{"match", "ip", "dst", "10.0.0.0/8"}, {"match", "ip", "dst", "192.168.0.0/16"}},
+		},
+		"ports": {
+			netem: &types.Netem{Ports: []int{443}},
+			want:  [][]string{{"match", "ip", "dport", "443", "0xffff"}},
+		},
+	} {
+		if got := netemMatches(c.netem); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: netemMatches = %v, want %v", name, got, c.want)
+		}
+	}
+}
+
+func TestInjectRejectsInvalidNetem(t *testing.T) {
+	a := newAgent(t, "")
+	for name, netem := range map[string]*types.Netem{
+		"missing": nil,
+		"empty":   {Device: "lo"},
+		"jitter":  {Jitter: time.Millisecond, Loss: 1},
+		"rate":    {Rate: "fast"},
+		"range":   {Loss: 1, Ranges: []string{"10.0.0.0"}},
+	} {
+		if _, err := a.Inject(types.Fault{Kind: types.FaultNetem, TTL: time.Minute, Netem: netem}); err == nil {
+			t.Errorf("netem with an invalid %s should fail", name)
+		}
+	}
+}
+
+func TestRecoverNetemLeavesUnshapedDevice(t *testing.T) {
+	if _, err := exec.LookPath("tc"); err != nil {
+		t.Skip("tc is not available")
+	}
+	// The loopback device is never shaped by the tests so its qdisc must be left as it is
+	if err := recoverFault(Status{Fault: types.Fault{Kind: types.FaultNetem}, Targets: []string{"lo"}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// tombstoneTTL is how long a reverted fault is remembered so reverting it again is known to have succeeded
+const tombstoneTTL = 24 * time.Hour
+
+// stored is what the agent persists of each fault, the reverted time is set once the fault has been reverted
+type stored struct {
+	Status   Status    `json:"status"`
+	Reverted time.Time `json:"reverted,omitempty"`
+}
+
+// persist writes the fault to the state directory, replacing whatever was stored of it before
+func (a *Agent) persist(s stored) error {
+	if a.dir == "" {
+		return nil
+	}
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(a.dir, s.Status.Id+".json")
+	// Renaming the written file ensures a partially written fault is never read back
+	if err := ioutil.WriteFile(path+".tmp", buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// recoverFaults reverts every fault persisted by a previous agent that wasn't reverted before it stopped,
+// such as when it crashed or the host rebooted, and forgets the reverted faults older than the tombstoneTTL.
+func (a *Agent) recoverFaults() error {
+	if a.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(a.dir, 0700); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(a.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(a.dir, entry.Name())
+		var s stored
+		buf, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(buf, &s)
+		}
+		if err != nil {
+			a.log.Error("Unable to read persisted fault", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		switch {
+		case s.Reverted.IsZero():
+			if err := recoverFault(s.Status); err != nil {
+				a.log.Error("Failed to revert fault left by the previous agent", zap.String("fault", s.Status.Id), zap.String("kind", s.Status.Kind), zap.Error(err))
+				continue
+			}
+			s.Reverted = time.Now()
+			if err := a.persist(s); err != nil {
+				a.log.Error("Failed to persist reverted fault", zap.String("fault", s.Status.Id), zap.Error(err))
+			}
+			a.log.Info("Reverted fault left by the previous agent", zap.String("fault", s.Status.Id), zap.String("kind", s.Status.Kind), zap.Strings("targets", s.Status.Targets))
+		case time.Since(s.Reverted) > tombstoneTTL:
+			if err := os.Remove(path); err != nil {
+				a.log.Error("Unable to remove reverted fault", zap.String("path", path), zap.Error(err))
+			}
+			continue
+		}
+		a.reverted[s.Status.Id] = s.Reverted
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Phase describes where in its lifecycle a recorded change is
+type Phase string
+
+const (
+	// Begin is written before a mutating call is made
+	Begin Phase = "begin"
+	// Commit is written once the mutating call has successfully completed
+	Commit Phase = "commit"
+	// Fail is written when the mutating call did not apply any changes
+	Fail Phase = "fail"
+	// Revert is written once the change has been undone
+	Revert Phase = "revert"
+	// Final is written when the change was applied but can never be undone
+	Final Phase = "final"
+)
+
+// Entry is a single line within the journal.
+// Only the begin entry of a change holds the resource details,
+// the following entries reference it by the shared Id.
+type Entry struct {
+	Id      string          `json:"id"`
+	Phase   Phase           `json:"phase"`
+	Time    time.Time       `json:"time"`
+	Kind    string          `json:"kind,omitempty"`
+	Project string          `json:"project,omitempty"`
+	Zone    string          `json:"zone,omitempty"`
+	Name    string          `json:"name,omitempty"`
+	State   json.RawMessage `json:"state,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Journal is an append only log of every change made against the cloud
+// that is synced to disk after every write so that it survives the process being killed.
+// A nil Journal is valid and will discard everything written to it.
+type Journal struct {
+	lock sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Open will create or append to the journal stored at path
+func Open(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{
+		file: f,
+		enc:  json.NewEncoder(f),
+	}, nil
+}
+
+// Begin records the intent to change a resource along with the state
+// required to undo it and returns the id used to reference the change.
+func (j *Journal) Begin(kind, project, zone, name string, state interface{}) (string, error) {
+	if j == nil {
+		return "", nil
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	e := Entry{
+		Id:      id.String(),
+		Phase:   Begin,
+		Kind:    kind,
+		Project: project,
+		Zone:    zone,
+		Name:    name,
+	}
+	if state != nil {
+		if e.State, err = json.Marshal(state); err != nil {
+			return "", err
+		}
+	}
+	return e.Id, j.write(e)
+}
+
+// Commit marks the change as having been applied
+func (j *Journal) Commit(id string) error {
+	return j.write(Entry{Id: id, Phase: Commit})
+}
+
+// Fail marks the change as never having been applied
+func (j *Journal) Fail(id string, reason error) error {
+	e := Entry{Id: id, Phase: Fail}
+	if reason != nil {
+		e.Error = reason.Error()
+	}
+	return j.write(e)
+}
+
+// Revert marks the change as having been undone
+func (j *Journal) Revert(id string) error {
+	return j.write(Entry{Id: id, Phase: Revert})
+}
+
+// Final marks the change as having been applied for good, leaving nothing to revert
+func (j *Journal) Final(id string) error {
+	return j.write(Entry{Id: id, Phase: Final})
+}
+
+// Close will flush and release the underlying file
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+	return j.file.Close()
+}
+
+func (j *Journal) write(e Entry) error {
+	if j == nil || e.Id == "" {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	e.Time = time.Now().UTC()
+	if err := j.enc.Encode(e); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Read parses all the entries stored within the journal
+func Read(r io.Reader) ([]Entry, error) {
+	var (
+		entries []Entry
+		corrupt error
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		// A partially written final line is expected if the process
+		// was killed mid write, anywhere else means the journal is corrupt.
+		if corrupt != nil {
+			return nil, corrupt
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			corrupt = err
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Outstanding returns the begin entry of every change that has not been
+// reverted, finalised or known to have failed, ordered with the most recent change first.
+// Changes that never recorded a commit are included since the process
+// could have been killed after the change was made.
+func Outstanding(entries []Entry) []Entry {
+	var (
+		order   []string
+		changes = make(map[string]Entry)
+		done    = make(map[string]bool)
+	)
+	for _, e := range entries {
+		switch e.Phase {
+		case Begin:
+			order = append(order, e.Id)
+			changes[e.Id] = e
+		case Fail, Revert, Final:
+			done[e.Id] = true
+		}
+	}
+	outstanding := make([]Entry, 0, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		if !done[order[i]] {
+			outstanding = append(outstanding, changes[order[i]])
+		}
+	}
+	return outstanding
+}
@@ -0,0 +1,117 @@
+package journal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutstandingSkipsFinishedChanges(t *testing.T) {
+	entries := []Entry{
+		{Id: "committed", Phase: Begin},
+		{Id: "committed", Phase: Commit},
+		{Id: "failed", Phase: Begin},
+		{Id: "failed", Phase: Fail},
+		{Id: "reverted", Phase: Begin},
+		{Id: "reverted", Phase: Commit},
+		{Id: "reverted", Phase: Revert},
+		{Id: "final", Phase: Begin},
+		{Id: "final", Phase: Commit},
+		{Id: "final", Phase: Final},
+		// The process could have been killed before the commit was written
+		{Id: "uncommitted", Phase: Begin},
+	}
+	outstanding := Outstanding(entries)
+	if len(outstanding) != 2 {
+		t.Fatalf("outstanding %v, want the committed and uncommitted changes", outstanding)
+	}
+	if outstanding[0].Id != "uncommitted" || outstanding[1].Id != "committed" {
+		t.Errorf("outstanding %v, want the most recent change first", outstanding)
+	}
+}
+
+func TestReadToleratesPartialLastLine(t *testing.T) {
+	entries, err := Read(strings.NewReader(`{"id":"a","phase":"begin"}` + "\n" + `{"id":"a","pha`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Id != "a" {
+		t.Errorf("entries %v, want the complete entry", entries)
+	}
+}
+
+func TestReadRejectsCorruptEntry(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"id":"a","pha` + "\n" + `{"id":"a","phase":"begin"}` + "\n")); err == nil {
+		t.Error("a corrupt entry before the last line should fail")
+	}
+}
+
+func TestJournalRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type state struct {
+		Size int `json:"size"`
+	}
+	reverted, err := j.Begin("instance-stop", "p", "us-central1-a", "reverted", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resized, err := j.Begin("group-resize", "p", "us-central1-a", "resized", state{Size: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	failed, err := j.Begin("instance-stop", "p", "us-central1-a", "failed", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, err := range []error{
+		j.Commit(reverted),
+		j.Commit(resized),
+		j.Fail(failed, errors.New("quota exceeded")),
+		j.Revert(reverted),
+		j.Close(),
+	} {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := Read(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 7 {
+		t.Errorf("read %d entries, want 7", len(entries))
+	}
+	outstanding := Outstanding(entries)
+	if len(outstanding) != 1 || outstanding[0].Id != resized {
+		t.Fatalf("outstanding %v, want only the resize", outstanding)
+	}
+	if e := outstanding[0]; e.Kind != "group-resize" || e.Name != "resized" || string(e.State) != `{"size":3}` {
+		t.Errorf("entry %+v, want the resize with its state", e)
+	}
+}
+
+func TestNilJournalDiscards(t *testing.T) {
+	var j *Journal
+	id, err := j.Begin("instance-stop", "p", "us-central1-a", "a", nil)
+	if err != nil || id != "" {
+		t.Errorf("begin returned %q and %v, want nothing recorded", id, err)
+	}
+	if err := j.Revert(id); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "skirmish"
+
+var (
+	affected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resources_affected_total",
+		Help:      "The number of resources affected by a minion",
+	}, []string{"minion", "mode", "project"})
+
+	failed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resources_failed_total",
+		Help:      "The number of resources a minion failed to affect",
+	}, []string{"minion", "mode", "project"})
+
+	skipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resources_skipped_total",
+		Help:      "The number of resources a minion left alone, by the reason it was skipped",
+	}, []string{"minion", "reason"})
+
+	restores = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "restores_total",
+		Help:      "The number of resources restored, by whether the restore succeeded",
+	}, []string{"minion", "result"})
+
+	activeStep = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "step_active",
+		Help:      "Set to 1 while the step is being executed",
+	}, []string{"step"})
+
+	stepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "step_duration_seconds",
+		Help:      "How long each step took from starting to being restored",
+		Buckets:   []float64{1, 10, 60, 300, 600, 1800, 3600, 7200},
+	}, []string{"step"})
+
+	apiCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_calls_total",
+		Help:      "The number of calls made to the cloud provider",
+	}, []string{"method"})
+
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_call_errors_total",
+		Help:      "The number of calls made to the cloud provider that returned an error",
+	}, []string{"method"})
+)
+
+func init() {
+	prometheus.MustRegister(affected, failed, skipped, restores, activeStep, stepDuration, apiCalls, apiErrors)
+}
+
+// Handler returns the handler to expose the metrics to be scraped
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// StepStarted marks the step as active
+func StepStarted(step string) {
+	activeStep.WithLabelValues(step).Set(1)
+}
+
+// StepFinished marks the step as no longer active and records how long it took
+func StepFinished(step string, duration time.Duration) {
+	activeStep.WithLabelValues(step).Set(0)
+	stepDuration.WithLabelValues(step).Observe(duration.Seconds())
+}
+
+// ObserveMinion records what the minion did during its Do
+func ObserveMinion(result types.MinionResult, mode string) {
+	for _, o := range result.Affected {
+		affected.WithLabelValues(result.Minion, mode, o.Project).Inc()
+	}
+	for _, o := range result.Failed {
+		failed.WithLabelValues(result.Minion, mode, o.Project).Inc()
+	}
+	for _, o := range result.Skipped {
+		skipped.WithLabelValues(result.Minion, o.Reason).Inc()
+	}
+}
+
+// ObserveRestore records the outcome of every resource the minion restored
+func ObserveRestore(minion string, restored []types.Outcome) {
+	for _, o := range restored {
+		outcome := "success"
+		if o.Error != "" {
+			outcome = "failure"
+		}
+		restores.WithLabelValues(minion, outcome).Inc()
+	}
+}
+
+// observeCall records the call to the provider method and if it failed
+func observeCall(method string, err error) {
+	apiCalls.WithLabelValues(method).Inc()
+	if err != nil {
+		apiErrors.WithLabelValues(method).Inc()
+	}
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/provider"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveMinion(t *testing.T) {
+	stopped, excluded := affected.WithLabelValues("metrics-test", types.Repairable, "p"), skipped.WithLabelValues("metrics-test", "exclusion")
+	before, beforeSkipped := testutil.ToFloat64(stopped), testutil.ToFloat64(excluded)
+	var result types.MinionResult
+	result.Minion = "metrics-test"
+	result.Affect(types.Resource{Project: "p", Name: "a"}, "stop")
+	result.Affect(types.Resource{Project: "p", Name: "b"}, "stop")
+	result.Skip(types.Resource{Project: "p", Name: "c"}, "exclusion")
+	result.Fail(types.Resource{Project: "p", Name: "d"}, "stop", errors.New("quota exceeded"))
+	ObserveMinion(result, types.Repairable)
+	if got := testutil.ToFloat64(stopped) - before; got != 2 {
+		t.Errorf("affected increased by %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(excluded) - beforeSkipped; got != 1 {
+		t.Errorf("skipped increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(failed.WithLabelValues("metrics-test", types.Repairable, "p")); got != 1 {
+		t.Errorf("failed is %v, want 1", got)
+	}
+}
+
+func TestObserveRestore(t *testing.T) {
+	res := types.Resource{Project: "p", Name: "a"}
+	ObserveRestore("metrics-restore", []types.Outcome{
+		types.Restore(res, "start", nil),
+		types.Restore(res, "start", nil),
+		types.Restore(res, "start", errors.New("not found")),
+	})
+	if got := testutil.ToFloat64(restores.WithLabelValues("metrics-restore", "success")); got != 2 {
+		t.Errorf("successful restores is %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(restores.WithLabelValues("metrics-restore", "failure")); got != 1 {
+		t.Errorf("failed restores is %v, want 1", got)
+	}
+}
+
+func TestStepStartedAndFinished(t *testing.T) {
+	StepStarted("metrics-step")
+	if got := testutil.ToFloat64(activeStep.WithLabelValues("metrics-step")); got != 1 {
+		t.Errorf("step active is %v while running, want 1", got)
+	}
+	StepFinished("metrics-step", time.Second)
+	if got := testutil.ToFloat64(activeStep.WithLabelValues("metrics-step")); got != 0 {
+		t.Errorf("step active is %v once finished, want 0", got)
+	}
+}
+
+func TestInstrumentCountsCalls(t *testing.T) {
+	p := Instrument(provider.NewFake("us-central1-a"))
+	if Instrument(p) != p {
+		t.Error("instrumenting a provider twice should not count calls twice")
+	}
+	calls, errs := apiCalls.WithLabelValues("GetInstance"), apiErrors.WithLabelValues("GetInstance")
+	before, beforeErrs := testutil.ToFloat64(calls), testutil.ToFloat64(errs)
+	if _, err := p.GetInstance(context.Background(), "p", "us-central1-a", "missing"); err == nil {
+		t.Fatal("getting a missing instance should fail")
+	}
+	if _, err := p.ListZones(context.Background(), "p"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := testutil.ToFloat64(calls) - before; got != 1 {
+		t.Errorf("calls increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(errs) - beforeErrs; got != 1 {
+		t.Errorf("errors increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(apiErrors.WithLabelValues("ListZones")); got != 0 {
+		t.Errorf("ListZones errors is %v, want 0", got)
+	}
+}
+
+func TestHandlerExposesMetrics(t *testing.T) {
+	StepStarted("metrics-handler")
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	if !strings.Contains(string(body), `skirmish_step_active{step="metrics-handler"} 1`) {
+		t.Errorf("metrics did not include the active step:\n%s", body)
+	}
+}
@@ -0,0 +1,267 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+// instrumented records every call made to the embedded provider
+type instrumented struct {
+	types.Provider
+}
+
+// Instrument wraps the provider so that every call and error is counted
+func Instrument(p types.Provider) types.Provider {
+	if _, done := p.(*instrumented); done {
+		return p
+	}
+	return &instrumented{Provider: p}
+}
+
+func (i *instrumented) ListZones(ctx context.Context, project string) ([]string, error) {
+	zones, err := i.Provider.ListZones(ctx, project)
+	observeCall("ListZones", err)
+	return zones, err
+}
+
+func (i *instrumented) ListRegions(ctx context.Context, project string) ([]string, error) {
+	regions, err := i.Provider.ListRegions(ctx, project)
+	observeCall("ListRegions", err)
+	return regions, err
+}
+
+func (i *instrumented) ListInstances(ctx context.Context, project, zone string) ([]*types.Instance, error) {
+	instances, err := i.Provider.ListInstances(ctx, project, zone)
+	observeCall("ListInstances", err)
+	return instances, err
+}
+
+func (i *instrumented) GetInstance(ctx context.Context, project, zone, name string) (*types.Instance, error) {
+	instance, err := i.Provider.GetInstance(ctx, project, zone, name)
+	observeCall("GetInstance", err)
+	return instance, err
+}
+
+func (i *instrumented) StopInstance(ctx context.Context, project, zone, name string) error {
+	err := i.Provider.StopInstance(ctx, project, zone, name)
+	observeCall("StopInstance", err)
+	return err
+}
+
+func (i *instrumented) StartInstance(ctx context.Context, project, zone, name string) error {
+	err := i.Provider.StartInstance(ctx, project, zone, name)
+	observeCall("StartInstance", err)
+	return err
+}
+
+func (i *instrumented) DeleteInstance(ctx context.Context, project, zone, name string) error {
+	err := i.Provider.DeleteInstance(ctx, project, zone, name)
+	observeCall("DeleteInstance", err)
+	return err
+}
+
+func (i *instrumented) SetInstanceLabels(ctx context.Context, project, zone, name string, labels map[string]string, fingerprint string) error {
+	err := i.Provider.SetInstanceLabels(ctx, project, zone, name, labels, fingerprint)
+	observeCall("SetInstanceLabels", err)
+	return err
+}
+
+func (i *instrumented) SetInstanceTags(ctx context.Context, project, zone, name string, tags []string, fingerprint string) error {
+	err := i.Provider.SetInstanceTags(ctx, project, zone, name, tags, fingerprint)
+	observeCall("SetInstanceTags", err)
+	return err
+}
+
+func (i *instrumented) SimulateMaintenanceEvent(ctx context.Context, project, zone, name string) error {
+	err := i.Provider.SimulateMaintenanceEvent(ctx, project, zone, name)
+	observeCall("SimulateMaintenanceEvent", err)
+	return err
+}
+
+func (i *instrumented) SetInstanceScheduling(ctx context.Context, project, zone, name string, scheduling types.Scheduling) error {
+	err := i.Provider.SetInstanceScheduling(ctx, project, zone, name, scheduling)
+	observeCall("SetInstanceScheduling", err)
+	return err
+}
+
+func (i *instrumented) AttachDisk(ctx context.Context, project, zone, name string, disk types.AttachedDisk) error {
+	err := i.Provider.AttachDisk(ctx, project, zone, name, disk)
+	observeCall("AttachDisk", err)
+	return err
+}
+
+func (i *instrumented) DetachDisk(ctx context.Context, project, zone, name, device string) error {
+	err := i.Provider.DetachDisk(ctx, project, zone, name, device)
+	observeCall("DetachDisk", err)
+	return err
+}
+
+func (i *instrumented) SnapshotDisk(ctx context.Context, project, zone, disk, snapshot string) error {
+	err := i.Provider.SnapshotDisk(ctx, project, zone, disk, snapshot)
+	observeCall("SnapshotDisk", err)
+	return err
+}
+
+func (i *instrumented) DeleteDisk(ctx context.Context, project, zone, disk string) error {
+	err := i.Provider.DeleteDisk(ctx, project, zone, disk)
+	observeCall("DeleteDisk", err)
+	return err
+}
+
+func (i *instrumented) ListInstanceGroups(ctx context.Context, project, zone string) ([]*types.InstanceGroup, error) {
+	groups, err := i.Provider.ListInstanceGroups(ctx, project, zone)
+	observeCall("ListInstanceGroups", err)
+	return groups, err
+}
+
+func (i *instrumented) ListGroupInstances(ctx context.Context, project, zone, group string) ([]string, error) {
+	instances, err := i.Provider.ListGroupInstances(ctx, project, zone, group)
+	observeCall("ListGroupInstances", err)
+	return instances, err
+}
+
+func (i *instrumented) ResizeInstanceGroup(ctx context.Context, project, zone, group string, size int64) error {
+	err := i.Provider.ResizeInstanceGroup(ctx, project, zone, group, size)
+	observeCall("ResizeInstanceGroup", err)
+	return err
+}
+
+func (i *instrumented) AbandonGroupInstances(ctx context.Context, project, zone, group string, instances []string) error {
+	err := i.Provider.AbandonGroupInstances(ctx, project, zone, group, instances)
+	observeCall("AbandonGroupInstances", err)
+	return err
+}
+
+func (i *instrumented) RecreateGroupInstances(ctx context.Context, project, zone, group string, instances []string) error {
+	err := i.Provider.RecreateGroupInstances(ctx, project, zone, group, instances)
+	observeCall("RecreateGroupInstances", err)
+	return err
+}
+
+func (i *instrumented) RestartInstanceGroup(ctx context.Context, project, zone, group string) error {
+	err := i.Provider.RestartInstanceGroup(ctx, project, zone, group)
+	observeCall("RestartInstanceGroup", err)
+	return err
+}
+
+func (i *instrumented) GetGroupUpdatePolicy(ctx context.Context, project, zone, group string) (json.RawMessage, error) {
+	policy, err := i.Provider.GetGroupUpdatePolicy(ctx, project, zone, group)
+	observeCall("GetGroupUpdatePolicy", err)
+	return policy, err
+}
+
+func (i *instrumented) SetGroupUpdatePolicy(ctx context.Context, project, zone, group string, policy json.RawMessage) error {
+	err := i.Provider.SetGroupUpdatePolicy(ctx, project, zone, group, policy)
+	observeCall("SetGroupUpdatePolicy", err)
+	return err
+}
+
+func (i *instrumented) InsertFirewall(ctx context.Context, project string, rule *types.FirewallRule) error {
+	err := i.Provider.InsertFirewall(ctx, project, rule)
+	observeCall("InsertFirewall", err)
+	return err
+}
+
+func (i *instrumented) DeleteFirewall(ctx context.Context, project, name string) error {
+	err := i.Provider.DeleteFirewall(ctx, project, name)
+	observeCall("DeleteFirewall", err)
+	return err
+}
+
+func (i *instrumented) ListDatabases(ctx context.Context, project string) ([]*types.Database, error) {
+	databases, err := i.Provider.ListDatabases(ctx, project)
+	observeCall("ListDatabases", err)
+	return databases, err
+}
+
+func (i *instrumented) FailoverDatabase(ctx context.Context, project, name string, settingsVersion int64) error {
+	err := i.Provider.FailoverDatabase(ctx, project, name, settingsVersion)
+	observeCall("FailoverDatabase", err)
+	return err
+}
+
+func (i *instrumented) RestartDatabase(ctx context.Context, project, name string) error {
+	err := i.Provider.RestartDatabase(ctx, project, name)
+	observeCall("RestartDatabase", err)
+	return err
+}
+
+func (i *instrumented) SetDatabaseAuthorizedNetworks(ctx context.Context, project, name string, networks []types.AuthorizedNetwork) error {
+	err := i.Provider.SetDatabaseAuthorizedNetworks(ctx, project, name, networks)
+	observeCall("SetDatabaseAuthorizedNetworks", err)
+	return err
+}
+
+func (i *instrumented) GetBackendService(ctx context.Context, project, region, name string) (*types.BackendService, error) {
+	service, err := i.Provider.GetBackendService(ctx, project, region, name)
+	observeCall("GetBackendService", err)
+	return service, err
+}
+
+func (i *instrumented) UpdateBackendService(ctx context.Context, project, region, name string, backends []types.Backend, fingerprint string) error {
+	err := i.Provider.UpdateBackendService(ctx, project, region, name, backends, fingerprint)
+	observeCall("UpdateBackendService", err)
+	return err
+}
+
+func (i *instrumented) Identity(ctx context.Context) (string, error) {
+	identity, err := i.Provider.Identity(ctx)
+	observeCall("Identity", err)
+	return identity, err
+}
+
+func (i *instrumented) GetIamPolicy(ctx context.Context, project string) (*types.Policy, error) {
+	policy, err := i.Provider.GetIamPolicy(ctx, project)
+	observeCall("GetIamPolicy", err)
+	return policy, err
+}
+
+func (i *instrumented) SetIamBindings(ctx context.Context, project string, bindings []types.Binding, etag string) error {
+	err := i.Provider.SetIamBindings(ctx, project, bindings, etag)
+	observeCall("SetIamBindings", err)
+	return err
+}
+
+func (i *instrumented) RolePermissions(ctx context.Context, role string) ([]string, error) {
+	permissions, err := i.Provider.RolePermissions(ctx, role)
+	observeCall("RolePermissions", err)
+	return permissions, err
+}
+
+func (i *instrumented) ListNodePools(ctx context.Context, project, location, cluster string) ([]*types.NodePool, error) {
+	pools, err := i.Provider.ListNodePools(ctx, project, location, cluster)
+	observeCall("ListNodePools", err)
+	return pools, err
+}
+
+func (i *instrumented) ResizeNodePool(ctx context.Context, project, location, cluster, pool string, size int64) error {
+	err := i.Provider.ResizeNodePool(ctx, project, location, cluster, pool, size)
+	observeCall("ResizeNodePool", err)
+	return err
+}
+
+func (i *instrumented) SetNodeSchedulable(ctx context.Context, project, location, cluster, node string, schedulable bool) error {
+	err := i.Provider.SetNodeSchedulable(ctx, project, location, cluster, node, schedulable)
+	observeCall("SetNodeSchedulable", err)
+	return err
+}
+
+func (i *instrumented) DrainNode(ctx context.Context, project, location, cluster, node string) error {
+	err := i.Provider.DrainNode(ctx, project, location, cluster, node)
+	observeCall("DrainNode", err)
+	return err
+}
+
+func (i *instrumented) InsertRoute(ctx context.Context, project string, route *types.Route) error {
+	err := i.Provider.InsertRoute(ctx, project, route)
+	observeCall("InsertRoute", err)
+	return err
+}
+
+func (i *instrumented) DeleteRoute(ctx context.Context, project, name string) error {
+	err := i.Provider.DeleteRoute(ctx, project, name)
+	observeCall("DeleteRoute", err)
+	return err
+}
@@ -0,0 +1,181 @@
+package minions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/agent"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type agentDriver struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	svc      *types.Services
+	metadata *types.Metadata
+	recover  []*faulted
+	// faults returns what the step has each agent inject
+	faults func(step types.Step) []types.Fault
+}
+
+// faulted tracks the fault injected by the agent on the instance with the journal entry that recorded it
+type faulted struct {
+	instance *types.Instance
+	state    agentState
+	change   string
+}
+
+// agentState is journaled so the fault can be reverted through the agent that injected it
+type agentState struct {
+	Address string `json:"address"`
+	Id      string `json:"id"`
+	Kind    string `json:"kind"`
+}
+
+// NewAgent returns a minion that has the agent running on each instance inject faults into its host
+func NewAgent(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &agentDriver{
+		log:      log,
+		svc:      svc,
+		metadata: meta,
+		faults: func(step types.Step) []types.Fault {
+			return step.Settings.Agent.Faults
+		},
+	}
+}
+
+// NewNetem returns a minion that has the agent running on each instance degrade the instance's network,
+// the agents are reached using the step's agent settings.
+func NewNetem(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &agentDriver{
+		log:      log,
+		svc:      svc,
+		metadata: meta,
+		faults: func(step types.Step) []types.Fault {
+			settings := step.Settings.Netem
+			if !settings.Enabled() {
+				return nil
+			}
+			return []types.Fault{{Kind: types.FaultNetem, TTL: settings.TTL, Netem: &settings.Netem}}
+		},
+	}
+}
+
+func (ad *agentDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	ad.lock.Lock()
+	defer ad.lock.Unlock()
+	settings := step.Settings.Agent
+	if settings.Port == 0 {
+		settings.Port = agent.DefaultPort
+	}
+	faults := ad.faults(step)
+	if len(faults) == 0 {
+		result.Error = "no faults configured for the agents to inject"
+		return result
+	}
+	instances, err := selectInstances(ctx, ad.svc, ad.metadata, &step, &result)
+	if err != nil {
+		ad.log.Error("Failed to gather instances", zap.Error(err))
+		result.Error = err.Error()
+		return result
+	}
+	for _, instance := range instances {
+		host := settings.Host
+		if host == "" {
+			host = instance.InternalIP
+		}
+		address := net.JoinHostPort(host, strconv.Itoa(settings.Port))
+		for _, fault := range faults {
+			if mode == types.DryRun {
+				ad.log.Info("Injecting fault", zap.String("instance", instance.Name), zap.String("fault", fault.Kind), zap.String("agent", address), zap.String("mode", mode))
+				result.Affect(instance.Resource(), fault.Kind)
+				continue
+			}
+			state, change, err := ad.inject(ctx, instance, address, fault, step.Wait)
+			if err != nil {
+				ad.log.Error("Failed to inject fault", zap.Error(err), zap.String("instance", instance.Name), zap.String("fault", fault.Kind), zap.String("agent", address))
+				result.Fail(instance.Resource(), fault.Kind, err)
+				continue
+			}
+			switch {
+			case fault.Kind == types.FaultKill:
+				// Killed processes can't be brought back so there is nothing left to restore
+				if err := ad.svc.Journal.Final(change); err != nil {
+					ad.log.Error("Failed to journal killed processes", zap.Error(err), zap.String("instance", instance.Name))
+				}
+			case mode == types.Repairable:
+				ad.recover = append(ad.recover, &faulted{instance: instance, state: state, change: change})
+			}
+			ad.log.Info("Successfully injected fault", zap.String("instance", instance.Name), zap.String("fault", fault.Kind), zap.String("id", state.Id))
+			result.Affect(instance.Resource(), fault.Kind)
+		}
+	}
+	return result
+}
+
+// inject journals the fault before the agent injects it, the fault expires a minute after the step's wait unless it has a TTL
+func (ad *agentDriver) inject(ctx context.Context, instance *types.Instance, address string, fault types.Fault, wait time.Duration) (agentState, string, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return agentState{}, "", err
+	}
+	fault.Id = id.String()
+	if fault.TTL == 0 {
+		fault.TTL = wait + time.Minute
+	}
+	state := agentState{Address: address, Id: fault.Id, Kind: fault.Kind}
+	change, err := record(ad.svc, KindAgentFault, instance.Project, instance.CompleteZone(), instance.Name, state, func() error {
+		client, err := agent.NewClient(address)
+		if err != nil {
+			return err
+		}
+		_, err = client.Inject(ctx, fault)
+		return err
+	})
+	return state, change, err
+}
+
+func (ad *agentDriver) Restore() (restored []types.Outcome) {
+	ad.lock.Lock()
+	defer ad.lock.Unlock()
+	for i := len(ad.recover) - 1; i >= 0; i-- {
+		f := ad.recover[i]
+		if err := revertFault(context.Background(), f.state); err != nil {
+			ad.log.Error("Failed to revert fault", zap.Error(err), zap.String("instance", f.instance.Name), zap.String("fault", f.state.Kind))
+			restored = append(restored, types.Restore(f.instance.Resource(), "revert", err))
+			continue
+		}
+		if err := ad.svc.Journal.Revert(f.change); err != nil {
+			ad.log.Error("Failed to journal reverted fault", zap.Error(err), zap.String("instance", f.instance.Name))
+		}
+		ad.log.Info("Successfully reverted fault", zap.String("instance", f.instance.Name), zap.String("fault", f.state.Kind))
+		restored = append(restored, types.Restore(f.instance.Resource(), "revert", nil))
+	}
+	ad.recover = nil
+	return restored
+}
+
+// revertFault has the agent revert the fault, a fault the agent already reverted such as once it expired is done.
+// An agent with no record of the fault may have lost it, so that is reported rather than assumed to be reverted.
+func revertFault(ctx context.Context, state agentState) error {
+	client, err := agent.NewClient(state.Address)
+	if err != nil {
+		return err
+	}
+	switch err := client.Revert(ctx, state.Id); {
+	case errors.Is(err, agent.ErrReverted):
+		return nil
+	case errors.Is(err, types.ErrNotFound):
+		return fmt.Errorf("agent %s has no record of fault %s, it may still be active: %w", state.Address, state.Id, err)
+	default:
+		return err
+	}
+}
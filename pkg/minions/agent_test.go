@@ -0,0 +1,121 @@
+package minions
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/agent"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// agentStep has the agent served locally write a file for the only instance in us-central1-a
+func agentStep(t *testing.T, kind string) (types.Step, *agent.Agent) {
+	a, err := agent.New(zap.NewNop(), "secret", time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(a.Shutdown)
+	t.Setenv(agent.TokenEnv, "secret")
+	srv := httptest.NewServer(a.Handler())
+	t.Cleanup(srv.Close)
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	fault := types.Fault{Kind: kind, Path: t.TempDir(), Megabytes: 1}
+	return types.Step{
+		Projects: []string{"p"},
+		Sample:   1,
+		Include:  types.Include{Wildcards: []string{"^demo-us-central1-a-"}},
+		Settings: types.Settings{Agent: types.AgentSettings{Host: host, Port: p, Faults: []types.Fault{fault}}},
+	}, a
+}
+
+func TestAgentInjectsAndReverts(t *testing.T) {
+	f := newFixture(t, 1)
+	step, a := agentStep(t, types.FaultDisk)
+	m := NewAgent(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), step, types.Repairable)
+	if result.Error != "" || len(result.Affected) != 1 {
+		t.Fatalf("result %+v, want the fault injected", result)
+	}
+	if faults := a.Faults(); len(faults) != 1 || faults[0].TTL != time.Minute {
+		t.Errorf("agent has %+v, want the fault expiring a minute after the step", faults)
+	}
+	if changes := f.outstanding(t); len(changes) != 1 || changes[0].Kind != KindAgentFault {
+		t.Errorf("journal has %v, want the injected fault", changes)
+	}
+	if restored := m.Restore(); len(restored) != 1 || restored[0].Error != "" {
+		t.Errorf("restored %+v, want the fault reverted", restored)
+	}
+	if faults := a.Faults(); len(faults) != 0 {
+		t.Errorf("agent still has %+v", faults)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestAgentDryRunInjectsNothing(t *testing.T) {
+	f := newFixture(t, 1)
+	step, a := agentStep(t, types.FaultDisk)
+	result := NewAgent(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), step, types.DryRun)
+	if len(result.Affected) != 1 {
+		t.Errorf("result %+v, want the fault reported", result)
+	}
+	if faults := a.Faults(); len(faults) != 0 {
+		t.Errorf("agent has %+v from a dry run", faults)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has changes %v from a dry run", changes)
+	}
+}
+
+func TestRevertRevertsJournaledFault(t *testing.T) {
+	f := newFixture(t, 1)
+	step, a := agentStep(t, types.FaultDisk)
+	NewAgent(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), step, types.Repairable)
+	changes := f.outstanding(t)
+	if len(changes) != 1 {
+		t.Fatalf("journal has %v, want the injected fault", changes)
+	}
+	// Reverting a fault the agent has already reverted succeeds
+	for i := 0; i < 2; i++ {
+		if err := Revert(context.Background(), f.svc, changes[0]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if faults := a.Faults(); len(faults) != 0 {
+		t.Errorf("agent still has %+v once reverted", faults)
+	}
+}
+
+func TestNetemRequiresDegradation(t *testing.T) {
+	f := newFixture(t, 1)
+	step, a := agentStep(t, types.FaultDisk)
+	step.Settings.Netem = types.NetemSettings{Netem: types.Netem{Ports: []int{443}}}
+	result := NewNetem(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), step, types.Repairable)
+	if result.Error == "" || len(result.Affected) != 0 {
+		t.Errorf("result %+v, want an error as the netem degrades nothing", result)
+	}
+	if faults := a.Faults(); len(faults) != 0 {
+		t.Errorf("agent has %+v, want nothing injected", faults)
+	}
+}
+
+func TestRevertReportsFaultUnknownToAgent(t *testing.T) {
+	step, _ := agentStep(t, types.FaultDisk)
+	settings := step.Settings.Agent
+	state := agentState{Address: net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port)), Id: "unknown", Kind: types.FaultDisk}
+	// The agent may have lost the fault, such as when its host was replaced, so it can't be assumed reverted
+	if err := revertFault(context.Background(), state); err == nil {
+		t.Error("reverting a fault the agent has no record of should fail")
+	}
+}
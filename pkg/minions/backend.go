@@ -0,0 +1,183 @@
+package minions
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+type backendDriver struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	svc      *types.Services
+	metadata *types.Metadata
+	recover  []*drained
+}
+
+// drained tracks the original configuration of the changed backends with the journal entry that recorded it
+type drained struct {
+	project  string
+	region   string
+	service  string
+	backends []types.Backend
+	change   string
+}
+
+// NewBackend returns a minion that removes or drains the backends of a load balancer's backend service
+func NewBackend(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &backendDriver{
+		log:      log,
+		svc:      svc,
+		metadata: meta,
+	}
+}
+
+func (bd *backendDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	bd.lock.Lock()
+	defer bd.lock.Unlock()
+	settings := step.Settings.Backend
+	if settings.Service == "" {
+		result.Error = "backend requires a service"
+		return result
+	}
+	if settings.Action == "" {
+		settings.Action = types.BackendDrain
+	}
+	r := rand.New(rand.NewSource(step.Seed))
+	for _, project := range step.Projects {
+		service, err := bd.svc.Provider.GetBackendService(ctx, project, settings.Region, settings.Service)
+		if err != nil {
+			bd.log.Error("Failed to get backend service", zap.Error(err), zap.String("service", settings.Service), zap.String("project", project))
+			result.Error = err.Error()
+			return result
+		}
+		selected := make(map[string]bool)
+		for _, backend := range service.Backends {
+			switch {
+			case isExcluded(step.Exclude, backendView(project, backend)):
+				result.Skip(backendResource(project, backend), "exclusion")
+			case r.Float32() > step.Sample:
+				result.Skip(backendResource(project, backend), "sampling")
+			default:
+				selected[backend.Group] = true
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+		if mode == types.DryRun {
+			for _, backend := range service.Backends {
+				if selected[backend.Group] {
+					bd.log.Info("Changing backend", zap.String("group", backend.Group), zap.String("action", settings.Action), zap.String("mode", mode))
+					result.Affect(backendResource(project, backend), settings.Action)
+				}
+			}
+			continue
+		}
+		original, change, err := bd.update(ctx, service, selected, settings.Action)
+		if err != nil {
+			bd.log.Error("Failed to change backends", zap.Error(err), zap.String("service", settings.Service), zap.String("project", project))
+			for _, backend := range service.Backends {
+				if selected[backend.Group] {
+					result.Fail(backendResource(project, backend), settings.Action, err)
+				}
+			}
+			continue
+		}
+		switch mode {
+		case types.Repairable:
+			bd.recover = append(bd.recover, &drained{project: project, region: settings.Region, service: settings.Service, backends: original, change: change})
+		case types.Destruction:
+			finalise(bd.svc, bd.log, change)
+		}
+		for _, backend := range original {
+			bd.log.Info("Successfully changed backend", zap.String("group", backend.Group), zap.String("action", settings.Action))
+			result.Affect(backendResource(project, backend), settings.Action)
+		}
+	}
+	return result
+}
+
+// update removes or drains the selected backends, journaling their exact configuration beforehand.
+// If the service changes before it is updated, it is read again and the change retried.
+func (bd *backendDriver) update(ctx context.Context, service *types.BackendService, selected map[string]bool, action string) ([]types.Backend, string, error) {
+	for attempt := 0; ; attempt++ {
+		var backends, original []types.Backend
+		for _, backend := range service.Backends {
+			if !selected[backend.Group] {
+				backends = append(backends, backend)
+				continue
+			}
+			original = append(original, backend)
+			if action == types.BackendDrain {
+				backend.Drained = true
+				backends = append(backends, backend)
+			}
+		}
+		change, err := record(bd.svc, KindBackendUpdate, service.Project, service.Region, service.Name, original, func() error {
+			return bd.svc.Provider.UpdateBackendService(ctx, service.Project, service.Region, service.Name, backends, service.Fingerprint)
+		})
+		if !errors.Is(err, types.ErrConflict) || attempt == conflictRetries {
+			return original, change, err
+		}
+		if service, err = bd.svc.Provider.GetBackendService(ctx, service.Project, service.Region, service.Name); err != nil {
+			return nil, "", err
+		}
+	}
+}
+
+func (bd *backendDriver) Restore() (restored []types.Outcome) {
+	bd.lock.Lock()
+	defer bd.lock.Unlock()
+	for i := len(bd.recover) - 1; i >= 0; i-- {
+		d := bd.recover[i]
+		err := resetBackends(context.Background(), bd.svc, d.project, d.region, d.service, d.backends)
+		for _, backend := range d.backends {
+			restored = append(restored, types.Restore(backendResource(d.project, backend), "restore", err))
+		}
+		if err != nil {
+			bd.log.Error("Failed to restore backends", zap.String("service", d.service), zap.String("project", d.project), zap.Error(err))
+			continue
+		}
+		if err := bd.svc.Journal.Revert(d.change); err != nil {
+			bd.log.Error("Failed to journal restored backends", zap.String("service", d.service), zap.Error(err))
+		}
+		bd.log.Info("Successfully restored backends", zap.String("service", d.service), zap.String("project", d.project), zap.Int("backends", len(d.backends)))
+	}
+	bd.recover = nil
+	return restored
+}
+
+// backendView describes the backend's group as an instance so the step's exclusions apply to it
+func backendView(project string, backend types.Backend) *types.Instance {
+	view := &types.Instance{Name: backendName(backend), Project: project}
+	parts := strings.Split(backend.Group, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		switch parts[i] {
+		case "zones":
+			view.Region, view.Zone = splitZone(parts[i+1])
+		case "regions":
+			view.Region = parts[i+1]
+		}
+	}
+	return view
+}
+
+func backendName(backend types.Backend) string {
+	return backend.Group[strings.LastIndex(backend.Group, "/")+1:]
+}
+
+func backendResource(project string, backend types.Backend) types.Resource {
+	view := backendView(project, backend)
+	location := view.Region
+	if view.Zone != "" {
+		location = view.CompleteZone()
+	}
+	return types.Resource{Kind: "backend", Project: project, Zone: location, Name: view.Name}
+}
@@ -0,0 +1,140 @@
+package minions
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+func backendStep(action string) types.Step {
+	return types.Step{Projects: []string{"p"}, Sample: 1, Settings: types.Settings{Backend: types.BackendSettings{Service: "demo-backend", Action: action}}}
+}
+
+// backends returns the configuration of every backend of the populated service
+func (f *fixture) backends(t *testing.T) []string {
+	service, err := f.fake.GetBackendService(context.Background(), "p", "", "demo-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs := make([]string, 0, len(service.Backends))
+	for _, backend := range service.Backends {
+		configs = append(configs, string(backend.Config))
+	}
+	return configs
+}
+
+// serving reports if every backend of the populated service is at full capacity
+func (f *fixture) serving(t *testing.T) bool {
+	configs := f.backends(t)
+	for _, config := range configs {
+		if !strings.Contains(config, `"capacityScaler":1`) {
+			return false
+		}
+	}
+	return len(configs) == len(testZones)
+}
+
+func TestBackendDrainAndRestore(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewBackend(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), backendStep(types.BackendDrain), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 2 {
+		t.Fatalf("result %+v, want every backend drained", result)
+	}
+	for _, config := range f.backends(t) {
+		if !strings.Contains(config, `"capacityScaler":0`) {
+			t.Errorf("backend %s was not drained", config)
+		}
+	}
+	if changes := f.outstanding(t); len(changes) != 1 || changes[0].Kind != KindBackendUpdate {
+		t.Errorf("journal has %v, want the backend update", changes)
+	}
+	if restored := m.Restore(); len(restored) != 2 || restored[0].Error != "" {
+		t.Errorf("restored %+v, want every backend", restored)
+	}
+	if !f.serving(t) {
+		t.Errorf("backends %v, want every backend serving once restored", f.backends(t))
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestBackendRemoveSkipsExcluded(t *testing.T) {
+	f := newFixture(t, 1)
+	step := backendStep(types.BackendRemove)
+	step.Exclude.Zones = []string{"us-central1-a"}
+	m := NewBackend(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), step, types.Repairable)
+	if len(result.Affected) != 1 || result.Affected[0].Resource.Zone != "us-central1-b" {
+		t.Fatalf("affected %+v, want only the backend outside the excluded zone", result.Affected)
+	}
+	if configs := f.backends(t); len(configs) != 1 || !strings.Contains(configs[0], "us-central1-a") {
+		t.Errorf("backends %v, want only the excluded backend left", configs)
+	}
+	m.Restore()
+	if !f.serving(t) {
+		t.Errorf("backends %v, want every backend serving once restored", f.backends(t))
+	}
+}
+
+func TestBackendDryRunChangesNothing(t *testing.T) {
+	f := newFixture(t, 1)
+	result := NewBackend(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), backendStep(types.BackendRemove), types.DryRun)
+	if len(result.Affected) != 2 {
+		t.Errorf("result %+v, want every backend reported", result)
+	}
+	if !f.serving(t) {
+		t.Errorf("backends %v were changed during a dry run", f.backends(t))
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has changes %v from a dry run", changes)
+	}
+}
+
+func TestBackendRequiresService(t *testing.T) {
+	f := newFixture(t, 1)
+	step := backendStep(types.BackendDrain)
+	step.Settings.Backend.Service = "missing"
+	if result := NewBackend(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), step, types.Repairable); result.Error == "" {
+		t.Error("an unknown service should fail")
+	}
+}
+
+func TestBackendUpdateRetriesConflict(t *testing.T) {
+	f := newFixture(t, 1)
+	ctx := context.Background()
+	service, err := f.fake.GetBackendService(ctx, "p", "", "demo-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The service changes after it was read so its fingerprint is stale
+	if err := f.fake.UpdateBackendService(ctx, "p", "", "demo-backend", service.Backends, service.Fingerprint); err != nil {
+		t.Fatal(err)
+	}
+	bd := NewBackend(zap.NewNop(), f.svc, f.metadata).(*backendDriver)
+	original, _, err := bd.update(ctx, service, map[string]bool{service.Backends[0].Group: true}, types.BackendRemove)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(original) != 1 || len(f.backends(t)) != 1 {
+		t.Errorf("removed %v leaving %v, want one backend removed", original, f.backends(t))
+	}
+}
+
+func TestRevertRestoresJournaledBackends(t *testing.T) {
+	f := newFixture(t, 1)
+	NewBackend(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), backendStep(types.BackendRemove), types.Repairable)
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if !f.serving(t) {
+		t.Errorf("backends %v, want every backend serving once reverted", f.backends(t))
+	}
+}
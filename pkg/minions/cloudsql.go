@@ -0,0 +1,170 @@
+package minions
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+type cloudsqlDriver struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	svc      *types.Services
+	metadata *types.Metadata
+	recover  []*deauthorized
+}
+
+// deauthorized tracks the database that had its authorized networks removed with the journal entry that recorded it
+type deauthorized struct {
+	database *types.Database
+	change   string
+}
+
+// NewCloudSQL returns a minion that fails over, restarts or cuts off access to Cloud SQL databases
+func NewCloudSQL(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &cloudsqlDriver{
+		log:      log,
+		svc:      svc,
+		metadata: meta,
+	}
+}
+
+func (cd *cloudsqlDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	cd.lock.Lock()
+	defer cd.lock.Unlock()
+	action := step.Settings.CloudSQL.Action
+	if action == "" {
+		action = types.DatabaseFailover
+	}
+	databases, err := cd.filterDatabases(ctx, &step, &result)
+	if err != nil {
+		cd.log.Error("Failed to gather databases", zap.Error(err))
+		result.Error = err.Error()
+		return result
+	}
+	r := rand.New(rand.NewSource(step.Seed))
+	for _, database := range databases {
+		if r.Float32() > step.Sample {
+			result.Skip(database.Resource(), "sampling")
+			continue
+		}
+		var (
+			kind  string
+			state interface{}
+			call  func() error
+		)
+		switch action {
+		case types.DatabaseFailover:
+			if !database.HighlyAvailable {
+				result.Skip(database.Resource(), "notHighlyAvailable")
+				continue
+			}
+			kind, call = KindDatabaseFailover, func() error {
+				return cd.svc.Provider.FailoverDatabase(ctx, database.Project, database.Name, database.SettingsVersion)
+			}
+		case types.DatabaseRestart:
+			kind, call = KindDatabaseRestart, func() error {
+				return cd.svc.Provider.RestartDatabase(ctx, database.Project, database.Name)
+			}
+		case types.DatabaseDeauthorize:
+			if len(database.AuthorizedNetworks) == 0 {
+				result.Skip(database.Resource(), "noAuthorizedNetworks")
+				continue
+			}
+			kind, state, call = KindDatabaseNetworks, database.AuthorizedNetworks, func() error {
+				return cd.svc.Provider.SetDatabaseAuthorizedNetworks(ctx, database.Project, database.Name, nil)
+			}
+		}
+		if mode == types.DryRun {
+			cd.log.Info("Disrupting database", zap.String("database", database.Name), zap.String("action", action), zap.String("mode", mode))
+			result.Affect(database.Resource(), action)
+			continue
+		}
+		change, err := record(cd.svc, kind, database.Project, database.Zone, database.Name, state, call)
+		if err != nil {
+			cd.log.Error("Failed to disrupt database", zap.String("database", database.Name), zap.String("action", action), zap.Error(err))
+			result.Fail(database.Resource(), action, err)
+			continue
+		}
+		switch {
+		case kind != KindDatabaseNetworks:
+			// A failover or restart can't be undone, the database recovers by itself
+			if err := cd.svc.Journal.Final(change); err != nil {
+				cd.log.Error("Failed to journal database change", zap.String("database", database.Name), zap.Error(err))
+			}
+		case mode == types.Repairable:
+			cd.recover = append(cd.recover, &deauthorized{database: database, change: change})
+		case mode == types.Destruction:
+			finalise(cd.svc, cd.log, change)
+		}
+		cd.log.Info("Successfully disrupted database", zap.String("database", database.Name), zap.String("action", action), zap.String("zone", database.Zone))
+		result.Affect(database.Resource(), action)
+	}
+	return result
+}
+
+func (cd *cloudsqlDriver) Restore() (restored []types.Outcome) {
+	cd.lock.Lock()
+	defer cd.lock.Unlock()
+	for _, d := range cd.recover {
+		database := d.database
+		if err := cd.svc.Provider.SetDatabaseAuthorizedNetworks(context.Background(), database.Project, database.Name, database.AuthorizedNetworks); err != nil {
+			cd.log.Error("Failed to restore authorized networks", zap.String("database", database.Name), zap.Error(err))
+			restored = append(restored, types.Restore(database.Resource(), "authorize", err))
+			continue
+		}
+		if err := cd.svc.Journal.Revert(d.change); err != nil {
+			cd.log.Error("Failed to journal restored authorized networks", zap.String("database", database.Name), zap.Error(err))
+		}
+		cd.log.Info("Successfully restored authorized networks", zap.String("database", database.Name), zap.Int("networks", len(database.AuthorizedNetworks)))
+		restored = append(restored, types.Restore(database.Resource(), "authorize", nil))
+	}
+	cd.recover = nil
+	return restored
+}
+
+// filterDatabases returns the databases targeted by the step, using the same include and exclude
+// semantics as instances against the database's name, labels and the zone of its primary.
+func (cd *cloudsqlDriver) filterDatabases(ctx context.Context, step *types.Step, result *types.MinionResult) ([]*types.Database, error) {
+	include, err := compileInclude(step.Include)
+	if err != nil {
+		return nil, err
+	}
+	var databases []*types.Database
+	for _, project := range step.Projects {
+		items, err := cd.svc.Provider.ListDatabases(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			view := &types.Instance{
+				Name:    item.Name,
+				Project: item.Project,
+				Region:  item.Region,
+				Zone:    strings.TrimPrefix(item.Zone, item.Region+"-"),
+				Labels:  item.Labels,
+			}
+			if !include(view) {
+				continue
+			}
+			if isExcluded(step.Exclude, view) {
+				result.Skip(item.Resource(), "exclusion")
+				continue
+			}
+			databases = append(databases, item)
+		}
+	}
+	sort.Slice(databases, func(i, j int) bool {
+		if databases[i].Project != databases[j].Project {
+			return databases[i].Project < databases[j].Project
+		}
+		return databases[i].Name < databases[j].Name
+	})
+	return databases, nil
+}
@@ -0,0 +1,114 @@
+package minions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+func databaseStep(action string) types.Step {
+	return types.Step{Projects: []string{"p"}, Sample: 1, Settings: types.Settings{CloudSQL: types.DatabaseSettings{Action: action}}}
+}
+
+// database returns the database the fixture populated
+func (f *fixture) database(t *testing.T) *types.Database {
+	databases := f.fake.Databases()
+	if len(databases) != 1 {
+		t.Fatalf("databases %v, want the populated database", databases)
+	}
+	return databases[0]
+}
+
+func TestCloudSQLFailover(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewCloudSQL(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), databaseStep(types.DatabaseFailover), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 1 {
+		t.Fatalf("result %+v, want the database failed over", result)
+	}
+	if zone := f.database(t).Zone; zone != "us-central1-b" {
+		t.Errorf("primary is in %s, want it moved to the standby", zone)
+	}
+	// A failover can't be undone so nothing is left for a restore
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+	if restored := m.Restore(); len(restored) != 0 {
+		t.Errorf("restored %+v, want nothing to restore", restored)
+	}
+}
+
+func TestCloudSQLSkipsDatabasesWithoutStandby(t *testing.T) {
+	f := newFixture(t, 1)
+	f.fake.AddDatabase(&types.Database{Name: "single", Project: "p", Region: "us-central1", Zone: "us-central1-a"}, "us-central1-a")
+	step := databaseStep(types.DatabaseFailover)
+	step.Include.Wildcards = []string{"^single$"}
+	result := NewCloudSQL(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), step, types.Repairable)
+	if len(result.Affected) != 0 || len(result.Skipped) != 1 || result.Skipped[0].Reason != "notHighlyAvailable" {
+		t.Errorf("result %+v, want the database skipped", result)
+	}
+}
+
+func TestCloudSQLDeauthorizeRestoresNetworks(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewCloudSQL(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), databaseStep(types.DatabaseDeauthorize), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 1 {
+		t.Fatalf("result %+v, want the database deauthorized", result)
+	}
+	if networks := f.database(t).AuthorizedNetworks; len(networks) != 0 {
+		t.Errorf("networks %v are still authorized", networks)
+	}
+	if changes := f.outstanding(t); len(changes) != 1 || changes[0].Kind != KindDatabaseNetworks {
+		t.Errorf("journal has %v, want the removed networks", changes)
+	}
+	if restored := m.Restore(); len(restored) != 1 || restored[0].Error != "" {
+		t.Errorf("restored %+v, want the networks authorized", restored)
+	}
+	if networks := f.database(t).AuthorizedNetworks; len(networks) != 1 || networks[0].Value != "198.51.100.0/24" {
+		t.Errorf("networks %v once restored, want the office network", networks)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestCloudSQLDryRunChangesNothing(t *testing.T) {
+	f := newFixture(t, 1)
+	result := NewCloudSQL(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), databaseStep(types.DatabaseDeauthorize), types.DryRun)
+	if len(result.Affected) != 1 {
+		t.Errorf("result %+v, want the database reported", result)
+	}
+	if networks := f.database(t).AuthorizedNetworks; len(networks) != 1 {
+		t.Errorf("networks %v after a dry run, want the office network", networks)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has changes %v from a dry run", changes)
+	}
+}
+
+func TestCloudSQLSkipsExcluded(t *testing.T) {
+	f := newFixture(t, 1)
+	step := databaseStep(types.DatabaseRestart)
+	step.Exclude.Labels = map[string]string{"app": "demo-db"}
+	result := NewCloudSQL(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), step, types.Repairable)
+	if len(result.Affected) != 0 || len(result.Skipped) != 1 || result.Skipped[0].Reason != "exclusion" {
+		t.Errorf("result %+v, want the database excluded", result)
+	}
+}
+
+func TestRevertAuthorizesJournaledNetworks(t *testing.T) {
+	f := newFixture(t, 1)
+	NewCloudSQL(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), databaseStep(types.DatabaseDeauthorize), types.Repairable)
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if networks := f.database(t).AuthorizedNetworks; len(networks) != 1 {
+		t.Errorf("networks %v once reverted, want the office network", networks)
+	}
+}
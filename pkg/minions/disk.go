@@ -0,0 +1,155 @@
+package minions
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type diskDriver struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	svc      *types.Services
+	metadata *types.Metadata
+	recover  []*detached
+}
+
+// detached tracks the disk removed from the instance with the journal entry that recorded it
+type detached struct {
+	instance *types.Instance
+	disk     types.AttachedDisk
+	change   string
+}
+
+// deletedDisk is journaled when a disk is deleted so the snapshot taken of it can be found
+type deletedDisk struct {
+	Disk     types.AttachedDisk `json:"disk"`
+	Snapshot string             `json:"snapshot"`
+}
+
+// NewDisk returns a minion that detaches, or in destruction mode deletes, the non boot disks of instances
+func NewDisk(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &diskDriver{
+		log:      log,
+		svc:      svc,
+		metadata: meta,
+	}
+}
+
+func (dd *diskDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	dd.lock.Lock()
+	defer dd.lock.Unlock()
+	instances, err := selectInstances(ctx, dd.svc, dd.metadata, &step, &result)
+	if err != nil {
+		dd.log.Error("Failed to gather instances", zap.Error(err))
+		result.Error = err.Error()
+		return result
+	}
+	for _, instance := range instances {
+		for _, disk := range instance.Disks {
+			if disk.Boot || len(step.Settings.Disk.Devices) > 0 && !matchesAny(step.Settings.Disk.Devices, disk.DeviceName) {
+				continue
+			}
+			resource := types.Resource{Kind: "disk", Project: instance.Project, Zone: instance.CompleteZone(), Name: disk.Name()}
+			switch mode {
+			case types.DryRun:
+				dd.log.Info("Detaching disk", zap.String("instance", instance.Name), zap.String("disk", disk.Name()), zap.String("mode", mode))
+				result.Affect(resource, "detach")
+			case types.Repairable:
+				change, err := record(dd.svc, KindDiskDetach, instance.Project, instance.CompleteZone(), instance.Name, disk, func() error {
+					return dd.svc.Provider.DetachDisk(ctx, instance.Project, instance.CompleteZone(), instance.Name, disk.DeviceName)
+				})
+				if err != nil {
+					dd.log.Error("Failed to detach disk", zap.String("instance", instance.Name), zap.String("disk", disk.Name()), zap.Error(err))
+					result.Fail(resource, "detach", err)
+					continue
+				}
+				dd.log.Info("Successfully detached disk", zap.String("instance", instance.Name), zap.String("disk", disk.Name()), zap.String("device", disk.DeviceName))
+				result.Affect(resource, "detach")
+				dd.recover = append(dd.recover, &detached{instance: instance, disk: disk, change: change})
+			case types.Destruction:
+				dd.destroy(ctx, instance, disk, resource, &result)
+			}
+		}
+	}
+	return result
+}
+
+// destroy detaches the disk, snapshots it and only deletes it once the snapshot is ready.
+// The detach is journaled on its own so the disk is reattached if it could not be deleted.
+func (dd *diskDriver) destroy(ctx context.Context, instance *types.Instance, disk types.AttachedDisk, resource types.Resource, result *types.MinionResult) {
+	snapshot, err := snapshotName(disk.Name(), instance.CompleteZone())
+	if err != nil {
+		dd.log.Error("Unable to generate UUID", zap.Error(err))
+		result.Fail(resource, "delete", err)
+		return
+	}
+	detach, err := record(dd.svc, KindDiskDetach, instance.Project, instance.CompleteZone(), instance.Name, disk, func() error {
+		return dd.svc.Provider.DetachDisk(ctx, instance.Project, instance.CompleteZone(), instance.Name, disk.DeviceName)
+	})
+	if err != nil {
+		dd.log.Error("Failed to detach disk", zap.String("instance", instance.Name), zap.String("disk", disk.Name()), zap.Error(err))
+		result.Fail(resource, "delete", err)
+		return
+	}
+	state := deletedDisk{Disk: disk, Snapshot: snapshot}
+	change, err := record(dd.svc, KindDiskDelete, instance.Project, instance.CompleteZone(), instance.Name, state, func() error {
+		if err := dd.svc.Provider.SnapshotDisk(ctx, instance.Project, instance.CompleteZone(), disk.Name(), state.Snapshot); err != nil {
+			return fmt.Errorf("unable to snapshot disk before deleting it: %w", err)
+		}
+		return dd.svc.Provider.DeleteDisk(ctx, instance.Project, instance.CompleteZone(), disk.Name())
+	})
+	if err != nil {
+		dd.log.Error("Failed to delete disk, it will be reattached", zap.String("instance", instance.Name), zap.String("disk", disk.Name()), zap.Error(err))
+		result.Fail(resource, "delete", err)
+		dd.recover = append(dd.recover, &detached{instance: instance, disk: disk, change: detach})
+		return
+	}
+	// The disk no longer exists so neither change can be reverted, only recreated from the snapshot
+	for _, id := range []string{detach, change} {
+		if err := dd.svc.Journal.Final(id); err != nil {
+			dd.log.Error("Failed to journal deleted disk", zap.String("instance", instance.Name), zap.Error(err))
+		}
+	}
+	dd.log.Info("Successfully deleted disk", zap.String("instance", instance.Name), zap.String("disk", disk.Name()), zap.String("snapshot", state.Snapshot))
+	result.Affect(resource, "delete")
+}
+
+func (dd *diskDriver) Restore() (restored []types.Outcome) {
+	dd.lock.Lock()
+	defer dd.lock.Unlock()
+	for _, d := range dd.recover {
+		instance := d.instance
+		resource := types.Resource{Kind: "disk", Project: instance.Project, Zone: instance.CompleteZone(), Name: d.disk.Name()}
+		if err := dd.svc.Provider.AttachDisk(context.Background(), instance.Project, instance.CompleteZone(), instance.Name, d.disk); err != nil {
+			dd.log.Error("Failed to attach disk", zap.String("instance", instance.Name), zap.String("disk", d.disk.Name()), zap.Error(err))
+			restored = append(restored, types.Restore(resource, "attach", err))
+			continue
+		}
+		if err := dd.svc.Journal.Revert(d.change); err != nil {
+			dd.log.Error("Failed to journal attached disk", zap.String("instance", instance.Name), zap.Error(err))
+		}
+		dd.log.Info("Successfully attached disk", zap.String("instance", instance.Name), zap.String("disk", d.disk.Name()), zap.String("device", d.disk.DeviceName))
+		restored = append(restored, types.Restore(resource, "attach", nil))
+	}
+	dd.recover = nil
+	return restored
+}
+
+// snapshotName returns a snapshot name for the disk that fits within the 63 character name limit, the zone and a
+// random suffix keep it unique across disks of the same name in other zones and steps run within the same second.
+func snapshotName(disk, zone string) (string, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	if limit := 63 - len(zone) - len("-wargames-") - 8 - 1; len(disk) > limit {
+		disk = disk[:limit]
+	}
+	return fmt.Sprintf("%s-%s-wargames-%s", disk, zone, id.String()[:8]), nil
+}
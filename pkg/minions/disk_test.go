@@ -0,0 +1,181 @@
+package minions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/provider"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// attached returns the number of non boot disks attached to the instances
+func (f *fixture) attached() int {
+	count := 0
+	for _, instance := range f.fake.Instances() {
+		for _, disk := range instance.Disks {
+			if !disk.Boot {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func diskStep() types.Step {
+	return types.Step{Projects: []string{"p"}, Sample: 1}
+}
+
+func TestDiskDetachesAndRestores(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewDisk(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), diskStep(), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 2 {
+		t.Fatalf("result %+v, want every data disk detached", result)
+	}
+	if n := f.attached(); n != 0 {
+		t.Errorf("%d data disks are still attached", n)
+	}
+	if changes := f.outstanding(t); len(changes) != 2 || changes[0].Kind != KindDiskDetach {
+		t.Errorf("journal has %v, want every detach", changes)
+	}
+	if restored := m.Restore(); len(restored) != 2 || restored[0].Error != "" {
+		t.Errorf("restored %+v, want every disk attached", restored)
+	}
+	if n := f.attached(); n != 2 {
+		t.Errorf("%d data disks attached once restored, want 2", n)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestDiskDryRunChangesNothing(t *testing.T) {
+	f := newFixture(t, 1)
+	result := NewDisk(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), diskStep(), types.DryRun)
+	if len(result.Affected) != 2 {
+		t.Errorf("result %+v, want every data disk reported", result)
+	}
+	if n := f.attached(); n != 2 {
+		t.Errorf("%d data disks attached after a dry run, want 2", n)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has changes %v from a dry run", changes)
+	}
+}
+
+func TestDiskMatchesDevices(t *testing.T) {
+	f := newFixture(t, 1)
+	step := diskStep()
+	step.Settings.Disk.Devices = []string{"^logs$"}
+	if result := NewDisk(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), step, types.Repairable); len(result.Affected) != 0 {
+		t.Errorf("affected %+v, want only disks matching the devices", result.Affected)
+	}
+	if n := f.attached(); n != 2 {
+		t.Errorf("%d data disks attached, want 2", n)
+	}
+}
+
+func TestDiskDestructionSnapshotsBeforeDeleting(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewDisk(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), diskStep(), types.Destruction)
+	if len(result.Affected) != 2 || result.Affected[0].Action != "delete" {
+		t.Fatalf("result %+v, want every data disk deleted", result)
+	}
+	if snapshots := f.fake.Snapshots(); len(snapshots) != 2 {
+		t.Errorf("snapshots %v, want one for each deleted disk", snapshots)
+	}
+	if restored := m.Restore(); len(restored) != 0 {
+		t.Errorf("restored %+v, deleted disks can't be restored", restored)
+	}
+	// Deleted disks are final so later restores leave them alone
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+// unsnapshotted is a fake that is unable to snapshot disks
+type unsnapshotted struct {
+	*provider.Fake
+}
+
+func (unsnapshotted) SnapshotDisk(ctx context.Context, project, zone, disk, snapshot string) error {
+	return errors.New("snapshot quota exceeded")
+}
+
+func TestDiskDestructionReattachesWithoutSnapshot(t *testing.T) {
+	f := newFixture(t, 1)
+	f.svc.Provider = unsnapshotted{f.fake}
+	m := NewDisk(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), diskStep(), types.Destruction)
+	if len(result.Failed) != 2 || len(result.Affected) != 0 {
+		t.Fatalf("result %+v, want every delete to fail", result)
+	}
+	if changes := f.outstanding(t); len(changes) != 2 || changes[0].Kind != KindDiskDetach {
+		t.Errorf("journal has %v, want only the detached disks", changes)
+	}
+	if restored := m.Restore(); len(restored) != 2 {
+		t.Errorf("restored %+v, want the disks reattached", restored)
+	}
+	if n := f.attached(); n != 2 {
+		t.Errorf("%d disks attached once restored, want 2", n)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestRevertAttachesJournaledDisk(t *testing.T) {
+	f := newFixture(t, 1)
+	NewDisk(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), diskStep(), types.Repairable)
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := f.attached(); n != 2 {
+		t.Errorf("%d data disks attached once reverted, want 2", n)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestRevertReportsDeletedDiskOnce(t *testing.T) {
+	f := newFixture(t, 1)
+	// A deletion that was never finalised, such as when skirmish was killed straight after it
+	state := deletedDisk{Disk: types.AttachedDisk{Source: "projects/p/zones/us-central1-a/disks/data"}, Snapshot: "data-snapshot"}
+	if _, err := record(f.svc, KindDiskDelete, "p", "us-central1-a", "demo-us-central1-a-0", state, func() error { return nil }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err == nil || !strings.Contains(err.Error(), "data-snapshot") {
+			t.Errorf("revert returned %v, want the snapshot to recover from", err)
+		}
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v, want the deletion reported only once", changes)
+	}
+}
+
+func TestSnapshotNameIsUniqueAndFits(t *testing.T) {
+	disk, zone := strings.Repeat("d", 63), "northamerica-northeast1-a"
+	first, err := snapshotName(disk, zone)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := snapshotName(disk, zone)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first) > 63 || !strings.Contains(first, zone) {
+		t.Errorf("snapshot name %s is over 63 characters or missing the zone", first)
+	}
+	if first == second {
+		t.Errorf("snapshot name %s was generated twice", first)
+	}
+}
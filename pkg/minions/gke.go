@@ -0,0 +1,252 @@
+package minions
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+type gkeDriver struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	svc      *types.Services
+	metadata *types.Metadata
+	recover  []*gkeChange
+}
+
+// gkeChange tracks the cordoned node or resized node pool with the journal entry that recorded it
+type gkeChange struct {
+	kind     string
+	project  string
+	location string
+	name     string
+	resource types.Resource
+	state    gkeState
+	change   string
+}
+
+// gkeState is journaled so the node or node pool can be put back the way it was
+type gkeState struct {
+	Cluster string `json:"cluster"`
+	Size    int64  `json:"size,omitempty"`
+}
+
+// NewGKE returns a minion that drains nodes, shrinks node pools or deletes node VMs of a GKE cluster
+func NewGKE(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &gkeDriver{
+		log:      log,
+		svc:      svc,
+		metadata: meta,
+	}
+}
+
+func (gd *gkeDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	gd.lock.Lock()
+	defer gd.lock.Unlock()
+	settings := step.Settings.GKE
+	if settings.Cluster == "" || settings.Location == "" {
+		result.Error = "gke requires a cluster and location"
+		return result
+	}
+	if settings.Action == "" {
+		settings.Action = types.GKEDrain
+	}
+	if settings.ShrinkBy == 0 {
+		settings.ShrinkBy = 1
+	}
+	r := rand.New(rand.NewSource(step.Seed))
+	for _, project := range step.Projects {
+		pools, err := gd.svc.Provider.ListNodePools(ctx, project, settings.Location, settings.Cluster)
+		if err != nil {
+			gd.log.Error("Failed to gather node pools", zap.Error(err), zap.String("cluster", settings.Cluster))
+			result.Error = err.Error()
+			return result
+		}
+		sort.Slice(pools, func(i, j int) bool { return pools[i].Name < pools[j].Name })
+		for _, pool := range pools {
+			if len(settings.NodePools) > 0 && !hasAny(settings.NodePools, []string{pool.Name}) {
+				continue
+			}
+			members := make(map[*types.InstanceGroup][]*types.Instance, len(pool.Groups))
+			for _, group := range pool.Groups {
+				nodes, err := groupMembers(ctx, gd.svc, group)
+				if err != nil {
+					gd.log.Error("Failed to list nodes", zap.Error(err), zap.String("pool", pool.Name), zap.String("zone", group.Zone))
+					result.Fail(pool.Resource(), settings.Action, err)
+					continue
+				}
+				members[group] = nodes
+			}
+			if settings.Action == types.GKEResize {
+				// Shrinking the pool removes nodes from every zone so any excluded node excludes the whole pool
+				excluded := matchesAny(step.Exclude.Wildcards, pool.Name)
+				for _, nodes := range members {
+					if node := excludedMember(step.Exclude, nodes); node != "" {
+						gd.log.Info("Skipping node pool with excluded node", zap.String("pool", pool.Name), zap.String("node", node))
+						excluded = true
+						break
+					}
+				}
+				switch {
+				case excluded:
+					result.Skip(pool.Resource(), "exclusion")
+				case len(members) < len(pool.Groups):
+					// The nodes of every zone must be known before the pool can be shrunk
+				case r.Float32() > step.Sample:
+					result.Skip(pool.Resource(), "sampling")
+				default:
+					gd.resize(ctx, pool, settings, mode, &result)
+				}
+				continue
+			}
+			for _, group := range pool.Groups {
+				for _, node := range members[group] {
+					switch {
+					case isExcluded(step.Exclude, node):
+						result.Skip(nodeResource(group, node.Name), "exclusion")
+					case r.Float32() > step.Sample:
+						result.Skip(nodeResource(group, node.Name), "sampling")
+					case settings.Action == types.GKEDelete:
+						gd.delete(ctx, group, node.Name, mode, &result)
+					default:
+						gd.drain(ctx, settings, group, node.Name, mode, &result)
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// resize shrinks every zone of the node pool by the configured amount
+func (gd *gkeDriver) resize(ctx context.Context, pool *types.NodePool, settings types.GKESettings, mode string, result *types.MinionResult) {
+	size := pool.NodeCount - settings.ShrinkBy
+	if size < 0 {
+		size = 0
+	}
+	if mode == types.DryRun {
+		gd.log.Info("Resizing node pool", zap.String("pool", pool.Name), zap.Int64("size", size), zap.String("mode", mode))
+		result.Affect(pool.Resource(), types.GKEResize)
+		return
+	}
+	state := gkeState{Cluster: pool.Cluster, Size: pool.NodeCount}
+	change, err := record(gd.svc, KindNodePoolResize, pool.Project, pool.Location, pool.Name, state, func() error {
+		return gd.svc.Provider.ResizeNodePool(ctx, pool.Project, pool.Location, pool.Cluster, pool.Name, size)
+	})
+	if err != nil {
+		gd.log.Error("Failed to resize node pool", zap.String("pool", pool.Name), zap.Error(err))
+		result.Fail(pool.Resource(), types.GKEResize, err)
+		return
+	}
+	gd.log.Info("Successfully resized node pool", zap.String("pool", pool.Name), zap.Int64("from", pool.NodeCount), zap.Int64("to", size))
+	result.Affect(pool.Resource(), types.GKEResize)
+	switch mode {
+	case types.Repairable:
+		gd.recover = append(gd.recover, &gkeChange{
+			kind:     KindNodePoolResize,
+			project:  pool.Project,
+			location: pool.Location,
+			name:     pool.Name,
+			resource: pool.Resource(),
+			state:    state,
+			change:   change,
+		})
+	case types.Destruction:
+		finalise(gd.svc, gd.log, change)
+	}
+}
+
+// drain cordons the node so nothing new is scheduled to it then evicts its pods
+func (gd *gkeDriver) drain(ctx context.Context, settings types.GKESettings, group *types.InstanceGroup, node, mode string, result *types.MinionResult) {
+	resource := nodeResource(group, node)
+	if mode == types.DryRun {
+		gd.log.Info("Draining node", zap.String("node", node), zap.String("mode", mode))
+		result.Affect(resource, types.GKEDrain)
+		return
+	}
+	state := gkeState{Cluster: settings.Cluster}
+	change, err := record(gd.svc, KindNodeCordon, group.Project, settings.Location, node, state, func() error {
+		return gd.svc.Provider.SetNodeSchedulable(ctx, group.Project, settings.Location, settings.Cluster, node, false)
+	})
+	if err != nil {
+		gd.log.Error("Failed to cordon node", zap.String("node", node), zap.Error(err))
+		result.Fail(resource, "cordon", err)
+		return
+	}
+	switch mode {
+	case types.Repairable:
+		gd.recover = append(gd.recover, &gkeChange{
+			kind:     KindNodeCordon,
+			project:  group.Project,
+			location: settings.Location,
+			name:     node,
+			resource: resource,
+			state:    state,
+			change:   change,
+		})
+	case types.Destruction:
+		finalise(gd.svc, gd.log, change)
+	}
+	// Evicted pods are rescheduled by their controllers so only the cordon needs to be restored
+	if err := gd.svc.Provider.DrainNode(ctx, group.Project, settings.Location, settings.Cluster, node); err != nil {
+		gd.log.Error("Failed to drain node", zap.String("node", node), zap.Error(err))
+		result.Fail(resource, types.GKEDrain, err)
+		return
+	}
+	gd.log.Info("Successfully drained node", zap.String("node", node), zap.String("zone", group.Zone))
+	result.Affect(resource, types.GKEDrain)
+}
+
+// delete removes the node's VM, the node pool's instance group creates a replacement
+func (gd *gkeDriver) delete(ctx context.Context, group *types.InstanceGroup, node, mode string, result *types.MinionResult) {
+	resource := nodeResource(group, node)
+	if mode != types.DryRun {
+		change, err := record(gd.svc, KindInstanceDelete, group.Project, group.Zone, node, nil, func() error {
+			return gd.svc.Provider.DeleteInstance(ctx, group.Project, group.Zone, node)
+		})
+		if err != nil {
+			gd.log.Error("Failed to delete node", zap.String("node", node), zap.Error(err))
+			result.Fail(resource, types.GKEDelete, err)
+			return
+		}
+		// The group replaces the instance itself so there is nothing left outstanding
+		if err := gd.svc.Journal.Final(change); err != nil {
+			gd.log.Error("Failed to journal deleted node", zap.String("node", node), zap.Error(err))
+		}
+	}
+	gd.log.Info("Deleted node", zap.String("node", node), zap.String("group", group.Name), zap.String("mode", mode))
+	result.Affect(resource, types.GKEDelete)
+}
+
+func (gd *gkeDriver) Restore() (restored []types.Outcome) {
+	gd.lock.Lock()
+	defer gd.lock.Unlock()
+	for i := len(gd.recover) - 1; i >= 0; i-- {
+		c := gd.recover[i]
+		action := "uncordon"
+		if c.kind == KindNodePoolResize {
+			action = "resize"
+		}
+		if err := revertGKE(context.Background(), gd.svc, c.kind, c.project, c.location, c.name, c.state); err != nil {
+			gd.log.Error("Failed to restore gke change", zap.String("name", c.name), zap.String("action", action), zap.Error(err))
+			restored = append(restored, types.Restore(c.resource, action, err))
+			continue
+		}
+		if err := gd.svc.Journal.Revert(c.change); err != nil {
+			gd.log.Error("Failed to journal restored gke change", zap.String("name", c.name), zap.Error(err))
+		}
+		gd.log.Info("Successfully restored gke change", zap.String("name", c.name), zap.String("action", action))
+		restored = append(restored, types.Restore(c.resource, action, nil))
+	}
+	gd.recover = nil
+	return restored
+}
+
+func nodeResource(group *types.InstanceGroup, node string) types.Resource {
+	return types.Resource{Kind: "node", Project: group.Project, Zone: group.Zone, Name: node}
+}
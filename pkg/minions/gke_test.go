@@ -0,0 +1,176 @@
+package minions
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+func gkeStep(action string) types.Step {
+	return types.Step{Projects: []string{"p"}, Sample: 1, Settings: types.Settings{GKE: types.GKESettings{
+		Cluster:  "demo-gke",
+		Location: "us-central1",
+		Action:   action,
+	}}}
+}
+
+// poolSize returns the node count of the populated node pool
+func (f *fixture) poolSize(t *testing.T) int64 {
+	pools, err := f.fake.ListNodePools(context.Background(), "p", "us-central1", "demo-gke")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 1 {
+		t.Fatalf("pools %v, want the populated node pool", pools)
+	}
+	return pools[0].NodeCount
+}
+
+func TestGKEDrainCordonsAndRestores(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewGKE(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), gkeStep(types.GKEDrain), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 2 {
+		t.Fatalf("result %+v, want every node drained", result)
+	}
+	if cordoned := f.fake.Cordoned(); len(cordoned) != 2 {
+		t.Errorf("cordoned %v, want every node", cordoned)
+	}
+	if changes := f.outstanding(t); len(changes) != 2 || changes[0].Kind != KindNodeCordon {
+		t.Errorf("journal has %v, want every cordon", changes)
+	}
+	if restored := m.Restore(); len(restored) != 2 || restored[0].Error != "" {
+		t.Errorf("restored %+v, want every node uncordoned", restored)
+	}
+	if cordoned := f.fake.Cordoned(); len(cordoned) != 0 {
+		t.Errorf("nodes %v are still cordoned", cordoned)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestGKEResizeShrinksAndRestores(t *testing.T) {
+	f := newFixture(t, 2)
+	m := NewGKE(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), gkeStep(types.GKEResize), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 1 {
+		t.Fatalf("result %+v, want the node pool resized", result)
+	}
+	if size := f.poolSize(t); size != 1 {
+		t.Errorf("node pool has %d nodes per zone, want 1", size)
+	}
+	if changes := f.outstanding(t); len(changes) != 1 || changes[0].Kind != KindNodePoolResize {
+		t.Errorf("journal has %v, want the resize", changes)
+	}
+	m.Restore()
+	if size := f.poolSize(t); size != 2 {
+		t.Errorf("node pool has %d nodes per zone once restored, want 2", size)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestGKEDeleteLeavesNothingOutstanding(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewGKE(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), gkeStep(types.GKEDelete), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 2 {
+		t.Fatalf("result %+v, want every node deleted", result)
+	}
+	for _, instance := range f.fake.Instances() {
+		if strings.HasPrefix(instance.Name, "gke-") {
+			t.Errorf("node %s was not deleted", instance.Name)
+		}
+	}
+	// The node pool replaces the nodes itself
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+	if restored := m.Restore(); len(restored) != 0 {
+		t.Errorf("restored %+v, want nothing to restore", restored)
+	}
+}
+
+func TestGKEDryRunChangesNothing(t *testing.T) {
+	f := newFixture(t, 1)
+	result := NewGKE(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), gkeStep(types.GKEDrain), types.DryRun)
+	if len(result.Affected) != 2 {
+		t.Errorf("result %+v, want every node reported", result)
+	}
+	if cordoned := f.fake.Cordoned(); len(cordoned) != 0 {
+		t.Errorf("nodes %v were cordoned during a dry run", cordoned)
+	}
+}
+
+func TestGKESkipsExcludedNodes(t *testing.T) {
+	f := newFixture(t, 1)
+	step := gkeStep(types.GKEDrain)
+	step.Exclude.Zones = []string{"us-central1-a"}
+	m := NewGKE(zap.NewNop(), f.svc, f.metadata)
+	defer m.Restore()
+	result := m.Do(context.Background(), step, types.Repairable)
+	if len(result.Affected) != 1 || result.Affected[0].Resource.Zone != "us-central1-b" {
+		t.Errorf("affected %+v, want only the node outside the excluded zone", result.Affected)
+	}
+}
+
+func TestGKEExcludesNodesByLabel(t *testing.T) {
+	f := newFixture(t, 1)
+	pools, err := f.fake.ListNodePools(context.Background(), "p", "us-central1", "demo-gke")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exclude := types.Exclude{Labels: make(map[string]string)}
+	for _, group := range pools[0].Groups {
+		if group.Zone == "us-central1-a" {
+			// The fake labels every member of a group with the group's name
+			exclude.Labels["app"] = group.Name
+		}
+	}
+	step := gkeStep(types.GKEDrain)
+	step.Exclude = exclude
+	m := NewGKE(zap.NewNop(), f.svc, f.metadata)
+	defer m.Restore()
+	result := m.Do(context.Background(), step, types.Repairable)
+	if len(result.Affected) != 1 || result.Affected[0].Resource.Zone != "us-central1-b" {
+		t.Errorf("affected %+v, want only the node without the excluded label", result.Affected)
+	}
+	// Shrinking the pool could remove the excluded node so the whole pool is left alone
+	step.Settings.GKE.Action = types.GKEResize
+	result = NewGKE(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), step, types.Repairable)
+	if len(result.Affected) != 0 || len(result.Skipped) != 1 || result.Skipped[0].Reason != "exclusion" {
+		t.Errorf("result %+v, want the pool excluded", result)
+	}
+}
+
+func TestGKERequiresCluster(t *testing.T) {
+	f := newFixture(t, 1)
+	step := gkeStep(types.GKEDrain)
+	step.Settings.GKE.Cluster = "missing"
+	if result := NewGKE(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), step, types.Repairable); result.Error == "" {
+		t.Error("an unknown cluster should fail")
+	}
+	step.Settings.GKE.Cluster = ""
+	if result := NewGKE(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), step, types.Repairable); result.Error == "" {
+		t.Error("a step without a cluster should fail")
+	}
+}
+
+func TestRevertUncordonsJournaledNodes(t *testing.T) {
+	f := newFixture(t, 1)
+	NewGKE(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), gkeStep(types.GKEDrain), types.Repairable)
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if cordoned := f.fake.Cordoned(); len(cordoned) != 0 {
+		t.Errorf("nodes %v are still cordoned", cordoned)
+	}
+}
@@ -0,0 +1,318 @@
+package minions
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+type groupDriver struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	svc      *types.Services
+	metadata *types.Metadata
+	recover  []*changed
+}
+
+// changed tracks the group with the journal entry that recorded how to restore it
+type changed struct {
+	group  *types.InstanceGroup
+	kind   string
+	state  groupState
+	change string
+}
+
+// groupState is journaled so the group can be put back the way it was,
+// abandoned instances are deleted once the group has been resized to replace them.
+type groupState struct {
+	Size         int64           `json:"size,omitempty"`
+	UpdatePolicy json.RawMessage `json:"updatePolicy,omitempty"`
+	Instances    []string        `json:"instances,omitempty"`
+}
+
+// NewGroup returns a minion that disrupts managed instance groups
+func NewGroup(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &groupDriver{
+		log:      log,
+		svc:      svc,
+		metadata: meta,
+	}
+}
+
+func (gd *groupDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	gd.lock.Lock()
+	defer gd.lock.Unlock()
+	settings := step.Settings.Group
+	if settings.Action == "" {
+		settings.Action = types.GroupResize
+	}
+	if settings.ShrinkBy == 0 {
+		settings.ShrinkBy = 1
+	}
+	groups, err := gd.filterGroups(ctx, &step, &result)
+	if err != nil {
+		gd.log.Error("Failed to gather instance groups", zap.Error(err))
+		result.Error = err.Error()
+		return result
+	}
+	r := rand.New(rand.NewSource(step.Seed))
+	for _, group := range groups {
+		members, err := groupMembers(ctx, gd.svc, group)
+		if err != nil {
+			gd.log.Error("Failed to list instance group members", zap.String("group", group.Name), zap.Error(err))
+			result.Fail(group.Resource(), settings.Action, err)
+			continue
+		}
+		switch settings.Action {
+		case types.GroupResize, types.GroupRestart:
+			// The group chooses which instances are removed or restarted so any excluded member protects the whole group
+			if excluded := excludedMember(step.Exclude, members); excluded != "" {
+				gd.log.Info("Skipping instance group with excluded member", zap.String("group", group.Name), zap.String("instance", excluded))
+				result.Skip(group.Resource(), "exclusion")
+				continue
+			}
+			if r.Float32() > step.Sample {
+				result.Skip(group.Resource(), "sampling")
+				continue
+			}
+			gd.changeGroup(ctx, group, settings, mode, &result)
+		case types.GroupAbandon, types.GroupRecreate:
+			gd.changeInstances(ctx, r, &step, group, members, settings.Action, mode, &result)
+		}
+	}
+	return result
+}
+
+// groupMembers returns the instances managed by the group with their labels so the step's exclusions apply to them,
+// members the group has yet to create are described by their name and zone.
+func groupMembers(ctx context.Context, svc *types.Services, group *types.InstanceGroup) ([]*types.Instance, error) {
+	names, err := svc.Provider.ListGroupInstances(ctx, group.Project, group.Zone, group.Name)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := svc.Provider.ListInstances(ctx, group.Project, group.Zone)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]*types.Instance, len(instances))
+	for _, instance := range instances {
+		known[instance.Name] = instance
+	}
+	sort.Strings(names)
+	members := make([]*types.Instance, 0, len(names))
+	for _, name := range names {
+		member, exist := known[name]
+		if !exist {
+			member = &types.Instance{Name: name, Project: group.Project}
+			member.Region, member.Zone = splitZone(group.Zone)
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// excludedMember returns the name of the first member the exclusions match
+func excludedMember(exclude types.Exclude, members []*types.Instance) string {
+	for _, member := range members {
+		if isExcluded(exclude, member) {
+			return member.Name
+		}
+	}
+	return ""
+}
+
+// changeGroup resizes or restarts the entire group
+func (gd *groupDriver) changeGroup(ctx context.Context, group *types.InstanceGroup, settings types.GroupSettings, mode string, result *types.MinionResult) {
+	var (
+		kind  = KindGroupResize
+		state = groupState{Size: group.TargetSize}
+		call  = func() error {
+			size := group.TargetSize - settings.ShrinkBy
+			if size < 0 {
+				size = 0
+			}
+			return gd.svc.Provider.ResizeInstanceGroup(ctx, group.Project, group.Zone, group.Name, size)
+		}
+	)
+	if mode == types.DryRun {
+		gd.log.Info("Changing instance group", zap.String("group", group.Name), zap.String("action", settings.Action), zap.String("mode", mode))
+		result.Affect(group.Resource(), settings.Action)
+		return
+	}
+	if settings.Action == types.GroupRestart {
+		policy, err := gd.svc.Provider.GetGroupUpdatePolicy(ctx, group.Project, group.Zone, group.Name)
+		if err != nil {
+			gd.log.Error("Failed to read instance group update policy", zap.String("group", group.Name), zap.Error(err))
+			result.Fail(group.Resource(), settings.Action, err)
+			return
+		}
+		kind = KindGroupRestart
+		state = groupState{UpdatePolicy: policy}
+		call = func() error {
+			return gd.svc.Provider.RestartInstanceGroup(ctx, group.Project, group.Zone, group.Name)
+		}
+	}
+	change, err := record(gd.svc, kind, group.Project, group.Zone, group.Name, state, call)
+	if err != nil {
+		gd.log.Error("Failed to change instance group", zap.String("group", group.Name), zap.String("action", settings.Action), zap.Error(err))
+		result.Fail(group.Resource(), settings.Action, err)
+		return
+	}
+	gd.log.Info("Successfully changed instance group", zap.String("group", group.Name), zap.String("action", settings.Action), zap.String("zone", group.Zone))
+	result.Affect(group.Resource(), settings.Action)
+	switch mode {
+	case types.Repairable:
+		gd.recover = append(gd.recover, &changed{group: group, kind: kind, state: state, change: change})
+	case types.Destruction:
+		finalise(gd.svc, gd.log, change)
+	}
+}
+
+// changeInstances abandons or recreates the sampled instances of the group
+func (gd *groupDriver) changeInstances(ctx context.Context, r *rand.Rand, step *types.Step, group *types.InstanceGroup, members []*types.Instance, action, mode string, result *types.MinionResult) {
+	resource := func(name string) types.Resource {
+		return types.Resource{Kind: "instance", Project: group.Project, Zone: group.Zone, Name: name}
+	}
+	selected := make([]string, 0, len(members))
+	for _, member := range members {
+		switch {
+		case isExcluded(step.Exclude, member):
+			result.Skip(resource(member.Name), "exclusion")
+		case r.Float32() > step.Sample:
+			result.Skip(resource(member.Name), "sampling")
+		default:
+			selected = append(selected, member.Name)
+		}
+	}
+	if len(selected) == 0 {
+		return
+	}
+	var (
+		kind  = KindGroupRecreate
+		state = groupState{Instances: selected}
+		call  = func() error {
+			return gd.svc.Provider.RecreateGroupInstances(ctx, group.Project, group.Zone, group.Name, selected)
+		}
+	)
+	if action == types.GroupAbandon {
+		kind = KindGroupAbandon
+		state.Size = group.TargetSize
+		call = func() error {
+			return gd.svc.Provider.AbandonGroupInstances(ctx, group.Project, group.Zone, group.Name, selected)
+		}
+	}
+	if mode != types.DryRun {
+		change, err := record(gd.svc, kind, group.Project, group.Zone, group.Name, state, call)
+		if err != nil {
+			gd.log.Error("Failed to change instance group members", zap.String("group", group.Name), zap.String("action", action), zap.Error(err))
+			for _, name := range selected {
+				result.Fail(resource(name), action, err)
+			}
+			return
+		}
+		switch {
+		case kind == KindGroupRecreate:
+			// The group replaces the instances itself so there is nothing left outstanding
+			if err := gd.svc.Journal.Final(change); err != nil {
+				gd.log.Error("Failed to journal recreated instances", zap.String("group", group.Name), zap.Error(err))
+			}
+		case mode == types.Repairable:
+			gd.recover = append(gd.recover, &changed{group: group, kind: kind, state: state, change: change})
+		case mode == types.Destruction:
+			finalise(gd.svc, gd.log, change)
+		}
+	}
+	gd.log.Info("Changed instance group members", zap.String("group", group.Name), zap.String("action", action), zap.Strings("instances", selected), zap.String("mode", mode))
+	for _, name := range selected {
+		result.Affect(resource(name), action)
+	}
+}
+
+func (gd *groupDriver) Restore() (restored []types.Outcome) {
+	gd.lock.Lock()
+	defer gd.lock.Unlock()
+	// Restoring in reverse ensures the original size is the last one applied
+	for i := len(gd.recover) - 1; i >= 0; i-- {
+		c := gd.recover[i]
+		action, err := "resize", revertGroup(context.Background(), gd.svc, c.kind, c.group.Project, c.group.Zone, c.group.Name, c.state)
+		if c.kind == KindGroupRestart {
+			action = "update-policy"
+		}
+		if err != nil {
+			gd.log.Error("Failed to restore instance group", zap.String("group", c.group.Name), zap.Error(err))
+			restored = append(restored, types.Restore(c.group.Resource(), action, err))
+			continue
+		}
+		if err := gd.svc.Journal.Revert(c.change); err != nil {
+			gd.log.Error("Failed to journal restored instance group", zap.String("group", c.group.Name), zap.Error(err))
+		}
+		gd.log.Info("Successfully restored instance group", zap.String("group", c.group.Name), zap.String("zone", c.group.Zone))
+		restored = append(restored, types.Restore(c.group.Resource(), action, nil))
+		for _, name := range c.state.Instances {
+			gd.log.Info("Deleted abandoned instance", zap.String("group", c.group.Name), zap.String("instance", name))
+			restored = append(restored, types.Restore(types.Resource{Kind: "instance", Project: c.group.Project, Zone: c.group.Zone, Name: name}, "delete", nil))
+		}
+	}
+	gd.recover = nil
+	return restored
+}
+
+// filterGroups returns the groups targeted by the step, using the include and exclude
+// zones, regions and wildcards against the group's zone and name, the exclusions are applied to the members of each group afterwards.
+func (gd *groupDriver) filterGroups(ctx context.Context, step *types.Step, result *types.MinionResult) ([]*types.InstanceGroup, error) {
+	var groups []*types.InstanceGroup
+	for _, project := range step.Projects {
+		for _, zone := range gd.metadata.Zones {
+			items, err := gd.svc.Provider.ListInstanceGroups(ctx, project, zone)
+			if err != nil {
+				return nil, err
+			}
+			region, _ := splitZone(zone)
+			for _, item := range items {
+				include := step.Include
+				if len(include.Zones) > 0 && !inZones(zone, include.Zones) ||
+					len(include.Regions) > 0 && !inRegions(region, include.Regions) ||
+					len(include.Wildcards) > 0 && !matchesAny(include.Wildcards, item.Name) {
+					continue
+				}
+				if inZones(zone, step.Exclude.Zones) || inRegions(region, step.Exclude.Regions) ||
+					matchesAny(step.Exclude.Wildcards, item.Name) {
+					result.Skip(item.Resource(), "exclusion")
+					continue
+				}
+				groups = append(groups, item)
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Project != groups[j].Project {
+			return groups[i].Project < groups[j].Project
+		}
+		if groups[i].Zone != groups[j].Zone {
+			return groups[i].Zone < groups[j].Zone
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	return groups, nil
+}
+
+// matchesAny reports if the name matches any of the regular expressions, invalid expressions are ignored
+func matchesAny(wildcards []string, name string) bool {
+	for _, wildcard := range wildcards {
+		r, err := regexp.Compile(wildcard)
+		if err != nil {
+			continue
+		}
+		if r.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package minions
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// groups returns every instance group of project p keyed by zone
+func (f *fixture) groups(t *testing.T) map[string]*types.InstanceGroup {
+	groups := make(map[string]*types.InstanceGroup)
+	for _, zone := range testZones {
+		items, err := f.fake.ListInstanceGroups(context.Background(), "p", zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			if strings.HasPrefix(item.Name, "demo-mig-") {
+				groups[zone] = item
+			}
+		}
+	}
+	return groups
+}
+
+func groupStep(action string) types.Step {
+	// Only the demo groups are targeted as the fake also manages the node pools of its clusters with groups
+	return types.Step{Projects: []string{"p"}, Sample: 1, Include: types.Include{Wildcards: []string{"^demo-mig-"}}, Settings: types.Settings{Group: types.GroupSettings{Action: action}}}
+}
+
+func TestGroupResizeShrinksAndRestores(t *testing.T) {
+	f := newFixture(t, 2)
+	m := NewGroup(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), groupStep(types.GroupResize), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 2 {
+		t.Fatalf("result %+v, want every group resized", result)
+	}
+	for zone, group := range f.groups(t) {
+		if group.TargetSize != 1 {
+			t.Errorf("group in %s has size %d, want 1", zone, group.TargetSize)
+		}
+	}
+	if changes := f.outstanding(t); len(changes) != 2 || changes[0].Kind != KindGroupResize {
+		t.Errorf("journal has %v, want every resize", changes)
+	}
+	if restored := m.Restore(); len(restored) != 2 || restored[0].Error != "" {
+		t.Errorf("restored %+v, want every group", restored)
+	}
+	for zone, group := range f.groups(t) {
+		if group.TargetSize != 2 {
+			t.Errorf("group in %s has size %d once restored, want 2", zone, group.TargetSize)
+		}
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestGroupDryRunChangesNothing(t *testing.T) {
+	f := newFixture(t, 2)
+	m := NewGroup(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), groupStep(types.GroupAbandon), types.DryRun)
+	if len(result.Affected) != 4 {
+		t.Errorf("result %+v, want every group member reported", result)
+	}
+	for zone, group := range f.groups(t) {
+		if group.TargetSize != 2 {
+			t.Errorf("group in %s has size %d after a dry run", zone, group.TargetSize)
+		}
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has changes %v from a dry run", changes)
+	}
+}
+
+func TestGroupAbandonResizesOnRestore(t *testing.T) {
+	f := newFixture(t, 2)
+	step := groupStep(types.GroupAbandon)
+	step.Exclude.Wildcards = []string{"-0$"}
+	m := NewGroup(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), step, types.Repairable)
+	if len(result.Affected) != 2 || len(result.Skipped) != 2 {
+		t.Fatalf("result %+v, want the members not excluded abandoned", result)
+	}
+	for zone, group := range f.groups(t) {
+		members, err := f.fake.ListGroupInstances(context.Background(), "p", zone, group.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(members) != 1 || group.TargetSize != 1 {
+			t.Errorf("group in %s manages %v at size %d, want only the excluded member", zone, members, group.TargetSize)
+		}
+	}
+	// Abandoned instances are left running
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("instances %v were stopped", stopped)
+	}
+	m.Restore()
+	for zone, group := range f.groups(t) {
+		if group.TargetSize != 2 {
+			t.Errorf("group in %s has size %d once restored, want 2", zone, group.TargetSize)
+		}
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestGroupRecreateLeavesNothingOutstanding(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewGroup(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), groupStep(types.GroupRecreate), types.Repairable)
+	if len(result.Affected) != 2 {
+		t.Fatalf("result %+v, want every member recreated", result)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v, the group replaces the instances itself", changes)
+	}
+	if restored := m.Restore(); len(restored) != 0 {
+		t.Errorf("restored %+v, want nothing to restore", restored)
+	}
+}
+
+func TestGroupRestartRestoresUpdatePolicy(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewGroup(zap.NewNop(), f.svc, f.metadata)
+	if result := m.Do(context.Background(), groupStep(types.GroupRestart), types.Repairable); len(result.Affected) != 2 {
+		t.Fatalf("result %+v, want every group restarted", result)
+	}
+	for zone, group := range f.groups(t) {
+		policy := string(f.fake.GroupUpdatePolicy("p", zone, group.Name))
+		if !strings.Contains(policy, `"PROACTIVE"`) {
+			t.Errorf("group in %s has policy %s, want a proactive restart", zone, policy)
+		}
+	}
+	m.Restore()
+	for zone, group := range f.groups(t) {
+		// Every field of the policy is put back, not only the ones the restart changed
+		if policy := string(f.fake.GroupUpdatePolicy("p", zone, group.Name)); policy != `{"maxSurge":{"fixed":1},"minimalAction":"REPLACE","type":"OPPORTUNISTIC"}` {
+			t.Errorf("group in %s has policy %s once restored, want the original policy", zone, policy)
+		}
+	}
+}
+
+func TestGroupSkipsGroupWithExcludedMember(t *testing.T) {
+	f := newFixture(t, 2)
+	step := groupStep(types.GroupResize)
+	step.Exclude.Wildcards = []string{"^demo-mig-us-central1-a-1$"}
+	m := NewGroup(zap.NewNop(), f.svc, f.metadata)
+	defer m.Restore()
+	result := m.Do(context.Background(), step, types.Repairable)
+	if len(result.Affected) != 1 || result.Affected[0].Resource.Zone != "us-central1-b" {
+		t.Errorf("affected %+v, want only the group without the excluded member", result.Affected)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Reason != "exclusion" {
+		t.Errorf("skipped %+v, want the group of the excluded member", result.Skipped)
+	}
+}
+
+func TestGroupSkipsExcludedZone(t *testing.T) {
+	f := newFixture(t, 1)
+	step := groupStep(types.GroupResize)
+	step.Exclude.Zones = []string{"us-central1-a"}
+	m := NewGroup(zap.NewNop(), f.svc, f.metadata)
+	defer m.Restore()
+	result := m.Do(context.Background(), step, types.Repairable)
+	if len(result.Affected) != 1 || result.Affected[0].Resource.Zone != "us-central1-b" {
+		t.Errorf("affected %+v, want only the group outside the excluded zone", result.Affected)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Reason != "exclusion" {
+		t.Errorf("skipped %+v, want the excluded group", result.Skipped)
+	}
+}
+
+func TestRevertResizesJournaledGroup(t *testing.T) {
+	f := newFixture(t, 2)
+	NewGroup(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), groupStep(types.GroupResize), types.Repairable)
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for zone, group := range f.groups(t) {
+		if group.TargetSize != 2 {
+			t.Errorf("group in %s has size %d once reverted, want 2", zone, group.TargetSize)
+		}
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
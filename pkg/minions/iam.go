@@ -0,0 +1,304 @@
+package minions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// setIamPolicy is the permission the identity running skirmish needs to put revoked roles back
+const setIamPolicy = "resourcemanager.projects.setIamPolicy"
+
+type iamDriver struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	svc      *types.Services
+	metadata *types.Metadata
+	recover  []*revoked
+}
+
+// revoked tracks the bindings removed from the project's policy with the journal entry that recorded them
+type revoked struct {
+	project string
+	delta   []types.Binding
+	change  string
+}
+
+// NewIAM returns a minion that revokes project level roles from members to rehearse losing a permission
+func NewIAM(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &iamDriver{
+		log:      log,
+		svc:      svc,
+		metadata: meta,
+	}
+}
+
+func (id *iamDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	id.lock.Lock()
+	defer id.lock.Unlock()
+	identity, err := id.svc.Provider.Identity(ctx)
+	if err != nil {
+		id.log.Error("Unable to determine the identity skirmish is running as", zap.Error(err))
+		result.Error = err.Error()
+		return result
+	}
+	var grants []types.Grant
+	for _, g := range step.Settings.IAM.Revoke {
+		if strings.EqualFold(g.Member, identity) {
+			// Revoking the identity's own roles could leave it unable to put them back
+			id.log.Warn("Refusing to revoke a role from the identity running skirmish", zap.String("role", g.Role), zap.String("member", g.Member))
+			for _, project := range step.Projects {
+				result.Skip(g.Resource(project), "skirmishIdentity")
+			}
+			continue
+		}
+		grants = append(grants, g)
+	}
+	if len(grants) == 0 {
+		return result
+	}
+	roles := make(map[string]bool)
+	canSetPolicy := func(role string) (bool, error) {
+		if admin, exist := roles[role]; exist {
+			return admin, nil
+		}
+		permissions, err := id.svc.Provider.RolePermissions(ctx, role)
+		if err != nil {
+			return false, fmt.Errorf("unable to check the permissions of %s: %w", role, err)
+		}
+		roles[role] = hasAny(permissions, []string{setIamPolicy})
+		return roles[role], nil
+	}
+	for _, project := range step.Projects {
+		policy, err := id.svc.Provider.GetIamPolicy(ctx, project)
+		if err != nil {
+			id.log.Error("Failed to get IAM policy", zap.Error(err), zap.String("project", project))
+			result.Error = err.Error()
+			return result
+		}
+		allowed, refused, err := guardIdentity(policy, grants, identity, canSetPolicy)
+		if err != nil {
+			id.log.Error("Failed to check the identity keeps access to the IAM policy", zap.Error(err), zap.String("project", project))
+			for _, g := range grants {
+				result.Fail(g.Resource(project), "revoke", err)
+			}
+			continue
+		}
+		for _, g := range refused {
+			id.log.Warn("Refusing to revoke a role that could leave the identity running skirmish unable to restore the policy",
+				zap.String("role", g.Role), zap.String("member", g.Member), zap.String("project", project), zap.String("identity", identity))
+			result.Skip(g.Resource(project), "skirmishIdentity")
+		}
+		if len(allowed) == 0 {
+			continue
+		}
+		if mode == types.DryRun {
+			_, delta := revokeGrants(policy.Bindings, allowed)
+			id.report(&result, project, allowed, delta, mode)
+			continue
+		}
+		delta, change, err := id.revoke(ctx, policy, allowed)
+		if err != nil {
+			id.log.Error("Failed to revoke IAM roles", zap.Error(err), zap.String("project", project))
+			for _, g := range allowed {
+				result.Fail(g.Resource(project), "revoke", err)
+			}
+			continue
+		}
+		switch {
+		case len(delta) == 0:
+		case mode == types.Repairable:
+			id.recover = append(id.recover, &revoked{project: project, delta: delta, change: change})
+		case mode == types.Destruction:
+			finalise(id.svc, id.log, change)
+		}
+		id.report(&result, project, allowed, delta, mode)
+	}
+	return result
+}
+
+// revoke removes the grants from the policy, journaling the removed bindings beforehand.
+// If the policy changes before it is set, it is read again and the change retried.
+func (id *iamDriver) revoke(ctx context.Context, policy *types.Policy, grants []types.Grant) ([]types.Binding, string, error) {
+	for attempt := 0; ; attempt++ {
+		bindings, delta := revokeGrants(policy.Bindings, grants)
+		if len(delta) == 0 {
+			return nil, "", nil
+		}
+		change, err := record(id.svc, KindIAMRevoke, policy.Project, "", policy.Project, delta, func() error {
+			return id.svc.Provider.SetIamBindings(ctx, policy.Project, bindings, policy.Etag)
+		})
+		if !errors.Is(err, types.ErrConflict) || attempt == conflictRetries {
+			return delta, change, err
+		}
+		if policy, err = id.svc.Provider.GetIamPolicy(ctx, policy.Project); err != nil {
+			return nil, "", err
+		}
+	}
+}
+
+// report marks the grants found within the delta as revoked and skips those the project never granted
+func (id *iamDriver) report(result *types.MinionResult, project string, grants []types.Grant, delta []types.Binding, mode string) {
+	for _, g := range grants {
+		if !hasGrant(delta, g) {
+			result.Skip(g.Resource(project), "notGranted")
+			continue
+		}
+		id.log.Info("Revoked role", zap.String("role", g.Role), zap.String("member", g.Member), zap.String("project", project), zap.String("mode", mode))
+		result.Affect(g.Resource(project), "revoke")
+	}
+}
+
+func (id *iamDriver) Restore() (restored []types.Outcome) {
+	id.lock.Lock()
+	defer id.lock.Unlock()
+	for i := len(id.recover) - 1; i >= 0; i-- {
+		r := id.recover[i]
+		err := resetBindings(context.Background(), id.svc, r.project, r.delta)
+		for _, b := range r.delta {
+			for _, member := range b.Members {
+				restored = append(restored, types.Restore(types.Grant{Role: b.Role, Member: member}.Resource(r.project), "grant", err))
+			}
+		}
+		if err != nil {
+			id.log.Error("Failed to restore IAM roles", zap.Error(err), zap.String("project", r.project))
+			continue
+		}
+		if err := id.svc.Journal.Revert(r.change); err != nil {
+			id.log.Error("Failed to journal restored IAM roles", zap.Error(err), zap.String("project", r.project))
+		}
+		id.log.Info("Successfully restored IAM roles", zap.String("project", r.project), zap.Int("bindings", len(r.delta)))
+	}
+	id.recover = nil
+	return restored
+}
+
+// revokeGrants returns the bindings with the grants' members removed, dropping any binding left without members,
+// along with the delta of exactly what was removed from each binding.
+func revokeGrants(bindings []types.Binding, grants []types.Grant) (updated, delta []types.Binding) {
+	for _, b := range bindings {
+		var kept, removed []string
+		for _, member := range b.Members {
+			if revokes(grants, b.Role, member) {
+				removed = append(removed, member)
+				continue
+			}
+			kept = append(kept, member)
+		}
+		if len(removed) > 0 {
+			delta = append(delta, types.Binding{Role: b.Role, Members: removed, Condition: b.Condition})
+		}
+		if len(kept) > 0 {
+			b.Members = kept
+			updated = append(updated, b)
+		}
+	}
+	return updated, delta
+}
+
+// guardIdentity refuses the grants of roles that can set the project's IAM policy unless the identity running skirmish
+// keeps such a role granted directly to it, since it could also hold the revoked role through a group or domain member.
+func guardIdentity(policy *types.Policy, grants []types.Grant, identity string, canSetPolicy func(role string) (bool, error)) (allowed, refused []types.Grant, err error) {
+	updated, delta := revokeGrants(policy.Bindings, grants)
+	risky := false
+	for _, b := range delta {
+		if risky, err = canSetPolicy(b.Role); err != nil {
+			return nil, nil, err
+		}
+		if risky {
+			break
+		}
+	}
+	if !risky {
+		return grants, nil, nil
+	}
+	for _, b := range updated {
+		// A conditional binding may not apply when the policy needs to be restored
+		if len(b.Condition) > 0 || !hasIdentity(b.Members, identity) {
+			continue
+		}
+		keeps, err := canSetPolicy(b.Role)
+		if err != nil {
+			return nil, nil, err
+		}
+		if keeps {
+			return grants, nil, nil
+		}
+	}
+	for _, g := range grants {
+		admin, err := canSetPolicy(g.Role)
+		if err != nil {
+			return nil, nil, err
+		}
+		if admin {
+			refused = append(refused, g)
+			continue
+		}
+		allowed = append(allowed, g)
+	}
+	return allowed, refused, nil
+}
+
+// hasIdentity reports if the identity is one of the members, emails are compared case insensitively
+func hasIdentity(members []string, identity string) bool {
+	for _, member := range members {
+		if strings.EqualFold(member, identity) {
+			return true
+		}
+	}
+	return false
+}
+
+func revokes(grants []types.Grant, role, member string) bool {
+	for _, g := range grants {
+		if g.Role == role && g.Member == member {
+			return true
+		}
+	}
+	return false
+}
+
+func hasGrant(bindings []types.Binding, g types.Grant) bool {
+	for _, b := range bindings {
+		if b.Role == g.Role && hasAny(b.Members, []string{g.Member}) {
+			return true
+		}
+	}
+	return false
+}
+
+// grantBindings returns the bindings with the delta's members added back to the binding of the same role and condition,
+// creating the binding when it no longer exists.
+func grantBindings(bindings, delta []types.Binding) []types.Binding {
+	updated := make([]types.Binding, 0, len(bindings)+len(delta))
+	for _, b := range bindings {
+		b.Members = append([]string(nil), b.Members...)
+		updated = append(updated, b)
+	}
+	for _, d := range delta {
+		found := false
+		for i := range updated {
+			if updated[i].Role != d.Role || !bytes.Equal(updated[i].Condition, d.Condition) {
+				continue
+			}
+			found = true
+			for _, member := range d.Members {
+				if !hasAny(updated[i].Members, []string{member}) {
+					updated[i].Members = append(updated[i].Members, member)
+				}
+			}
+			break
+		}
+		if !found {
+			updated = append(updated, d)
+		}
+	}
+	return updated
+}
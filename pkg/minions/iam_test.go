@@ -0,0 +1,266 @@
+package minions
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/provider"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+const orders = "serviceAccount:orders@p.iam.gserviceaccount.com"
+
+func iamStep(grants ...types.Grant) types.Step {
+	return types.Step{Projects: []string{"p"}, Settings: types.Settings{IAM: types.IAMSettings{Revoke: grants}}}
+}
+
+// granted reports if the project's policy still grants the role to the member
+func (f *fixture) granted(t *testing.T, g types.Grant) bool {
+	for _, policy := range f.fake.Policies() {
+		if policy.Project == "p" {
+			return hasGrant(policy.Bindings, g)
+		}
+	}
+	t.Fatalf("project p has no policy")
+	return false
+}
+
+func TestIAMRevokesAndRestores(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewIAM(zap.NewNop(), f.svc, f.metadata)
+	publisher := types.Grant{Role: "roles/pubsub.publisher", Member: orders}
+	// The member isn't bound to the role so it is skipped
+	viewer := types.Grant{Role: "roles/viewer", Member: orders}
+	result := m.Do(context.Background(), iamStep(publisher, viewer), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 1 || len(result.Skipped) != 1 || result.Skipped[0].Reason != "notGranted" {
+		t.Fatalf("result %+v, want the publisher role revoked", result)
+	}
+	if f.granted(t, publisher) {
+		t.Errorf("%v is still granted", publisher)
+	}
+	if changes := f.outstanding(t); len(changes) != 1 || changes[0].Kind != KindIAMRevoke {
+		t.Errorf("journal has %v, want the revoked bindings", changes)
+	}
+	if restored := m.Restore(); len(restored) != 1 || restored[0].Error != "" {
+		t.Errorf("restored %+v, want the role granted", restored)
+	}
+	if !f.granted(t, publisher) {
+		t.Errorf("%v was not granted again", publisher)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestIAMDryRunChangesNothing(t *testing.T) {
+	f := newFixture(t, 1)
+	publisher := types.Grant{Role: "roles/pubsub.publisher", Member: orders}
+	result := NewIAM(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), iamStep(publisher), types.DryRun)
+	if len(result.Affected) != 1 {
+		t.Errorf("result %+v, want the grant reported", result)
+	}
+	if !f.granted(t, publisher) {
+		t.Errorf("%v was revoked by a dry run", publisher)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has changes %v from a dry run", changes)
+	}
+}
+
+func TestIAMRefusesOwnIdentity(t *testing.T) {
+	f := newFixture(t, 1)
+	owner := types.Grant{Role: "roles/owner", Member: provider.FakeIdentity}
+	result := NewIAM(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), iamStep(owner), types.Repairable)
+	if len(result.Affected) != 0 || len(result.Skipped) != 1 || result.Skipped[0].Reason != "skirmishIdentity" {
+		t.Errorf("result %+v, want the identity's role skipped", result)
+	}
+	if !f.granted(t, owner) {
+		t.Errorf("%v was revoked", owner)
+	}
+}
+
+func TestIAMRefusesRolesTheIdentityMayNeed(t *testing.T) {
+	f := newFixture(t, 1)
+	// The identity may only be an owner through the group
+	f.fake.AddPolicy(&types.Policy{Project: "p", Bindings: []types.Binding{
+		{Role: "roles/owner", Members: []string{"group:ops@example.com"}},
+		{Role: "roles/pubsub.publisher", Members: []string{"group:ops@example.com", provider.FakeIdentity}},
+	}})
+	owner := types.Grant{Role: "roles/owner", Member: "group:ops@example.com"}
+	publisher := types.Grant{Role: "roles/pubsub.publisher", Member: "group:ops@example.com"}
+	m := NewIAM(zap.NewNop(), f.svc, f.metadata)
+	defer m.Restore()
+	result := m.Do(context.Background(), iamStep(owner, publisher), types.Repairable)
+	if len(result.Affected) != 1 || result.Affected[0].Resource.Name != publisher.Resource("p").Name {
+		t.Errorf("affected %+v, want only the publisher role revoked", result.Affected)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Reason != "skirmishIdentity" {
+		t.Errorf("skipped %+v, want the owner role refused", result.Skipped)
+	}
+	if !f.granted(t, owner) {
+		t.Errorf("%v was revoked", owner)
+	}
+}
+
+func TestRevertGrantsJournaledBindings(t *testing.T) {
+	f := newFixture(t, 1)
+	client := types.Grant{Role: "roles/cloudsql.client", Member: orders}
+	NewIAM(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), iamStep(client), types.Repairable)
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if !f.granted(t, client) {
+		t.Errorf("%v was not granted once reverted", client)
+	}
+}
+
+func TestRevokeGrantsSplitsBindings(t *testing.T) {
+	bindings := []types.Binding{
+		{Role: "roles/owner", Members: []string{"user:admin@example.com"}},
+		{Role: "roles/pubsub.publisher", Members: []string{orders}},
+		{Role: "roles/cloudsql.client", Members: []string{orders, "serviceAccount:billing@p.iam.gserviceaccount.com"}},
+	}
+	grants := []types.Grant{
+		{Role: "roles/pubsub.publisher", Member: orders},
+		{Role: "roles/cloudsql.client", Member: orders},
+		// The member isn't bound to the role so nothing is revoked
+		{Role: "roles/owner", Member: orders},
+	}
+	updated, delta := revokeGrants(bindings, grants)
+	want := []types.Binding{
+		{Role: "roles/owner", Members: []string{"user:admin@example.com"}},
+		{Role: "roles/cloudsql.client", Members: []string{"serviceAccount:billing@p.iam.gserviceaccount.com"}},
+	}
+	if !reflect.DeepEqual(updated, want) {
+		t.Errorf("updated %v, want %v", updated, want)
+	}
+	want = []types.Binding{
+		{Role: "roles/pubsub.publisher", Members: []string{orders}},
+		{Role: "roles/cloudsql.client", Members: []string{orders}},
+	}
+	if !reflect.DeepEqual(delta, want) {
+		t.Errorf("delta %v, want %v", delta, want)
+	}
+	// Granting the delta back restores every member that was revoked
+	restored := grantBindings(updated, delta)
+	for _, g := range grants[:2] {
+		if !hasGrant(restored, g) {
+			t.Errorf("restored %v is missing %v", restored, g)
+		}
+	}
+	if len(restored) != len(bindings) {
+		t.Errorf("restored %d bindings, want %d", len(restored), len(bindings))
+	}
+}
+
+func TestGrantBindingsKeepsConditionsApart(t *testing.T) {
+	condition := []byte(`{"expression":"request.time < timestamp(\"2030-01-01T00:00:00Z\")"}`)
+	bindings := []types.Binding{{Role: "roles/owner", Members: []string{"user:admin@example.com"}}}
+	delta := []types.Binding{
+		{Role: "roles/owner", Members: []string{"user:admin@example.com", "user:ops@example.com"}},
+		{Role: "roles/owner", Members: []string{"user:temp@example.com"}, Condition: condition},
+	}
+	updated := grantBindings(bindings, delta)
+	want := []types.Binding{
+		{Role: "roles/owner", Members: []string{"user:admin@example.com", "user:ops@example.com"}},
+		{Role: "roles/owner", Members: []string{"user:temp@example.com"}, Condition: condition},
+	}
+	if !reflect.DeepEqual(updated, want) {
+		t.Errorf("updated %v, want %v", updated, want)
+	}
+	if len(bindings[0].Members) != 1 {
+		t.Errorf("bindings %v were modified, want them left as they were", bindings)
+	}
+}
+
+const identity = "serviceAccount:skirmish@p.iam.gserviceaccount.com"
+
+// canSetPolicy treats owner and projectIamAdmin as the only roles that can set the policy
+func canSetPolicy(role string) (bool, error) {
+	return role == "roles/owner" || role == "roles/resourcemanager.projectIamAdmin", nil
+}
+
+func TestGuardIdentityAllowsRolesThatCannotSetPolicy(t *testing.T) {
+	policy := &types.Policy{Bindings: []types.Binding{
+		{Role: "roles/owner", Members: []string{"group:ops@example.com"}},
+		{Role: "roles/pubsub.publisher", Members: []string{"group:ops@example.com"}},
+	}}
+	grants := []types.Grant{{Role: "roles/pubsub.publisher", Member: "group:ops@example.com"}}
+	allowed, refused, err := guardIdentity(policy, grants, identity, canSetPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(allowed) != 1 || len(refused) != 0 {
+		t.Errorf("allowed %v and refused %v, want the grant allowed", allowed, refused)
+	}
+}
+
+func TestGuardIdentityRefusesWithoutDirectGrant(t *testing.T) {
+	// The identity may only hold owner through the group being revoked
+	policy := &types.Policy{Bindings: []types.Binding{
+		{Role: "roles/owner", Members: []string{"group:ops@example.com", "user:admin@example.com"}},
+		{Role: "roles/pubsub.publisher", Members: []string{"user:admin@example.com"}},
+	}}
+	grants := []types.Grant{
+		{Role: "roles/owner", Member: "group:ops@example.com"},
+		{Role: "roles/pubsub.publisher", Member: "user:admin@example.com"},
+	}
+	allowed, refused, err := guardIdentity(policy, grants, identity, canSetPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(allowed) != 1 || allowed[0].Role != "roles/pubsub.publisher" {
+		t.Errorf("allowed %v, want only the publisher grant", allowed)
+	}
+	if len(refused) != 1 || refused[0].Role != "roles/owner" {
+		t.Errorf("refused %v, want the owner grant", refused)
+	}
+}
+
+func TestGuardIdentityAllowsWhenDirectGrantKept(t *testing.T) {
+	policy := &types.Policy{Bindings: []types.Binding{
+		{Role: "roles/owner", Members: []string{"domain:example.com"}},
+		// The identity's email differs in case from the binding but is still the same member
+		{Role: "roles/resourcemanager.projectIamAdmin", Members: []string{"serviceAccount:Skirmish@p.iam.gserviceaccount.com"}},
+	}}
+	grants := []types.Grant{{Role: "roles/owner", Member: "domain:example.com"}}
+	allowed, refused, err := guardIdentity(policy, grants, identity, canSetPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(allowed) != 1 || len(refused) != 0 {
+		t.Errorf("allowed %v and refused %v, want the grant allowed", allowed, refused)
+	}
+}
+
+func TestGuardIdentityIgnoresConditionalGrants(t *testing.T) {
+	policy := &types.Policy{Bindings: []types.Binding{
+		{Role: "roles/owner", Members: []string{"group:ops@example.com"}},
+		{Role: "roles/owner", Members: []string{identity}, Condition: []byte(`{"expression":"request.time < timestamp(\"2020-01-01T00:00:00Z\")"}`)},
+	}}
+	grants := []types.Grant{{Role: "roles/owner", Member: "group:ops@example.com"}}
+	_, refused, err := guardIdentity(policy, grants, identity, canSetPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(refused) != 1 {
+		t.Errorf("refused %v, want the owner grant refused", refused)
+	}
+}
+
+func TestGuardIdentityReportsLookupFailure(t *testing.T) {
+	policy := &types.Policy{Bindings: []types.Binding{{Role: "roles/owner", Members: []string{"group:ops@example.com"}}}}
+	failed := errors.New("permission denied")
+	_, _, err := guardIdentity(policy, []types.Grant{{Role: "roles/owner", Member: "group:ops@example.com"}}, identity, func(string) (bool, error) {
+		return false, failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("error %v, want %v", err, failed)
+	}
+}
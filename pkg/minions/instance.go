@@ -2,9 +2,7 @@ package minions
 
 import (
 	"context"
-	"math/rand"
 	"sync"
-	"time"
 
 	"github.com/MovieStoreGuy/skirmish/pkg/types"
 
@@ -16,7 +14,13 @@ type instanceDriver struct {
 	log      *zap.Logger
 	svc      *types.Services
 	metadata *types.Metadata
-	recover  []*types.Instance
+	recover  []*stopped
+}
+
+// stopped tracks the instance with the journal entry that recorded it being stopped
+type stopped struct {
+	instance *types.Instance
+	change   string
 }
 
 // NewInstance returns a minion that is configured to inspect instances
@@ -28,63 +32,68 @@ func NewInstance(log *zap.Logger, svc *types.Services, meta *types.Metadata) Min
 	}
 }
 
-func (gik *instanceDriver) Do(ctx context.Context, step types.Step, mode string) {
+func (gik *instanceDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
 	gik.lock.Lock()
 	defer gik.lock.Unlock()
 	gik.log.Info("Gathering instances data", zap.String("mode", mode))
-	instances, err := filterInstances(ctx, gik.svc, gik.metadata, &step)
+	instances, err := selectInstances(ctx, gik.svc, gik.metadata, &step, &result)
 	if err != nil {
-		return
+		gik.log.Error("Failed to gather instances", zap.Error(err))
+		result.Error = err.Error()
+		return result
 	}
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	for _, instance := range instances {
-		if r.Float32() > step.Sample {
-			gik.log.Info("Ignoring instance due to sampling", zap.String("instance", instance.Name))
-			continue
-		}
 		switch mode {
 		case types.DryRun:
 			gik.log.Info("Deleting instances", zap.String("instance", instance.Name), zap.String("mode", mode), zap.String("zone", instance.Zone), zap.String("region", instance.Region))
+			result.Affect(instance.Resource(), "stop")
 		case types.Repairable:
-			resp, err := gik.svc.Compute.Instances.Stop(instance.Project, instance.CompleteZone(), instance.Name).Do()
+			change, err := record(gik.svc, KindInstanceStop, instance.Project, instance.CompleteZone(), instance.Name, nil, func() error {
+				return gik.svc.Provider.StopInstance(ctx, instance.Project, instance.CompleteZone(), instance.Name)
+			})
 			if err != nil {
 				gik.log.Error("Failed to stop instance", zap.String("instance", instance.Name), zap.Error(err))
-				continue
-			}
-			if resp.Error != nil {
-				gik.log.Error("Response error to delete instance", zap.String("instance", instance.Name), zap.Any("response.error", resp.Error))
+				result.Fail(instance.Resource(), "stop", err)
 				continue
 			}
 			gik.log.Info("Successfully stopped instance", zap.String("instance", instance.Name), zap.String("zone", instance.Zone), zap.String("region", instance.Region))
-			gik.recover = append(gik.recover, instance)
+			result.Affect(instance.Resource(), "stop")
+			gik.recover = append(gik.recover, &stopped{instance: instance, change: change})
 		case types.Destruction:
-			resp, err := gik.svc.Compute.Instances.Delete(instance.Project, instance.CompleteZone(), instance.Name).Do()
+			change, err := record(gik.svc, KindInstanceDelete, instance.Project, instance.CompleteZone(), instance.Name, nil, func() error {
+				return gik.svc.Provider.DeleteInstance(ctx, instance.Project, instance.CompleteZone(), instance.Name)
+			})
 			if err != nil {
 				gik.log.Error("Failed to delete instance", zap.String("instance", instance.Name), zap.Error(err))
+				result.Fail(instance.Resource(), "delete", err)
 				continue
 			}
-			if resp.Error != nil {
-				gik.log.Error("Response error to delete instance", zap.String("instance", instance.Name), zap.Any("response.error", resp.Error))
-				continue
+			if err := gik.svc.Journal.Final(change); err != nil {
+				gik.log.Error("Failed to journal deleted instance", zap.String("instance", instance.Name), zap.Error(err))
 			}
 			gik.log.Info("Successfully deleted instance", zap.String("instance", instance.Name), zap.String("zone", instance.Zone), zap.String("region", instance.Region))
+			result.Affect(instance.Resource(), "delete")
 		}
 	}
+	return result
 }
 
-func (gik *instanceDriver) Restore() {
+func (gik *instanceDriver) Restore() (restored []types.Outcome) {
 	gik.lock.Lock()
 	defer gik.lock.Unlock()
-	for _, instance := range gik.recover {
-		resp, err := gik.svc.Compute.Instances.Start(instance.Project, instance.Zone, instance.Name).Do()
-		if err != nil {
+	for _, s := range gik.recover {
+		instance := s.instance
+		if err := gik.svc.Provider.StartInstance(context.Background(), instance.Project, instance.CompleteZone(), instance.Name); err != nil {
 			gik.log.Error("Failed to start instance", zap.String("instance", instance.Name), zap.Error(err))
+			restored = append(restored, types.Restore(instance.Resource(), "start", err))
 			continue
 		}
-		if resp.Error != nil {
-			gik.log.Error("Response error to start instance", zap.String("instance", instance.Name), zap.Any("response.error", resp.Error))
-			continue
+		if err := gik.svc.Journal.Revert(s.change); err != nil {
+			gik.log.Error("Failed to journal started instance", zap.String("instance", instance.Name), zap.Error(err))
 		}
 		gik.log.Info("Successfully started instance", zap.String("instance", instance.Name), zap.String("zone", instance.Zone), zap.String("region", instance.Region))
+		restored = append(restored, types.Restore(instance.Resource(), "start", nil))
 	}
+	gik.recover = nil
+	return restored
 }
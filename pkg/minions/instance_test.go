@@ -0,0 +1,167 @@
+package minions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/journal"
+	"github.com/MovieStoreGuy/skirmish/pkg/provider"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+var testZones = []string{"us-central1-a", "us-central1-b"}
+
+// demo only includes the instances populated by the fake, leaving the nodes of its clusters alone
+var demo = types.Include{Wildcards: []string{"^demo-"}}
+
+func instanceStep() types.Step {
+	return types.Step{Projects: []string{"p"}, Sample: 1, Include: demo}
+}
+
+// fixture is a fake with instances in every zone of project p along with a journal kept in a temporary file
+type fixture struct {
+	svc      *types.Services
+	fake     *provider.Fake
+	metadata *types.Metadata
+	path     string
+}
+
+func newFixture(t *testing.T, count int) *fixture {
+	fake := provider.NewFake(testZones...)
+	fake.Populate(count, "p")
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := journal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return &fixture{
+		svc:      &types.Services{Provider: fake, Journal: j},
+		fake:     fake,
+		metadata: &types.Metadata{Zones: testZones, Regions: []string{"us-central1"}},
+		path:     path,
+	}
+}
+
+// outstanding returns the journaled changes that have not been undone
+func (f *fixture) outstanding(t *testing.T) []journal.Entry {
+	file, err := os.Open(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	entries, err := journal.Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return journal.Outstanding(entries)
+}
+
+// stopped returns the names of every instance that isn't running
+func (f *fixture) stopped() []string {
+	var stopped []string
+	for _, instance := range f.fake.Instances() {
+		if instance.Status != provider.StatusRunning {
+			stopped = append(stopped, instance.Name)
+		}
+	}
+	return stopped
+}
+
+func TestInstanceStopsAndRestores(t *testing.T) {
+	f := newFixture(t, 2)
+	m := NewInstance(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), instanceStep(), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 8 {
+		t.Fatalf("result %+v, want every instance stopped", result)
+	}
+	if stopped := f.stopped(); len(stopped) != 8 {
+		t.Errorf("stopped %v, want every instance", stopped)
+	}
+	if changes := f.outstanding(t); len(changes) != 8 || changes[0].Kind != KindInstanceStop {
+		t.Errorf("journal has %v, want every stop", changes)
+	}
+	restored := m.Restore()
+	if len(restored) != 8 {
+		t.Errorf("restored %+v, want every instance", restored)
+	}
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("instances %v are still stopped", stopped)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestInstanceDryRunChangesNothing(t *testing.T) {
+	f := newFixture(t, 2)
+	result := NewInstance(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), instanceStep(), types.DryRun)
+	if len(result.Affected) != 8 {
+		t.Errorf("result %+v, want every instance reported", result)
+	}
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("instances %v were stopped during a dry run", stopped)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has changes %v from a dry run", changes)
+	}
+}
+
+func TestInstanceDestructionDeletes(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewInstance(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), instanceStep(), types.Destruction)
+	if len(result.Affected) != 4 {
+		t.Errorf("result %+v, want every instance deleted", result)
+	}
+	for _, instance := range f.fake.Instances() {
+		if strings.HasPrefix(instance.Name, "demo-") {
+			t.Errorf("instance %s was not deleted", instance.Name)
+		}
+	}
+	if restored := m.Restore(); len(restored) != 0 {
+		t.Errorf("restored %+v, deleted instances can't be restored", restored)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestInstanceSkipsExcluded(t *testing.T) {
+	f := newFixture(t, 2)
+	step := instanceStep()
+	step.Exclude.Wildcards = []string{"-0$"}
+	m := NewInstance(zap.NewNop(), f.svc, f.metadata)
+	defer m.Restore()
+	result := m.Do(context.Background(), step, types.Repairable)
+	if len(result.Affected) != 4 {
+		t.Errorf("result %+v, want only the instances not excluded stopped", result)
+	}
+	for _, name := range f.stopped() {
+		if strings.HasSuffix(name, "-0") {
+			t.Errorf("excluded instance %s was stopped", name)
+		}
+	}
+}
+
+func TestRevertStartsJournaledInstance(t *testing.T) {
+	f := newFixture(t, 1)
+	// The minion is never restored as if the process had been killed
+	NewInstance(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), instanceStep(), types.Repairable)
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("instances %v are still stopped", stopped)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
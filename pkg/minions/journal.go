@@ -0,0 +1,341 @@
+package minions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/journal"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// KindInstanceStop is journaled when an instance is stopped
+	KindInstanceStop = "instance.stop"
+	// KindInstanceDelete is journaled when an instance is deleted, it can not be reverted
+	KindInstanceDelete = "instance.delete"
+	// KindInstanceLabels is journaled when an instance labels are changed
+	KindInstanceLabels = "instance.labels"
+	// KindInstanceTags is journaled when an instance network tags are changed
+	KindInstanceTags = "instance.tags"
+	// KindInstanceScheduling is journaled when an instance maintenance scheduling is changed
+	KindInstanceScheduling = "instance.scheduling"
+	// KindInstanceMaintenance is journaled when a maintenance event is triggered, there is nothing to revert
+	KindInstanceMaintenance = "instance.maintenance"
+	// KindFirewallInsert is journaled when a firewall is created
+	KindFirewallInsert = "firewall.insert"
+	// KindDatabaseFailover is journaled when a database fails over to its standby, there is nothing to revert
+	KindDatabaseFailover = "cloudsql.failover"
+	// KindDatabaseRestart is journaled when a database is restarted, there is nothing to revert
+	KindDatabaseRestart = "cloudsql.restart"
+	// KindDatabaseNetworks is journaled when the authorized networks of a database are removed
+	KindDatabaseNetworks = "cloudsql.networks"
+	// KindNodeCordon is journaled when a GKE node is cordoned
+	KindNodeCordon = "gke.cordon"
+	// KindNodePoolResize is journaled when a GKE node pool is shrunk
+	KindNodePoolResize = "gke.resize"
+	// KindBackendUpdate is journaled when backends are removed from or drained in a backend service
+	KindBackendUpdate = "backend.update"
+	// KindIAMRevoke is journaled when roles are revoked from members of a project, the state is the removed bindings
+	KindIAMRevoke = "iam.revoke"
+	// KindAgentFault is journaled when the agent running on an instance injects a fault
+	KindAgentFault = "agent.fault"
+	// KindRouteInsert is journaled when a route is created
+	KindRouteInsert = "route.insert"
+	// KindDiskDetach is journaled when a disk is detached from an instance
+	KindDiskDetach = "disk.detach"
+	// KindDiskDelete is journaled when a disk is deleted, it can only be recovered from its snapshot
+	KindDiskDelete = "disk.delete"
+	// KindGroupResize is journaled when an instance group is shrunk
+	KindGroupResize = "group.resize"
+	// KindGroupAbandon is journaled when instances are abandoned by their group
+	KindGroupAbandon = "group.abandon"
+	// KindGroupRecreate is journaled when a group recreates instances, there is nothing to revert
+	KindGroupRecreate = "group.recreate"
+	// KindGroupRestart is journaled when a group has its update policy changed to perform a rolling restart
+	KindGroupRestart = "group.restart"
+)
+
+// record will journal the change before and after the call is made
+// so that it can be reverted even if the process does not survive.
+// The returned id references the change within the journal.
+func record(svc *types.Services, kind, project, zone, name string, state interface{}, call func() error) (string, error) {
+	id, err := svc.Journal.Begin(kind, project, zone, name, state)
+	if err != nil {
+		return "", err
+	}
+	if err = call(); err != nil {
+		// An unfinished change could still be applied so it is left outstanding to be reverted
+		if !errors.Is(err, types.ErrUnfinished) {
+			svc.Journal.Fail(id, err)
+		}
+		return id, err
+	}
+	return id, svc.Journal.Commit(id)
+}
+
+// finalise marks a change made in destruction mode as final, destruction makes no promise of bringing
+// anything back so the change is left out of every restore rather than reverted by the restore command.
+func finalise(svc *types.Services, log *zap.Logger, change string) {
+	if err := svc.Journal.Final(change); err != nil {
+		log.Error("Failed to journal final change", zap.String("change", change), zap.Error(err))
+	}
+}
+
+// Revert will undo a change that was read back from the journal
+func Revert(ctx context.Context, svc *types.Services, e journal.Entry) error {
+	var err error
+	switch e.Kind {
+	case KindInstanceStop:
+		err = svc.Provider.StartInstance(ctx, e.Project, e.Zone, e.Name)
+	case KindInstanceLabels:
+		var labels map[string]string
+		if err = json.Unmarshal(e.State, &labels); err != nil {
+			return err
+		}
+		err = resetLabels(ctx, svc, e.Project, e.Zone, e.Name, labels)
+	case KindInstanceTags:
+		var tags []string
+		if err = json.Unmarshal(e.State, &tags); err != nil {
+			return err
+		}
+		err = resetTags(ctx, svc, e.Project, e.Zone, e.Name, tags)
+	case KindInstanceScheduling:
+		var scheduling types.Scheduling
+		if err = json.Unmarshal(e.State, &scheduling); err != nil {
+			return err
+		}
+		err = resetScheduling(ctx, svc, e.Project, e.Zone, e.Name, scheduling)
+	case KindInstanceMaintenance, KindDatabaseFailover, KindDatabaseRestart:
+	case KindDatabaseNetworks:
+		var networks []types.AuthorizedNetwork
+		if err = json.Unmarshal(e.State, &networks); err != nil {
+			return err
+		}
+		err = svc.Provider.SetDatabaseAuthorizedNetworks(ctx, e.Project, e.Name, networks)
+	case KindFirewallInsert:
+		err = svc.Provider.DeleteFirewall(ctx, e.Project, e.Name)
+	case KindRouteInsert:
+		err = svc.Provider.DeleteRoute(ctx, e.Project, e.Name)
+	case KindBackendUpdate:
+		var backends []types.Backend
+		if err = json.Unmarshal(e.State, &backends); err != nil {
+			return err
+		}
+		err = resetBackends(ctx, svc, e.Project, e.Zone, e.Name, backends)
+	case KindAgentFault:
+		var state agentState
+		if err = json.Unmarshal(e.State, &state); err != nil {
+			return err
+		}
+		err = revertFault(ctx, state)
+	case KindIAMRevoke:
+		var delta []types.Binding
+		if err = json.Unmarshal(e.State, &delta); err != nil {
+			return err
+		}
+		err = resetBindings(ctx, svc, e.Project, delta)
+	case KindGroupResize, KindGroupAbandon, KindGroupRecreate, KindGroupRestart:
+		var state groupState
+		if len(e.State) > 0 {
+			if err = json.Unmarshal(e.State, &state); err != nil {
+				return err
+			}
+		}
+		err = revertGroup(ctx, svc, e.Kind, e.Project, e.Zone, e.Name, state)
+	case KindNodeCordon, KindNodePoolResize:
+		var state gkeState
+		if err = json.Unmarshal(e.State, &state); err != nil {
+			return err
+		}
+		err = revertGKE(ctx, svc, e.Kind, e.Project, e.Zone, e.Name, state)
+	case KindDiskDetach:
+		var disk types.AttachedDisk
+		if err = json.Unmarshal(e.State, &disk); err != nil {
+			return err
+		}
+		err = svc.Provider.AttachDisk(ctx, e.Project, e.Zone, e.Name, disk)
+	case KindDiskDelete:
+		var state deletedDisk
+		if err = json.Unmarshal(e.State, &state); err != nil {
+			return err
+		}
+		// Destroyed resources are reported once and then left out of every later restore
+		svc.Journal.Final(e.Id)
+		return fmt.Errorf("unable to revert %s of %s as it was destroyed, it can be recreated from snapshot %s", e.Kind, state.Disk.Name(), state.Snapshot)
+	case KindInstanceDelete:
+		svc.Journal.Final(e.Id)
+		return fmt.Errorf("unable to revert %s of %s as it was destroyed", e.Kind, e.Name)
+	default:
+		return fmt.Errorf("unknown journal kind %s", e.Kind)
+	}
+	if err != nil {
+		return err
+	}
+	return svc.Journal.Revert(e.Id)
+}
+
+// Offline reports if changes of the kind are reverted without the cloud provider,
+// either because there is nothing to revert or the agent on the instance reverts them.
+func Offline(kind string) bool {
+	switch kind {
+	case KindAgentFault, KindInstanceDelete, KindDiskDelete, KindInstanceMaintenance, KindDatabaseFailover, KindDatabaseRestart, KindGroupRecreate:
+		return true
+	}
+	return false
+}
+
+// revertGKE uncordons the node or puts the node pool back to its original size,
+// the location of the cluster is journaled as the zone.
+func revertGKE(ctx context.Context, svc *types.Services, kind, project, location, name string, state gkeState) error {
+	if kind == KindNodePoolResize {
+		return svc.Provider.ResizeNodePool(ctx, project, location, state.Cluster, name, state.Size)
+	}
+	return svc.Provider.SetNodeSchedulable(ctx, project, location, state.Cluster, name, true)
+}
+
+// resetBackends writes the original configuration of the backends back into the service, replacing
+// the backend of the same group or adding it back when it was removed, the region is journaled as the zone.
+func resetBackends(ctx context.Context, svc *types.Services, project, region, name string, original []types.Backend) error {
+	for attempt := 0; ; attempt++ {
+		service, err := svc.Provider.GetBackendService(ctx, project, region, name)
+		if err != nil {
+			return err
+		}
+		configs := make(map[string]types.Backend, len(original))
+		for _, backend := range original {
+			configs[backend.Group] = backend
+		}
+		backends := make([]types.Backend, 0, len(service.Backends)+len(original))
+		for _, backend := range service.Backends {
+			if o, exist := configs[backend.Group]; exist {
+				backend = o
+				delete(configs, backend.Group)
+			}
+			backends = append(backends, backend)
+		}
+		for _, backend := range original {
+			if _, missing := configs[backend.Group]; missing {
+				backends = append(backends, backend)
+			}
+		}
+		err = svc.Provider.UpdateBackendService(ctx, project, region, name, backends, service.Fingerprint)
+		if !errors.Is(err, types.ErrConflict) || attempt == conflictRetries {
+			return err
+		}
+	}
+}
+
+// resetBindings grants the revoked bindings again using the current etag of the policy,
+// retrying when the policy changes before it is set.
+func resetBindings(ctx context.Context, svc *types.Services, project string, delta []types.Binding) error {
+	for attempt := 0; ; attempt++ {
+		policy, err := svc.Provider.GetIamPolicy(ctx, project)
+		if err != nil {
+			return err
+		}
+		err = svc.Provider.SetIamBindings(ctx, project, grantBindings(policy.Bindings, delta), policy.Etag)
+		if !errors.Is(err, types.ErrConflict) || attempt == conflictRetries {
+			return err
+		}
+	}
+}
+
+// resetLabels will fetch the current fingerprint of the instance so the
+// original labels can be put back regardless of what changed since.
+func resetLabels(ctx context.Context, svc *types.Services, project, zone, name string, labels map[string]string) error {
+	current, err := svc.Provider.GetInstance(ctx, project, zone, name)
+	if err != nil {
+		return err
+	}
+	return svc.Provider.SetInstanceLabels(ctx, project, zone, name, labels, current.LabelFingerprint)
+}
+
+// conflictRetries is how many times a fingerprinted change is retried after the resource changed underneath it
+const conflictRetries = 3
+
+// tagInstance adds the network tag to the instance, journaling the exact tags it had beforehand.
+// If the tags change before they are set, the instance is read again and the change retried,
+// the instance is updated with the original tags the change was made against.
+func tagInstance(ctx context.Context, svc *types.Services, instance *types.Instance, tag string) (string, error) {
+	current := instance
+	for attempt := 0; ; attempt++ {
+		tags := append([]string(nil), current.Tags...)
+		if !hasAny(tags, []string{tag}) {
+			tags = append(tags, tag)
+		}
+		change, err := record(svc, KindInstanceTags, current.Project, current.CompleteZone(), current.Name, current.Tags, func() error {
+			return svc.Provider.SetInstanceTags(ctx, current.Project, current.CompleteZone(), current.Name, tags, current.TagFingerprint)
+		})
+		if !errors.Is(err, types.ErrConflict) || attempt == conflictRetries {
+			instance.Tags, instance.TagFingerprint = current.Tags, current.TagFingerprint
+			return change, err
+		}
+		if current, err = svc.Provider.GetInstance(ctx, instance.Project, instance.CompleteZone(), instance.Name); err != nil {
+			return "", err
+		}
+	}
+}
+
+// resetTags will fetch the current fingerprint of the instance so the
+// original network tags can be put back regardless of what changed since.
+func resetTags(ctx context.Context, svc *types.Services, project, zone, name string, tags []string) error {
+	for attempt := 0; ; attempt++ {
+		current, err := svc.Provider.GetInstance(ctx, project, zone, name)
+		if err != nil {
+			return err
+		}
+		err = svc.Provider.SetInstanceTags(ctx, project, zone, name, tags, current.TagFingerprint)
+		if !errors.Is(err, types.ErrConflict) || attempt == conflictRetries {
+			return err
+		}
+	}
+}
+
+// revertGroup puts the group back to the journaled state, abandoned instances can not be
+// added back into the group so the group is resized to replace them and they are deleted instead.
+func revertGroup(ctx context.Context, svc *types.Services, kind, project, zone, name string, state groupState) error {
+	switch kind {
+	case KindGroupResize:
+		return svc.Provider.ResizeInstanceGroup(ctx, project, zone, name, state.Size)
+	case KindGroupRestart:
+		return svc.Provider.SetGroupUpdatePolicy(ctx, project, zone, name, state.UpdatePolicy)
+	case KindGroupAbandon:
+		if err := svc.Provider.ResizeInstanceGroup(ctx, project, zone, name, state.Size); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	var failed []string
+	for _, instance := range state.Instances {
+		err := svc.Provider.DeleteInstance(ctx, project, zone, instance)
+		if err != nil && !errors.Is(err, types.ErrNotFound) {
+			failed = append(failed, fmt.Sprintf("%s: %v", instance, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to delete abandoned instances %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// resetScheduling puts back the original maintenance behaviour,
+// starting the instance if the maintenance event terminated it.
+func resetScheduling(ctx context.Context, svc *types.Services, project, zone, name string, scheduling types.Scheduling) error {
+	if err := svc.Provider.SetInstanceScheduling(ctx, project, zone, name, scheduling); err != nil {
+		return err
+	}
+	current, err := svc.Provider.GetInstance(ctx, project, zone, name)
+	if err != nil {
+		return err
+	}
+	if current.Status != "TERMINATED" {
+		return nil
+	}
+	return svc.Provider.StartInstance(ctx, project, zone, name)
+}
@@ -0,0 +1,40 @@
+package minions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+func TestDestructionLeavesNothingToRestore(t *testing.T) {
+	for name, c := range map[string]struct {
+		minion func(*zap.Logger, *types.Services, *types.Metadata) Minion
+		step   types.Step
+	}{
+		"zone":     {NewZoneOutage, zoneStep(types.ZoneOutageSettings{Zones: []string{"us-central1-a"}, Deny: true})},
+		"route":    {NewRoute, routeStep("10.0.0.0/8")},
+		"group":    {NewGroup, groupStep(types.GroupResize)},
+		"gke":      {NewGKE, gkeStep(types.GKEDrain)},
+		"backend":  {NewBackend, backendStep(types.BackendDrain)},
+		"cloudsql": {NewCloudSQL, databaseStep(types.DatabaseDeauthorize)},
+		"iam":      {NewIAM, iamStep(types.Grant{Role: "roles/pubsub.publisher", Member: orders})},
+		"network":  {NewNetworkDriver("INGRESS"), networkStep()},
+	} {
+		f := newFixture(t, 1)
+		m := c.minion(zap.NewNop(), f.svc, f.metadata)
+		result := m.Do(context.Background(), c.step, types.Destruction)
+		if result.Error != "" || len(result.Failed) != 0 || len(result.Affected) == 0 {
+			t.Errorf("%s: result %+v, want the change made", name, result)
+			continue
+		}
+		if changes := f.outstanding(t); len(changes) != 0 {
+			t.Errorf("%s: journal has outstanding changes %v, want every change final", name, changes)
+		}
+		if restored := m.Restore(); len(restored) != 0 {
+			t.Errorf("%s: restored %+v, want nothing brought back", name, restored)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package minions
+
+import (
+	"context"
+	"sync"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+type maintenanceDriver struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	svc      *types.Services
+	metadata *types.Metadata
+	recover  []*stopped
+}
+
+// NewMaintenance returns a minion that triggers host maintenance events on instances
+func NewMaintenance(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &maintenanceDriver{
+		log:      log,
+		svc:      svc,
+		metadata: meta,
+	}
+}
+
+func (md *maintenanceDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	md.lock.Lock()
+	defer md.lock.Unlock()
+	instances, err := selectInstances(ctx, md.svc, md.metadata, &step, &result)
+	if err != nil {
+		md.log.Error("Failed to gather instances", zap.Error(err))
+		result.Error = err.Error()
+		return result
+	}
+	terminate := types.Scheduling{OnHostMaintenance: types.MaintenanceTerminate, AutomaticRestart: false}
+	for _, instance := range instances {
+		if mode == types.DryRun {
+			md.log.Info("Simulating maintenance event", zap.String("instance", instance.Name), zap.String("mode", mode))
+			result.Affect(instance.Resource(), "maintenance")
+			continue
+		}
+		if step.Settings.Maintenance.Terminate && instance.Scheduling != terminate {
+			change, err := record(md.svc, KindInstanceScheduling, instance.Project, instance.CompleteZone(), instance.Name, instance.Scheduling, func() error {
+				return md.svc.Provider.SetInstanceScheduling(ctx, instance.Project, instance.CompleteZone(), instance.Name, terminate)
+			})
+			if err != nil {
+				md.log.Error("Failed to set instance scheduling", zap.String("instance", instance.Name), zap.Error(err))
+				result.Fail(instance.Resource(), "scheduling", err)
+				continue
+			}
+			// The scheduling is restored in every mode since only the maintenance event is destructive
+			md.recover = append(md.recover, &stopped{instance: instance, change: change})
+			result.Affect(instance.Resource(), "scheduling")
+		}
+		change, err := record(md.svc, KindInstanceMaintenance, instance.Project, instance.CompleteZone(), instance.Name, nil, func() error {
+			return md.svc.Provider.SimulateMaintenanceEvent(ctx, instance.Project, instance.CompleteZone(), instance.Name)
+		})
+		if err != nil {
+			md.log.Error("Failed to simulate maintenance event", zap.String("instance", instance.Name), zap.Error(err))
+			result.Fail(instance.Resource(), "maintenance", err)
+			continue
+		}
+		// The event can't be undone, only the scheduling that was changed for it
+		if err := md.svc.Journal.Final(change); err != nil {
+			md.log.Error("Failed to journal maintenance event", zap.String("instance", instance.Name), zap.Error(err))
+		}
+		md.log.Info("Successfully simulated maintenance event", zap.String("instance", instance.Name), zap.String("zone", instance.CompleteZone()))
+		result.Affect(instance.Resource(), "maintenance")
+	}
+	return result
+}
+
+func (md *maintenanceDriver) Restore() (restored []types.Outcome) {
+	md.lock.Lock()
+	defer md.lock.Unlock()
+	for _, s := range md.recover {
+		instance := s.instance
+		if err := resetScheduling(context.Background(), md.svc, instance.Project, instance.CompleteZone(), instance.Name, instance.Scheduling); err != nil {
+			md.log.Error("Failed to reset instance scheduling", zap.String("instance", instance.Name), zap.Error(err))
+			restored = append(restored, types.Restore(instance.Resource(), "scheduling", err))
+			continue
+		}
+		if err := md.svc.Journal.Revert(s.change); err != nil {
+			md.log.Error("Failed to journal reset scheduling", zap.String("instance", instance.Name), zap.Error(err))
+		}
+		md.log.Info("Successfully reset instance scheduling", zap.String("instance", instance.Name), zap.String("onHostMaintenance", instance.Scheduling.OnHostMaintenance))
+		restored = append(restored, types.Restore(instance.Resource(), "scheduling", nil))
+	}
+	md.recover = nil
+	return restored
+}
@@ -0,0 +1,119 @@
+package minions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// terminating returns the names of every instance that doesn't live migrate during maintenance
+func (f *fixture) terminating() []string {
+	var terminating []string
+	for _, instance := range f.fake.Instances() {
+		if instance.Scheduling.OnHostMaintenance != types.MaintenanceMigrate || !instance.Scheduling.AutomaticRestart {
+			terminating = append(terminating, instance.Name)
+		}
+	}
+	return terminating
+}
+
+func maintenanceStep(terminate bool) types.Step {
+	return types.Step{Projects: []string{"p"}, Sample: 1, Include: demo, Settings: types.Settings{Maintenance: types.MaintenanceSettings{Terminate: terminate}}}
+}
+
+func TestMaintenanceMigratesWithoutOutstandingChanges(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewMaintenance(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), maintenanceStep(false), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 4 {
+		t.Fatalf("result %+v, want a maintenance event on every instance", result)
+	}
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("instances %v were stopped, want them migrated", stopped)
+	}
+	// The event itself can't be undone so nothing is left for a restore
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+	if restored := m.Restore(); len(restored) != 0 {
+		t.Errorf("restored %+v, want nothing to restore", restored)
+	}
+}
+
+func TestMaintenanceTerminateRestoresScheduling(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewMaintenance(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), maintenanceStep(true), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 8 {
+		t.Fatalf("result %+v, want the scheduling changed and an event on every instance", result)
+	}
+	if stopped := f.stopped(); len(stopped) != 4 {
+		t.Errorf("stopped %v, want every instance terminated by the event", stopped)
+	}
+	if changes := f.outstanding(t); len(changes) != 4 || changes[0].Kind != KindInstanceScheduling {
+		t.Errorf("journal has %v, want every scheduling change", changes)
+	}
+	if restored := m.Restore(); len(restored) != 4 {
+		t.Errorf("restored %+v, want every instance", restored)
+	}
+	if terminating := f.terminating(); len(terminating) != 0 {
+		t.Errorf("instances %v terminate during maintenance once restored", terminating)
+	}
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("instances %v are still stopped", stopped)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestMaintenanceDestructionRestoresScheduling(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewMaintenance(zap.NewNop(), f.svc, f.metadata)
+	if result := m.Do(context.Background(), maintenanceStep(true), types.Destruction); len(result.Affected) != 8 {
+		t.Fatalf("result %+v, want the scheduling changed and an event on every instance", result)
+	}
+	// Only the maintenance event is destructive so the scheduling changed for it is still put back
+	if restored := m.Restore(); len(restored) != 4 {
+		t.Errorf("restored %+v, want every instance", restored)
+	}
+	if terminating := f.terminating(); len(terminating) != 0 {
+		t.Errorf("instances %v terminate during maintenance once restored", terminating)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestMaintenanceDryRunChangesNothing(t *testing.T) {
+	f := newFixture(t, 1)
+	result := NewMaintenance(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), maintenanceStep(true), types.DryRun)
+	if len(result.Affected) != 4 {
+		t.Errorf("result %+v, want every instance reported", result)
+	}
+	if terminating := f.terminating(); len(terminating) != 0 {
+		t.Errorf("instances %v terminate during maintenance after a dry run", terminating)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has changes %v from a dry run", changes)
+	}
+}
+
+func TestRevertResetsJournaledScheduling(t *testing.T) {
+	f := newFixture(t, 1)
+	NewMaintenance(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), maintenanceStep(true), types.Repairable)
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if terminating := f.terminating(); len(terminating) != 0 {
+		t.Errorf("instances %v terminate during maintenance once reverted", terminating)
+	}
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("instances %v are still stopped", stopped)
+	}
+}
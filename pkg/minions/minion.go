@@ -12,9 +12,11 @@ import (
 type Minion interface {
 
 	// Do will execute the minions job against the given step at the correct mode
-	Do(ctx context.Context, step types.Step, mode string)
+	// and report back on every resource it affected, skipped or failed on.
+	Do(ctx context.Context, step types.Step, mode string) types.MinionResult
 
 	// Restore ensures all the resources are put back in place
 	// it should only be able to execute if the do function has finished
-	Restore()
+	// and reports the outcome of each resource it restored.
+	Restore() []types.Outcome
 }
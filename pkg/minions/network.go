@@ -2,15 +2,13 @@ package minions
 
 import (
 	"context"
-	"math/rand"
+	"strings"
 	"sync"
-	"time"
 
 	"github.com/MovieStoreGuy/skirmish/pkg/types"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"google.golang.org/api/compute/v1"
 )
 
 type networkDriver struct {
@@ -21,119 +19,144 @@ type networkDriver struct {
 	svc      *types.Services
 	metadata *types.Metadata
 
+	// firewalls tracks the instances tagged within each project
 	firewalls map[string]*types.Firewall
+	// rules are the created firewall rules in the order they were inserted
+	rules []*types.Firewall
+	// changes maps the tracked instances and firewalls to their journal entry
+	changes map[interface{}]string
 }
 
 // NewNetworkDriver returns a function that will ensure that the correct INGRESS or EGRESS type is used.
 func NewNetworkDriver(flow string) func(*zap.Logger, *types.Services, *types.Metadata) Minion {
 	return func(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
 		return &networkDriver{
-			flow:     flow,
-			log:      log,
-			svc:      svc,
-			metadata: meta,
+			flow:      flow,
+			log:       log,
+			svc:       svc,
+			metadata:  meta,
+			firewalls: make(map[string]*types.Firewall),
+			changes:   make(map[interface{}]string),
 		}
 	}
 }
 
-func (nd *networkDriver) Do(ctx context.Context, step types.Step, mode string) {
+func (nd *networkDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
 	nd.lock.Lock()
 	defer nd.lock.Unlock()
-	instances, err := filterInstances(ctx, nd.svc, nd.metadata, &step)
+	instances, err := selectInstances(ctx, nd.svc, nd.metadata, &step, &result)
 	if err != nil {
-		return
+		nd.log.Error("Failed to gather instances", zap.Error(err))
+		result.Error = err.Error()
+		return result
 	}
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	id, err := uuid.NewRandom()
 	if err != nil {
 		nd.log.Error("Unable to generate UUID", zap.Error(err))
-		return
+		result.Error = err.Error()
+		return result
 	}
-	// Applying labels to affected instances to not block the entire network
+	// Tagging affected instances so the firewalls only apply to them and not the entire network
+	tag := wargamesTag(id.String())
 	for _, instance := range instances {
-		if r.Float32() > step.Sample {
-			nd.log.Info("Ignoring instance due to sampling", zap.String("instance", instance.Name))
-			continue
-		}
 		switch mode {
 		case types.Repairable, types.Destruction:
-			req := &compute.InstancesSetLabelsRequest{
-				Labels: instance.Labels,
-			}
-			req.Labels[id.String()] = "wargames"
-			resp, err := nd.svc.Compute.Instances.SetLabels(instance.Project, instance.CompleteZone(), instance.Name, req).Do()
+			change, err := tagInstance(ctx, nd.svc, instance, tag)
 			if err != nil {
-				nd.log.Error("Unable to apply label changes", zap.Error(err), zap.String("instance", instance.Name))
+				nd.log.Error("Unable to apply tag changes", zap.Error(err), zap.String("instance", instance.Name))
+				result.Fail(instance.Resource(), "tag", err)
 				continue
 			}
-			if resp.Error != nil {
-				nd.log.Error("Response returned a failure", zap.Any("error", resp.Error), zap.String("instance", instance.Name))
-				continue
+			if mode == types.Destruction {
+				finalise(nd.svc, nd.log, change)
+			} else {
+				firewall := nd.firewall(instance.Project)
+				firewall.Tag = tag
+				firewall.Instances = append(firewall.Instances, instance)
+				nd.changes[instance] = change
 			}
-			firewall, exist := nd.firewalls[instance.Project]
-			if !exist {
-				f := &types.Firewall{}
-				nd.firewalls[instance.Project], firewall = f, f
-			}
-			firewall.Labels[id.String()] = "wargames"
-			firewall.Instances = append(firewall.Instances, instance)
 			fallthrough
 		case types.DryRun:
 			nd.log.Info("Applying network rules against", zap.String("instance", instance.Name), zap.String("flow", nd.flow))
+			result.Affect(instance.Resource(), "tag")
 		}
 	}
 	gen := nameAppendor()
 	for _, conf := range step.Settings.Network {
-		f := nd.firewalls[conf.Project]
-		switch mode {
-		case types.Repairable, types.Destruction:
-			fw := buildFirewall(conf.Deny, gen("wargames", nd.flow), conf.Network, nd.flow, id.String())
-			resp, err := nd.svc.Compute.Firewalls.Insert(conf.Project, fw).Do()
-			if err != nil {
-				nd.log.Error("Unable to create firewall", zap.Error(err), zap.String("project", conf.Project))
-				continue
-			}
-			if resp.Error != nil {
-				nd.log.Error("Response returned a failure", zap.Any("error", resp.Error))
-				continue
+		for _, fw := range buildFirewalls(conf, gen, "wargames-"+strings.ToLower(nd.flow)+"-"+id.String()[:8], nd.flow, id.String()) {
+			f := &types.Firewall{Project: conf.Project, Name: fw.Name, Tag: tag}
+			switch mode {
+			case types.Repairable, types.Destruction:
+				change, err := record(nd.svc, KindFirewallInsert, conf.Project, "", fw.Name, nil, func() error {
+					return nd.svc.Provider.InsertFirewall(ctx, conf.Project, fw)
+				})
+				if err != nil {
+					nd.log.Error("Unable to create firewall", zap.Error(err), zap.String("project", conf.Project))
+					result.Fail(f.Resource(), "insert", err)
+					continue
+				}
+				if mode == types.Destruction {
+					finalise(nd.svc, nd.log, change)
+				} else {
+					nd.rules = append(nd.rules, f)
+					nd.changes[f] = change
+				}
+				fallthrough
+			case types.DryRun:
+				nd.log.Info("Applied firewall changes",
+					zap.String("name", fw.Name),
+					zap.String("tag", tag),
+					zap.Int64("priority", fw.Priority),
+					zap.Bool("allow", len(fw.Allowed) > 0),
+					zap.String("network", conf.Network),
+					zap.String("project", conf.Project))
+				result.Affect(f.Resource(), "insert")
 			}
-			f.Name = fw.Name
-			fallthrough
-		case types.DryRun:
-			nd.log.Info("Applied firewall changes",
-				zap.String("name", f.Name),
-				zap.String("label", id.String()),
-				zap.String("network", conf.Network),
-				zap.String("project", conf.Project))
 		}
 	}
+	return result
 }
 
-func (nd *networkDriver) Restore() {
+func (nd *networkDriver) Restore() (restored []types.Outcome) {
 	nd.lock.Lock()
 	defer nd.lock.Unlock()
-	for project, firewall := range nd.firewalls {
+	// Removing the rules before the tags so the instances are never left with the tag and no rules
+	for _, firewall := range nd.rules {
+		if err := nd.svc.Provider.DeleteFirewall(context.Background(), firewall.Project, firewall.Name); err != nil {
+			nd.log.Error("Failed to remove firewall", zap.Error(err), zap.String("project", firewall.Project), zap.String("firewall", firewall.Name))
+			restored = append(restored, types.Restore(firewall.Resource(), "delete", err))
+			continue
+		}
+		if err := nd.svc.Journal.Revert(nd.changes[firewall]); err != nil {
+			nd.log.Error("Failed to journal removed firewall", zap.Error(err), zap.String("firewall", firewall.Name))
+		}
+		nd.log.Info("Removed firewall", zap.String("project", firewall.Project), zap.String("firewall", firewall.Name))
+		restored = append(restored, types.Restore(firewall.Resource(), "delete", nil))
+	}
+	for _, firewall := range nd.firewalls {
 		for _, instance := range firewall.Instances {
-			resp, err := nd.svc.Compute.Instances.SetLabels(instance.Project, instance.Zone, instance.Name, &compute.InstancesSetLabelsRequest{
-				Labels: instance.Labels,
-			}).Do()
-			if err != nil {
-				nd.log.Error("Failed to reset labels", zap.Error(err), zap.String("instance", instance.Name), zap.String("project", instance.Project))
+			if err := resetTags(context.Background(), nd.svc, instance.Project, instance.CompleteZone(), instance.Name, instance.Tags); err != nil {
+				nd.log.Error("Failed to reset tags", zap.Error(err), zap.String("instance", instance.Name), zap.String("project", instance.Project))
+				restored = append(restored, types.Restore(instance.Resource(), "tag", err))
 				continue
 			}
-			if resp.Error != nil {
-				nd.log.Error("Response failed to reset labels", zap.Any("resp.error", resp.Error), zap.String("instance", instance.Name), zap.String("project", instance.Project))
+			if err := nd.svc.Journal.Revert(nd.changes[instance]); err != nil {
+				nd.log.Error("Failed to journal reset tags", zap.Error(err), zap.String("instance", instance.Name))
 			}
+			restored = append(restored, types.Restore(instance.Resource(), "tag", nil))
 		}
-		resp, err := nd.svc.Compute.Firewalls.Delete(project, firewall.Name).Do()
-		if err != nil {
-			nd.log.Error("Failed to remove firewall", zap.Error(err), zap.String("project", project), zap.String("firewall", firewall.Name))
-			continue
-		}
-		if resp.Error != nil {
-			nd.log.Error("Response failed to delete firewall", zap.Any("resp.error", resp.Error), zap.String("project", project), zap.String("firewall", firewall.Name))
-			continue
-		}
-		nd.log.Info("Removed firewall", zap.String("project", project), zap.String("firewall", firewall.Name))
 	}
+	nd.firewalls, nd.rules = make(map[string]*types.Firewall), nil
+	nd.changes = make(map[interface{}]string)
+	return restored
+}
+
+// firewall returns the tracked firewall for the project, creating it if required
+func (nd *networkDriver) firewall(project string) *types.Firewall {
+	f, exist := nd.firewalls[project]
+	if !exist {
+		f = &types.Firewall{Project: project}
+		nd.firewalls[project] = f
+	}
+	return f
 }
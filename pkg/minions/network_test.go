@@ -0,0 +1,161 @@
+package minions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+func networkStep() types.Step {
+	return types.Step{Projects: []string{"p"}, Sample: 1, Include: demo, Settings: types.Settings{Network: []types.NetworkSettings{{
+		Project: "p",
+		Network: "global/networks/default",
+		Deny:    []types.Deny{{Protocol: "tcp", Ports: []string{"80"}}},
+	}}}}
+}
+
+func TestNetworkTagsAndRestoresInstances(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewNetworkDriver("INGRESS")(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), networkStep(), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 5 {
+		t.Fatalf("result %+v, want every instance tagged and the firewall inserted", result)
+	}
+	if tagged := f.tagged(); len(tagged) != 4 {
+		t.Errorf("tagged %v, want every instance", tagged)
+	}
+	if firewalls := f.fake.Firewalls(); len(firewalls) != 1 {
+		t.Errorf("firewalls %v, want the one denying traffic", firewalls)
+	}
+	if changes := f.outstanding(t); len(changes) != 5 {
+		t.Errorf("journal has %v, want every tag and the firewall", changes)
+	}
+	if restored := m.Restore(); len(restored) != 5 {
+		t.Errorf("restored %+v, want every change", restored)
+	}
+	if tagged := f.tagged(); len(tagged) != 0 {
+		t.Errorf("instances %v are still tagged", tagged)
+	}
+	if firewalls := f.fake.Firewalls(); len(firewalls) != 0 {
+		t.Errorf("firewalls %v were not removed", firewalls)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestNetworkDryRunChangesNothing(t *testing.T) {
+	f := newFixture(t, 1)
+	result := NewNetworkDriver("EGRESS")(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), networkStep(), types.DryRun)
+	if len(result.Affected) != 5 {
+		t.Errorf("result %+v, want everything reported", result)
+	}
+	if tagged := f.tagged(); len(tagged) != 0 {
+		t.Errorf("instances %v were tagged during a dry run", tagged)
+	}
+	if firewalls := f.fake.Firewalls(); len(firewalls) != 0 {
+		t.Errorf("firewalls %v were created during a dry run", firewalls)
+	}
+}
+
+func TestTagInstanceRetriesConflict(t *testing.T) {
+	f := newFixture(t, 1)
+	ctx := context.Background()
+	instance, err := f.fake.GetInstance(ctx, "p", "us-central1-a", "demo-us-central1-a-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The tags change after the instance was listed so its fingerprint is stale
+	if err := f.fake.SetInstanceTags(ctx, "p", "us-central1-a", instance.Name, []string{"web"}, instance.TagFingerprint); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tagInstance(ctx, f.svc, instance, "wargames-test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	current, err := f.fake.GetInstance(ctx, "p", "us-central1-a", instance.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current.Tags) != 2 || current.Tags[0] != "web" || current.Tags[1] != "wargames-test" {
+		t.Errorf("tags %v, want the tag added to the current tags", current.Tags)
+	}
+	// Restoring has to put back the tags the change was made against
+	if len(instance.Tags) != 1 || instance.Tags[0] != "web" {
+		t.Errorf("tracked tags %v, want the tags before the change", instance.Tags)
+	}
+}
+
+func TestBuildFirewalls(t *testing.T) {
+	conf := types.NetworkSettings{
+		Project: "p",
+		Network: "default",
+		Deny:    []types.Deny{{Protocol: "all"}},
+		Allow:   []types.Allow{{Ranges: []string{"10.0.0.0/8"}, Ports: []string{"53"}}},
+	}
+	rules := buildFirewalls(conf, nameAppendor(), "wargames", "INGRESS", "id")
+	if len(rules) != 2 {
+		t.Fatalf("rules %+v, want the deny and allow rules", rules)
+	}
+	deny, allow := rules[0], rules[1]
+	if deny.Priority != 1 || len(deny.SourceTags) != 1 || deny.TargetTags[0] != wargamesTag("id") {
+		t.Errorf("deny rule %+v, want the tagged instances denied from each other", deny)
+	}
+	if allow.Priority != 0 || allow.Allowed[0].Protocol != "all" || allow.SourceRanges[0] != "10.0.0.0/8" {
+		t.Errorf("allow rule %+v, want the range let through ahead of the deny rule", allow)
+	}
+	if deny.Name == allow.Name {
+		t.Errorf("rules share the name %s", deny.Name)
+	}
+
+	priority := int64(100)
+	conf.Allow, conf.Priority, conf.TargetServiceAccounts = nil, &priority, []string{"web@p.iam.gserviceaccount.com"}
+	egress := buildFirewalls(conf, nameAppendor(), "wargames", "EGRESS", "id")[0]
+	if egress.Priority != 100 || len(egress.SourceTags) != 0 || len(egress.TargetTags) != 0 {
+		t.Errorf("egress rule %+v, want only the service accounts targeted", egress)
+	}
+	// A priority of zero is the highest priority rather than unset
+	priority = 0
+	if highest := buildFirewalls(conf, nameAppendor(), "wargames", "EGRESS", "id")[0]; highest.Priority != 0 {
+		t.Errorf("rule has priority %d, want the priority of zero kept", highest.Priority)
+	}
+	ingress := buildFirewalls(conf, nameAppendor(), "wargames", "INGRESS", "id")[0]
+	if len(ingress.SourceRanges) != 1 || ingress.SourceRanges[0] != "0.0.0.0/0" {
+		t.Errorf("ingress rule %+v, want every source denied", ingress)
+	}
+}
+
+func TestNetworkCreatesAllowRules(t *testing.T) {
+	f := newFixture(t, 1)
+	step := networkStep()
+	step.Settings.Network[0].Allow = []types.Allow{{Ranges: []string{"10.0.0.0/8"}}}
+	m := NewNetworkDriver("EGRESS")(zap.NewNop(), f.svc, f.metadata)
+	if result := m.Do(context.Background(), step, types.Repairable); len(result.Failed) != 0 {
+		t.Fatalf("failed %+v, want the rules created", result.Failed)
+	}
+	if firewalls := f.fake.Firewalls(); len(firewalls) != 2 {
+		t.Errorf("firewalls %v, want the deny and allow rules", firewalls)
+	}
+	m.Restore()
+	if firewalls := f.fake.Firewalls(); len(firewalls) != 0 {
+		t.Errorf("firewalls %v were not removed", firewalls)
+	}
+}
+
+func TestRevertResetsJournaledTags(t *testing.T) {
+	f := newFixture(t, 1)
+	NewNetworkDriver("INGRESS")(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), networkStep(), types.Repairable)
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if tagged := f.tagged(); len(tagged) != 0 {
+		t.Errorf("instances %v are still tagged", tagged)
+	}
+	if firewalls := f.fake.Firewalls(); len(firewalls) != 0 {
+		t.Errorf("firewalls %v were not removed", firewalls)
+	}
+}
@@ -0,0 +1,81 @@
+package minions
+
+import (
+	"context"
+	"sync"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/proxy"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+type proxyDriver struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	svc      *types.Services
+	metadata *types.Metadata
+	recover  []*degraded
+}
+
+// degraded tracks the handle of the proxy that had faults applied
+type degraded struct {
+	settings types.ProxySettings
+	handle   *proxy.Handle
+}
+
+// NewProxy returns a minion that degrades connections through an embedded TCP proxy so dependencies
+// can fail without needing access to a cloud.
+func NewProxy(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &proxyDriver{
+		log:      log,
+		svc:      svc,
+		metadata: meta,
+	}
+}
+
+func (pd *proxyDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+	for _, settings := range step.Settings.Proxy {
+		if mode == types.DryRun {
+			pd.log.Info("Degrading proxy", zap.String("listen", settings.Listen), zap.String("upstream", settings.Upstream), zap.String("mode", mode))
+			result.Affect(settings.Resource(), "degrade")
+			continue
+		}
+		h, err := proxy.Open(pd.log, settings.Listen, settings.Upstream)
+		if err != nil {
+			pd.log.Error("Unable to start proxy", zap.Error(err), zap.String("listen", settings.Listen), zap.String("upstream", settings.Upstream))
+			result.Fail(settings.Resource(), "degrade", err)
+			continue
+		}
+		if err := h.SetFaults(settings.ProxyFaults); err != nil {
+			pd.log.Error("Unable to degrade proxy", zap.Error(err), zap.String("listen", settings.Listen), zap.String("upstream", settings.Upstream))
+			result.Fail(settings.Resource(), "degrade", err)
+			h.Close()
+			continue
+		}
+		// The proxy lives within this process so there is nothing to journal, the faults end with it.
+		// It is released in every mode so the proxy stops listening once no step needs it.
+		pd.recover = append(pd.recover, &degraded{settings: settings, handle: h})
+		pd.log.Info("Successfully degraded proxy", zap.String("listen", settings.Listen), zap.String("upstream", settings.Upstream))
+		result.Affect(settings.Resource(), "degrade")
+	}
+	return result
+}
+
+func (pd *proxyDriver) Restore() (restored []types.Outcome) {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+	for _, d := range pd.recover {
+		if err := d.handle.Close(); err != nil {
+			pd.log.Error("Failed to close proxy", zap.Error(err), zap.String("listen", d.settings.Listen), zap.String("upstream", d.settings.Upstream))
+			restored = append(restored, types.Restore(d.settings.Resource(), "clear", err))
+			continue
+		}
+		pd.log.Info("Successfully cleared proxy faults", zap.String("listen", d.settings.Listen), zap.String("upstream", d.settings.Upstream))
+		restored = append(restored, types.Restore(d.settings.Resource(), "clear", nil))
+	}
+	pd.recover = nil
+	return restored
+}
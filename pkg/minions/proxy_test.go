@@ -0,0 +1,75 @@
+package minions
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+func TestProxyRejectsConcurrentStepsAndCloses(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := l.Addr().String()
+	l.Close()
+	step := types.Step{Settings: types.Settings{Proxy: []types.ProxySettings{{
+		Listen:      listen,
+		Upstream:    upstream.Addr().String(),
+		ProxyFaults: types.ProxyFaults{Latency: time.Second},
+	}}}}
+	first, second := NewProxy(zap.NewNop(), &types.Services{}, &types.Metadata{}), NewProxy(zap.NewNop(), &types.Services{}, &types.Metadata{})
+
+	if result := first.Do(context.Background(), step, types.Repairable); len(result.Affected) != 1 {
+		t.Fatalf("first step %+v, want the proxy degraded", result)
+	}
+	if result := second.Do(context.Background(), step, types.Repairable); len(result.Failed) != 1 {
+		t.Errorf("second step %+v, want degrading the same proxy to fail", result)
+	}
+	if restored := second.Restore(); len(restored) != 0 {
+		t.Errorf("second step restored %+v, want nothing", restored)
+	}
+	if conn, err := net.Dial("tcp", listen); err != nil {
+		t.Errorf("proxy should still listen for the first step: %v", err)
+	} else {
+		conn.Close()
+	}
+	if restored := first.Restore(); len(restored) != 1 || restored[0].Error != "" {
+		t.Errorf("first step restored %+v, want the proxy cleared", restored)
+	}
+	if conn, err := net.Dial("tcp", listen); err == nil {
+		conn.Close()
+		t.Error("proxy should stop listening once no step uses it")
+	}
+}
+
+func TestProxyDryRunStartsNothing(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := l.Addr().String()
+	l.Close()
+	step := types.Step{Settings: types.Settings{Proxy: []types.ProxySettings{{Listen: listen, Upstream: "127.0.0.1:1"}}}}
+	m := NewProxy(zap.NewNop(), &types.Services{}, &types.Metadata{})
+	if result := m.Do(context.Background(), step, types.DryRun); len(result.Affected) != 1 {
+		t.Errorf("result %+v, want the proxy reported", result)
+	}
+	if conn, err := net.Dial("tcp", listen); err == nil {
+		conn.Close()
+		t.Error("a dry run should not start the proxy")
+	}
+	if restored := m.Restore(); len(restored) != 0 {
+		t.Errorf("restored %+v, want nothing from a dry run", restored)
+	}
+}
@@ -0,0 +1,106 @@
+package minions
+
+import (
+	"context"
+	"sync"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type routeDriver struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	svc      *types.Services
+	metadata *types.Metadata
+	recover  []*inserted
+}
+
+// inserted tracks the created route with the journal entry that recorded it
+type inserted struct {
+	project string
+	route   *types.Route
+	change  string
+}
+
+// NewRoute returns a minion that blackholes ranges for an entire network by inserting routes that drop the traffic
+func NewRoute(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &routeDriver{
+		log:      log,
+		svc:      svc,
+		metadata: meta,
+	}
+}
+
+func (rd *routeDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+	settings := step.Settings.Route
+	if settings.Network == "" {
+		settings.Network = "global/networks/default"
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		rd.log.Error("Unable to generate UUID", zap.Error(err))
+		result.Error = err.Error()
+		return result
+	}
+	gen := nameAppendor()
+	for _, project := range step.Projects {
+		for _, cidr := range settings.Ranges {
+			route := &types.Route{
+				Name:            gen("wargames-route", id.String()[:8]),
+				Network:         settings.Network,
+				DestRange:       cidr,
+				Priority:        settings.Priority,
+				NextHopIp:       settings.NextHopIp,
+				NextHopInstance: settings.NextHopInstance,
+			}
+			if mode != types.DryRun {
+				change, err := record(rd.svc, KindRouteInsert, project, "", route.Name, nil, func() error {
+					return rd.svc.Provider.InsertRoute(ctx, project, route)
+				})
+				if err != nil {
+					rd.log.Error("Unable to create route", zap.Error(err), zap.String("project", project), zap.String("range", cidr))
+					result.Fail(route.Resource(project), "insert", err)
+					continue
+				}
+				switch mode {
+				case types.Repairable:
+					rd.recover = append(rd.recover, &inserted{project: project, route: route, change: change})
+				case types.Destruction:
+					finalise(rd.svc, rd.log, change)
+				}
+			}
+			rd.log.Info("Blackholed range",
+				zap.String("name", route.Name),
+				zap.String("range", cidr),
+				zap.String("network", settings.Network),
+				zap.String("project", project),
+				zap.String("mode", mode))
+			result.Affect(route.Resource(project), "insert")
+		}
+	}
+	return result
+}
+
+func (rd *routeDriver) Restore() (restored []types.Outcome) {
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+	for _, r := range rd.recover {
+		if err := rd.svc.Provider.DeleteRoute(context.Background(), r.project, r.route.Name); err != nil {
+			rd.log.Error("Failed to remove route", zap.Error(err), zap.String("project", r.project), zap.String("route", r.route.Name))
+			restored = append(restored, types.Restore(r.route.Resource(r.project), "delete", err))
+			continue
+		}
+		if err := rd.svc.Journal.Revert(r.change); err != nil {
+			rd.log.Error("Failed to journal removed route", zap.Error(err), zap.String("route", r.route.Name))
+		}
+		rd.log.Info("Successfully removed route", zap.String("project", r.project), zap.String("route", r.route.Name))
+		restored = append(restored, types.Restore(r.route.Resource(r.project), "delete", nil))
+	}
+	rd.recover = nil
+	return restored
+}
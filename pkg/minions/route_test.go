@@ -0,0 +1,79 @@
+package minions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+func routeStep(ranges ...string) types.Step {
+	return types.Step{Projects: []string{"p"}, Settings: types.Settings{Route: types.RouteSettings{Ranges: ranges, NextHopIp: "10.255.255.254"}}}
+}
+
+func TestRouteInsertsAndRestores(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewRoute(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), routeStep("10.0.0.0/8", "192.168.0.0/16"), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 2 {
+		t.Fatalf("result %+v, want a route for each range", result)
+	}
+	if routes := f.fake.Routes(); len(routes) != 2 || routes[0] == routes[1] {
+		t.Errorf("routes %v, want a uniquely named route for each range", routes)
+	}
+	if changes := f.outstanding(t); len(changes) != 2 || changes[0].Kind != KindRouteInsert {
+		t.Errorf("journal has %v, want every route", changes)
+	}
+	if restored := m.Restore(); len(restored) != 2 || restored[0].Error != "" {
+		t.Errorf("restored %+v, want every route removed", restored)
+	}
+	if routes := f.fake.Routes(); len(routes) != 0 {
+		t.Errorf("routes %v were not removed", routes)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestRouteDryRunChangesNothing(t *testing.T) {
+	f := newFixture(t, 1)
+	result := NewRoute(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), routeStep("10.0.0.0/8"), types.DryRun)
+	if len(result.Affected) != 1 {
+		t.Errorf("result %+v, want the route reported", result)
+	}
+	if routes := f.fake.Routes(); len(routes) != 0 {
+		t.Errorf("routes %v were created during a dry run", routes)
+	}
+}
+
+func TestRouteReportsFailedInsert(t *testing.T) {
+	f := newFixture(t, 1)
+	step := routeStep("10.0.0.0/8")
+	step.Settings.Route.NextHopIp = ""
+	m := NewRoute(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), step, types.Repairable)
+	if len(result.Failed) != 1 || len(result.Affected) != 0 {
+		t.Errorf("result %+v, want the insert reported as failed", result)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v for a failed insert", changes)
+	}
+	if restored := m.Restore(); len(restored) != 0 {
+		t.Errorf("restored %+v, want nothing to restore", restored)
+	}
+}
+
+func TestRevertDeletesJournaledRoute(t *testing.T) {
+	f := newFixture(t, 1)
+	NewRoute(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), routeStep("10.0.0.0/8"), types.Repairable)
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if routes := f.fake.Routes(); len(routes) != 0 {
+		t.Errorf("routes %v were not removed", routes)
+	}
+}
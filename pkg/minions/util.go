@@ -2,91 +2,322 @@ package minions
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"path"
+	"math/rand"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/MovieStoreGuy/skirmish/pkg/types"
-
-	"google.golang.org/api/compute/v1"
 )
 
-// filterInstances will return a list of instances that aren't part of the exclusion list.
-func filterInstances(ctx context.Context, svc *types.Services, metadata *types.Metadata, step *types.Step) ([]*types.Instance, error) {
-	instances := make([]*types.Instance, 0)
+// filterInstances will return a list of instances that are included by the step and aren't part of the exclusion list
+// along with every instance listed, any excluded instances are recorded as skipped against the result.
+func filterInstances(ctx context.Context, svc *types.Services, metadata *types.Metadata, step *types.Step, result *types.MinionResult) (instances, listed []*types.Instance, err error) {
+	include, err := compileInclude(step.Include)
+	if err != nil {
+		return nil, nil, err
+	}
 	for _, project := range step.Projects {
 		for _, zone := range metadata.Zones {
-			err := svc.Compute.Instances.List(project, zone).Pages(ctx, func(list *compute.InstanceList) error {
-				for _, item := range list.Items {
-					excluded := false
-					for _, wildcard := range step.Exclude.Wildcards {
-						r, err := regexp.Compile(wildcard)
-						if err != nil {
-							continue
-						}
-						if r.MatchString(item.Name) {
-							excluded = true
-						}
-					}
-					combined := strings.Split(path.Base(item.Zone), "-")
-					if len(combined) != 3 {
-						return errors.New("incorrect amount of values to use")
-					}
-					region, zone := combined[0]+"-"+combined[1], combined[2]
-					for _, exclude := range step.Exclude.Zones {
-						if strings.HasPrefix(zone, exclude) {
-							excluded = true
-						}
-					}
-					for _, exclude := range step.Exclude.Regions {
-						if strings.HasPrefix(region, exclude) {
-							excluded = true
-						}
-					}
-					for entry, key := range step.Exclude.Labels {
-						if value, ok := item.Labels[entry]; ok && value == key {
-							excluded = true
-						}
-					}
-					if !excluded {
-						instances = append(instances, &types.Instance{
-							Id:      item.Id,
-							Name:    item.Name,
-							Zone:    zone,
-							Region:  region,
-							Project: project,
-							Labels:  item.Labels,
-						})
-					}
-				}
-				return nil
-			})
+			items, err := svc.Provider.ListInstances(ctx, project, zone)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
+			}
+			listed = append(listed, items...)
+			for _, item := range items {
+				if !include(item) {
+					continue
+				}
+				if isExcluded(step.Exclude, item) {
+					result.Skip(item.Resource(), "exclusion")
+					continue
+				}
+				instances = append(instances, item)
+			}
+		}
+	}
+	return instances, listed, nil
+}
+
+// isExcluded reports if the instance matches any of the exclusions
+func isExcluded(exclude types.Exclude, item *types.Instance) bool {
+	excluded := false
+	for _, wildcard := range exclude.Wildcards {
+		r, err := regexp.Compile(wildcard)
+		if err != nil {
+			continue
+		}
+		if r.MatchString(item.Name) {
+			excluded = true
+		}
+	}
+	if inZones(item.CompleteZone(), exclude.Zones) || inRegions(item.Region, exclude.Regions) {
+		excluded = true
+	}
+	for entry, key := range exclude.Labels {
+		if value, ok := item.Labels[entry]; ok && value == key {
+			excluded = true
+		}
+	}
+	return excluded
+}
+
+// compileInclude returns a matcher for the include selector, instances that don't match
+// are not considered part of the step at all.
+func compileInclude(include types.Include) (func(*types.Instance) bool, error) {
+	wildcards := make([]*regexp.Regexp, 0, len(include.Wildcards))
+	for _, wildcard := range include.Wildcards {
+		r, err := regexp.Compile(wildcard)
+		if err != nil {
+			return nil, err
+		}
+		wildcards = append(wildcards, r)
+	}
+	return func(item *types.Instance) bool {
+		for key, value := range include.Labels {
+			if v, ok := item.Labels[key]; !ok || v != value {
+				return false
+			}
+		}
+		for _, e := range include.Expressions {
+			if !e.Matches(item.Labels) {
+				return false
+			}
+		}
+		if len(include.Zones) > 0 && !inZones(item.CompleteZone(), include.Zones) {
+			return false
+		}
+		if len(include.Regions) > 0 && !inRegions(item.Region, include.Regions) {
+			return false
+		}
+		if len(include.Tags) > 0 && !hasAny(item.Tags, include.Tags) {
+			return false
+		}
+		if len(wildcards) == 0 {
+			return true
+		}
+		for _, r := range wildcards {
+			if r.MatchString(item.Name) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// selectInstances returns the instances the step will affect, applying the exclusions
+// then sampling with the step's seed so the same seed always selects the same instances.
+func selectInstances(ctx context.Context, svc *types.Services, metadata *types.Metadata, step *types.Step, result *types.MinionResult) ([]*types.Instance, error) {
+	instances, listed, err := filterInstances(ctx, svc, metadata, step, result)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		a, b := instances[i], instances[j]
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.CompleteZone() != b.CompleteZone() {
+			return a.CompleteZone() < b.CompleteZone()
+		}
+		return a.Name < b.Name
+	})
+	limit, err := newLimiter(step.Limits, listed, len(instances))
+	if err != nil {
+		return nil, err
+	}
+	r := rand.New(rand.NewSource(step.Seed))
+	selected := make([]*types.Instance, 0, len(instances))
+	for _, instance := range instances {
+		if r.Float32() > step.Sample {
+			result.Skip(instance.Resource(), "sampling")
+			continue
+		}
+		if reason := limit.take(instance); reason != "" {
+			result.Skip(instance.Resource(), reason)
+			continue
+		}
+		selected = append(selected, instance)
+	}
+	return selected, nil
+}
+
+// Preflight checks the step's limits can be satisfied by the instances it matches before anything is changed,
+// it fails when a protected label already has too few running instances or the limits leave no instance eligible.
+func Preflight(ctx context.Context, svc *types.Services, metadata *types.Metadata, step types.Step) error {
+	if !step.Limits.Set() {
+		return nil
+	}
+	var result types.MinionResult
+	instances, listed, err := filterInstances(ctx, svc, metadata, &step, &result)
+	if err != nil {
+		return err
+	}
+	limit, err := newLimiter(step.Limits, listed, len(instances))
+	if err != nil {
+		return err
+	}
+	for label, min := range step.Limits.MinRemainingPerLabel {
+		if running := limit.remaining[label]; running < min {
+			return fmt.Errorf("minRemainingPerLabel %s requires %d running instances but only %d are running", label, min, running)
+		}
+	}
+	if len(instances) == 0 {
+		return nil
+	}
+	for _, instance := range instances {
+		if limit.take(instance) == "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("limits leave none of the %d matching instances eligible", len(instances))
+}
+
+// limiter tracks how much of the step's blast radius has been used while selecting instances
+type limiter struct {
+	limits    types.Limits
+	maxTotal  int
+	selected  int
+	perZone   map[string]int
+	remaining map[string]int
+}
+
+// newLimiter counts the running instances of each protected label across every listed instance,
+// excluded instances are included since they are left running.
+func newLimiter(limits types.Limits, listed []*types.Instance, matching int) (*limiter, error) {
+	l := &limiter{
+		limits:    limits,
+		maxTotal:  -1,
+		perZone:   make(map[string]int),
+		remaining: make(map[string]int, len(limits.MinRemainingPerLabel)),
+	}
+	if limits.MaxTargets > 0 {
+		l.maxTotal = limits.MaxTargets
+	}
+	if limits.MaxPercent > 0 {
+		max := int(float32(matching) * limits.MaxPercent / 100.0)
+		if l.maxTotal < 0 || max < l.maxTotal {
+			l.maxTotal = max
+		}
+	}
+	for label := range limits.MinRemainingPerLabel {
+		key, value, err := types.LabelSelector(label)
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range listed {
+			if instance.Running() && instance.Labels[key] == value {
+				l.remaining[label]++
 			}
 		}
 	}
-	return instances, nil
+	return l, nil
 }
 
-func buildFirewall(values []types.Deny, name, network, direction, label string) *compute.Firewall {
-	firewall := &compute.Firewall{
-		Direction:  direction,
-		Name:       name,
-		Network:    network,
-		Priority:   1,
-		TargetTags: []string{fmt.Sprintf("%s:wargames", label)},
-		SourceTags: []string{fmt.Sprintf("%s:wargames", label)},
+// take reserves the instance against the limits, returning the limit that prevented it otherwise
+func (l *limiter) take(instance *types.Instance) string {
+	if l.maxTotal >= 0 && l.selected >= l.maxTotal {
+		if l.limits.MaxTargets > 0 && l.selected >= l.limits.MaxTargets {
+			return "maxTargets"
+		}
+		return "maxPercent"
+	}
+	if l.limits.MaxPerZone > 0 && l.perZone[instance.CompleteZone()] >= l.limits.MaxPerZone {
+		return "maxPerZone"
+	}
+	protected := make([]string, 0, len(l.limits.MinRemainingPerLabel))
+	for label, min := range l.limits.MinRemainingPerLabel {
+		key, value, _ := types.LabelSelector(label)
+		if instance.Labels[key] != value {
+			continue
+		}
+		if instance.Running() && l.remaining[label] <= min {
+			return "minRemainingPerLabel"
+		}
+		protected = append(protected, label)
+	}
+	if instance.Running() {
+		for _, label := range protected {
+			l.remaining[label]--
+		}
+	}
+	l.selected++
+	l.perZone[instance.CompleteZone()]++
+	return ""
+}
+
+// Preview reports the instances the step would select without making any changes
+func Preview(ctx context.Context, svc *types.Services, metadata *types.Metadata, step types.Step) (result types.MinionResult) {
+	result.Minion = "selection"
+	if err := Preflight(ctx, svc, metadata, step); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	instances, err := selectInstances(ctx, svc, metadata, &step, &result)
+	if err != nil {
+		result.Error = err.Error()
+		return result
 	}
-	for _, deny := range values {
-		firewall.Denied = append(firewall.Denied, &compute.FirewallDenied{
-			IPProtocol: deny.Protocol,
-			Ports:      deny.Ports,
-		})
+	for _, instance := range instances {
+		result.Affect(instance.Resource(), "select")
 	}
-	return firewall
+	return result
+}
+
+// buildFirewalls returns the deny rule for the settings followed by an allow rule for each exception,
+// the exceptions are given a higher priority so they take precedence over the deny rule.
+func buildFirewalls(conf types.NetworkSettings, gen func(...string) string, prefix, direction, label string) []*types.FirewallRule {
+	priority := int64(1)
+	if conf.Priority != nil {
+		priority = *conf.Priority
+	}
+	target := func(name string, priority int64) *types.FirewallRule {
+		rule := &types.FirewallRule{
+			Direction:             direction,
+			Name:                  name,
+			Network:               conf.Network,
+			Priority:              priority,
+			TargetServiceAccounts: conf.TargetServiceAccounts,
+			Log:                   conf.Log,
+		}
+		if len(conf.TargetServiceAccounts) == 0 {
+			rule.TargetTags = []string{wargamesTag(label)}
+		}
+		return rule
+	}
+	deny := target(gen(prefix), priority)
+	deny.Denied = conf.Deny
+	deny.SourceRanges, deny.DestinationRanges = conf.SourceRanges, conf.DestinationRanges
+	// Without any source ranges, ingress is denied between the targeted instances
+	switch {
+	case direction != "INGRESS" || len(conf.SourceRanges) > 0:
+	case len(deny.TargetTags) > 0:
+		deny.SourceTags = deny.TargetTags
+	default:
+		deny.SourceRanges = []string{"0.0.0.0/0"}
+	}
+	rules := []*types.FirewallRule{deny}
+	for _, allow := range conf.Allow {
+		rule := target(gen(prefix, "allow"), priority-1)
+		protocol := allow.Protocol
+		if protocol == "" {
+			protocol = "all"
+		}
+		rule.Allowed = []types.Deny{{Protocol: protocol, Ports: allow.Ports}}
+		if direction == "INGRESS" {
+			rule.SourceRanges = allow.Ranges
+		} else {
+			rule.DestinationRanges = allow.Ranges
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// wargamesTag returns the network tag that firewall rules created for the label target
+func wargamesTag(label string) string {
+	return "wargames-" + label
 }
 
 func nameAppendor() func(...string) string {
@@ -98,18 +329,45 @@ func nameAppendor() func(...string) string {
 	}
 }
 
-func filterList(originalList, excludeList []string) []string {
-	filtered := make([]string, 0, len(originalList))
-	for _, original := range originalList {
-		excluded := false
-		for _, exclude := range excludeList {
-			if strings.HasPrefix(original, exclude) {
-				excluded = true
-			}
+// splitZone separates the complete zone name into its region and zone suffix,
+// a name without a suffix is returned as the region.
+func splitZone(zone string) (region, suffix string) {
+	i := strings.LastIndex(zone, "-")
+	if i < 0 {
+		return zone, ""
+	}
+	return zone[:i], zone[i+1:]
+}
+
+// inZones reports if the zone is one of the zones, zones are always matched by their full name
+// such as australia-southeast1-a so that a zone never matches the zones of other regions.
+func inZones(zone string, zones []string) bool {
+	for _, z := range zones {
+		if zone == z {
+			return true
 		}
-		if !excluded {
-			filtered = append(filtered, original)
+	}
+	return false
+}
+
+// inRegions reports if the region starts with any of the regions, so us-west matches both us-west1 and us-west2
+func inRegions(region string, regions []string) bool {
+	for _, r := range regions {
+		if strings.HasPrefix(region, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAny reports if any of the values are within the list
+func hasAny(list, values []string) bool {
+	for _, item := range list {
+		for _, v := range values {
+			if item == v {
+				return true
+			}
 		}
 	}
-	return filtered
+	return false
 }
@@ -0,0 +1,255 @@
+package minions
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/provider"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+func names(instances []*types.Instance) []string {
+	selected := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		selected = append(selected, instance.Name)
+	}
+	return selected
+}
+
+func TestSelectInstancesIsDeterministicForSeed(t *testing.T) {
+	f := newFixture(t, 10)
+	selection := func(seed int64) []string {
+		step := types.Step{Projects: []string{"p"}, Sample: 0.5, Seed: seed, Include: demo}
+		instances, err := selectInstances(context.Background(), f.svc, f.metadata, &step, &types.MinionResult{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return names(instances)
+	}
+	first := selection(42)
+	if len(first) == 0 || len(first) == 40 {
+		t.Fatalf("sampling half the instances selected %d of 40", len(first))
+	}
+	if again := selection(42); !reflect.DeepEqual(first, again) {
+		t.Errorf("seed selected %v then %v, want the same instances", first, again)
+	}
+	if other := selection(7); reflect.DeepEqual(first, other) {
+		t.Errorf("different seeds both selected %v", first)
+	}
+}
+
+func TestPreviewReportsSelection(t *testing.T) {
+	f := newFixture(t, 10)
+	step := types.Step{Projects: []string{"p"}, Sample: 0.5, Seed: 42, Include: demo, Exclude: types.Exclude{Wildcards: []string{"-0$"}}}
+	result := Preview(context.Background(), f.svc, f.metadata, step)
+	if result.Error != "" {
+		t.Fatalf("unexpected error: %s", result.Error)
+	}
+	reasons := make(map[string]int)
+	for _, skipped := range result.Skipped {
+		reasons[skipped.Reason]++
+	}
+	if reasons["exclusion"] != 4 || len(result.Affected)+reasons["sampling"] != 36 {
+		t.Errorf("selected %d and skipped %v, want 4 excluded and the rest sampled", len(result.Affected), reasons)
+	}
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("preview stopped %v", stopped)
+	}
+}
+
+func TestSelectInstancesAppliesExclusionsAndLimits(t *testing.T) {
+	f := newFixture(t, 3)
+	step := types.Step{
+		Projects: []string{"p"},
+		Sample:   1,
+		Include:  types.Include{Wildcards: []string{"^demo-us"}},
+		Exclude:  types.Exclude{Labels: map[string]string{"app": "demo-0"}},
+		Limits:   types.Limits{MaxPerZone: 1},
+	}
+	var result types.MinionResult
+	instances, err := selectInstances(context.Background(), f.svc, f.metadata, &step, &result)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"demo-us-central1-a-1", "demo-us-central1-b-1"}; !reflect.DeepEqual(names(instances), want) {
+		t.Errorf("selected %v, want %v", names(instances), want)
+	}
+	reasons := make(map[string]int)
+	for _, skipped := range result.Skipped {
+		reasons[skipped.Reason]++
+	}
+	if reasons["exclusion"] != 2 || reasons["maxPerZone"] != 2 {
+		t.Errorf("skipped %v, want 2 excluded and 2 over maxPerZone", reasons)
+	}
+}
+
+func TestZonesMatchByFullName(t *testing.T) {
+	item := &types.Instance{Region: "us-central1", Zone: "a"}
+	for name, c := range map[string]struct {
+		exclude types.Exclude
+		want    bool
+	}{
+		"zone":         {exclude: types.Exclude{Zones: []string{"us-central1-a"}}, want: true},
+		"other zone":   {exclude: types.Exclude{Zones: []string{"us-central1-b"}}},
+		"other region": {exclude: types.Exclude{Zones: []string{"us-central"}}},
+		"region":       {exclude: types.Exclude{Regions: []string{"us-central1"}}, want: true},
+		"prefix":       {exclude: types.Exclude{Regions: []string{"us-"}}, want: true},
+	} {
+		if got := isExcluded(c.exclude, item); got != c.want {
+			t.Errorf("%s: excluded is %v, want %v", name, got, c.want)
+		}
+	}
+}
+
+func TestSplitZone(t *testing.T) {
+	for zone, want := range map[string][2]string{
+		"us-central1-a":          {"us-central1", "a"},
+		"australia-southeast1-b": {"australia-southeast1", "b"},
+		"zonal":                  {"zonal", ""},
+	} {
+		if region, suffix := splitZone(zone); region != want[0] || suffix != want[1] {
+			t.Errorf("splitZone(%q) = %q, %q, want %q, %q", zone, region, suffix, want[0], want[1])
+		}
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	f := newFixture(t, 2)
+	for name, c := range map[string]struct {
+		wildcards []string
+		limits    types.Limits
+		fails     bool
+	}{
+		"no limits":     {wildcards: []string{"^demo-us"}},
+		"satisfiable":   {wildcards: []string{"^demo-us"}, limits: types.Limits{MaxPerZone: 1, MinRemainingPerLabel: map[string]int{"app=demo-0": 1}}},
+		"too few":       {wildcards: []string{"^demo-us"}, limits: types.Limits{MinRemainingPerLabel: map[string]int{"app=demo-0": 3}}, fails: true},
+		"none eligible": {wildcards: []string{"^demo-us.*-0$"}, limits: types.Limits{MinRemainingPerLabel: map[string]int{"app=demo-0": 2}}, fails: true},
+	} {
+		step := types.Step{Projects: []string{"p"}, Sample: 1, Include: types.Include{Wildcards: c.wildcards}, Limits: c.limits}
+		if err := Preflight(context.Background(), f.svc, f.metadata, step); (err != nil) != c.fails {
+			t.Errorf("%s: preflight returned %v, want failure %v", name, err, c.fails)
+		}
+	}
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("preflight stopped %v", stopped)
+	}
+}
+
+func instance(zone, status string, labels map[string]string) *types.Instance {
+	return &types.Instance{Region: "us-central1", Zone: zone, Status: status, Labels: labels}
+}
+
+func TestLimiterMaxTargetsAndPercent(t *testing.T) {
+	l, err := newLimiter(types.Limits{MaxTargets: 3, MaxPercent: 50}, nil, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, want := range []string{"", "", "maxPercent", "maxPercent"} {
+		if reason := l.take(instance("a", provider.StatusRunning, nil)); reason != want {
+			t.Errorf("take %d returned %q, want %q", i, reason, want)
+		}
+	}
+	l, err = newLimiter(types.Limits{MaxTargets: 1, MaxPercent: 100}, nil, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.take(instance("a", provider.StatusRunning, nil))
+	if reason := l.take(instance("a", provider.StatusRunning, nil)); reason != "maxTargets" {
+		t.Errorf("take returned %q, want maxTargets", reason)
+	}
+}
+
+func TestLimiterMinRemainingPerLabel(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	listed := []*types.Instance{
+		instance("a", provider.StatusRunning, web),
+		instance("b", provider.StatusRunning, web),
+		instance("c", provider.StatusRunning, web),
+		// Instances that are already stopped don't count towards what is left running
+		instance("c", provider.StatusTerminated, web),
+	}
+	l, err := newLimiter(types.Limits{MinRemainingPerLabel: map[string]int{"app=web": 2}}, listed, len(listed))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if l.remaining["app=web"] != 3 {
+		t.Errorf("remaining %d, want the 3 running instances", l.remaining["app=web"])
+	}
+	for i, want := range []string{"", "minRemainingPerLabel"} {
+		if reason := l.take(listed[i]); reason != want {
+			t.Errorf("take %d returned %q, want %q", i, reason, want)
+		}
+	}
+	// Stopped instances and those without the label can always be taken
+	if reason := l.take(listed[3]); reason != "" {
+		t.Errorf("take of a stopped instance returned %q", reason)
+	}
+	if reason := l.take(instance("a", provider.StatusRunning, map[string]string{"app": "db"})); reason != "" {
+		t.Errorf("take of another label returned %q", reason)
+	}
+}
+
+func TestNewLimiterRejectsInvalidLabel(t *testing.T) {
+	if _, err := newLimiter(types.Limits{MinRemainingPerLabel: map[string]int{"web": 1}}, nil, 0); err == nil {
+		t.Error("a label without a value should fail")
+	}
+}
+
+func TestCompileInclude(t *testing.T) {
+	item := &types.Instance{
+		Name:   "web-1",
+		Region: "us-central1",
+		Zone:   "a",
+		Labels: map[string]string{"app": "web", "tier": "frontend"},
+		Tags:   []string{"http-server"},
+	}
+	for name, test := range map[string]struct {
+		include types.Include
+		matches bool
+	}{
+		"empty":             {types.Include{}, true},
+		"labels":            {types.Include{Labels: map[string]string{"app": "web"}}, true},
+		"other label":       {types.Include{Labels: map[string]string{"app": "db"}}, false},
+		"expression":        {types.Include{Expressions: []types.LabelExpression{{Key: "tier", Operator: types.OperatorIn, Values: []string{"frontend"}}}}, true},
+		"failed expression": {types.Include{Expressions: []types.LabelExpression{{Key: "tier", Operator: types.OperatorNotIn, Values: []string{"frontend"}}}}, false},
+		"zone":              {types.Include{Zones: []string{"us-central1-a"}}, true},
+		"other zone":        {types.Include{Zones: []string{"us-central1-b"}}, false},
+		"region":            {types.Include{Regions: []string{"us-central1"}}, true},
+		"other region":      {types.Include{Regions: []string{"europe-west1"}}, false},
+		"tags":              {types.Include{Tags: []string{"ssh", "http-server"}}, true},
+		"other tags":        {types.Include{Tags: []string{"ssh"}}, false},
+		"wildcards":         {types.Include{Wildcards: []string{"^db-", "^web-"}}, true},
+		"other wildcards":   {types.Include{Wildcards: []string{"^db-"}}, false},
+		"every field":       {types.Include{Labels: map[string]string{"app": "web"}, Tags: []string{"ssh"}}, false},
+	} {
+		include, err := compileInclude(test.include)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if matches := include(item); matches != test.matches {
+			t.Errorf("%s matched %t, want %t", name, matches, test.matches)
+		}
+	}
+}
+
+func TestSelectInstancesAppliesInclude(t *testing.T) {
+	f := newFixture(t, 2)
+	step := types.Step{
+		Projects: []string{"p"},
+		Sample:   1,
+		Include:  types.Include{Zones: []string{"us-central1-b"}, Labels: map[string]string{"app": "demo-1"}},
+	}
+	var result types.MinionResult
+	instances, err := selectInstances(context.Background(), f.svc, f.metadata, &step, &result)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"demo-us-central1-b-1"}; !reflect.DeepEqual(names(instances), want) {
+		t.Errorf("selected %v, want %v", names(instances), want)
+	}
+	// Instances outside of the include are not part of the step so are not reported as skipped
+	if len(result.Skipped) != 0 {
+		t.Errorf("skipped %v, want nothing reported", result.Skipped)
+	}
+}
@@ -0,0 +1,267 @@
+package minions
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type zoneDriver struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	svc      *types.Services
+	metadata *types.Metadata
+
+	stagger time.Duration
+	zones   []string
+	stopped map[string][]*stopped
+	tagged  []*stopped
+	// firewalls maps the created firewalls to their journal entry
+	firewalls map[*types.Firewall]string
+}
+
+// NewZoneOutage returns a minion that takes down every instance within whole zones
+func NewZoneOutage(log *zap.Logger, svc *types.Services, meta *types.Metadata) Minion {
+	return &zoneDriver{
+		log:       log,
+		svc:       svc,
+		metadata:  meta,
+		stopped:   make(map[string][]*stopped),
+		firewalls: make(map[*types.Firewall]string),
+	}
+}
+
+func (zd *zoneDriver) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	zd.lock.Lock()
+	defer zd.lock.Unlock()
+	settings := step.Settings.ZoneOutage
+	zones, err := zd.chooseZones(&step, settings)
+	if err != nil {
+		zd.log.Error("Failed to choose zones", zap.Error(err))
+		result.Error = err.Error()
+		return result
+	}
+	zd.log.Info("Taking zones down", zap.Strings("zones", zones), zap.String("mode", mode))
+	instances, err := selectInstances(ctx, zd.svc, &types.Metadata{Zones: zones}, &step, &result)
+	if err != nil {
+		zd.log.Error("Failed to gather instances", zap.Error(err))
+		result.Error = err.Error()
+		return result
+	}
+	zd.zones, zd.stagger = zones, settings.Stagger
+	if settings.Deny {
+		zd.deny(ctx, instances, settings, mode, &result)
+	}
+	for _, instance := range instances {
+		// Starting an instance that was already stopped on restore would leave it running afterwards
+		if !instance.Running() {
+			result.Skip(instance.Resource(), "notRunning")
+			continue
+		}
+		switch mode {
+		case types.DryRun:
+			zd.log.Info("Stopping instance", zap.String("instance", instance.Name), zap.String("mode", mode), zap.String("zone", instance.CompleteZone()))
+		default:
+			change, err := record(zd.svc, KindInstanceStop, instance.Project, instance.CompleteZone(), instance.Name, nil, func() error {
+				return zd.svc.Provider.StopInstance(ctx, instance.Project, instance.CompleteZone(), instance.Name)
+			})
+			if err != nil {
+				zd.log.Error("Failed to stop instance", zap.String("instance", instance.Name), zap.Error(err))
+				result.Fail(instance.Resource(), "stop", err)
+				continue
+			}
+			switch mode {
+			case types.Repairable:
+				zd.stopped[instance.CompleteZone()] = append(zd.stopped[instance.CompleteZone()], &stopped{instance: instance, change: change})
+			case types.Destruction:
+				finalise(zd.svc, zd.log, change)
+			}
+		}
+		result.Affect(instance.Resource(), "stop")
+	}
+	return result
+}
+
+// deny tags every instance within the zones then creates firewalls in each project
+// that deny all traffic to and from the tagged instances.
+func (zd *zoneDriver) deny(ctx context.Context, instances []*types.Instance, settings types.ZoneOutageSettings, mode string, result *types.MinionResult) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		zd.log.Error("Unable to generate UUID", zap.Error(err))
+		result.Error = err.Error()
+		return
+	}
+	var (
+		tag      = wargamesTag(id.String())
+		projects = make(map[string]bool)
+	)
+	for _, instance := range instances {
+		if mode != types.DryRun {
+			change, err := tagInstance(ctx, zd.svc, instance, tag)
+			if err != nil {
+				zd.log.Error("Unable to apply tag changes", zap.Error(err), zap.String("instance", instance.Name))
+				result.Fail(instance.Resource(), "tag", err)
+				continue
+			}
+			switch mode {
+			case types.Repairable:
+				zd.tagged = append(zd.tagged, &stopped{instance: instance, change: change})
+			case types.Destruction:
+				finalise(zd.svc, zd.log, change)
+			}
+		}
+		result.Affect(instance.Resource(), "tag")
+		projects[instance.Project] = true
+	}
+	network := settings.Network
+	if network == "" {
+		network = "global/networks/default"
+	}
+	gen := nameAppendor()
+	for _, project := range sortedKeys(projects) {
+		for _, direction := range []string{"INGRESS", "EGRESS"} {
+			conf := types.NetworkSettings{Network: network, Deny: []types.Deny{{Protocol: "all"}}}
+			if direction == "INGRESS" {
+				conf.SourceRanges = []string{"0.0.0.0/0"}
+			} else {
+				conf.DestinationRanges = []string{"0.0.0.0/0"}
+			}
+			fw := buildFirewalls(conf, gen, "wargames-zone-"+id.String()[:8]+"-"+strings.ToLower(direction), direction, id.String())[0]
+			f := &types.Firewall{Project: project, Name: fw.Name}
+			if mode != types.DryRun {
+				change, err := record(zd.svc, KindFirewallInsert, project, "", fw.Name, nil, func() error {
+					return zd.svc.Provider.InsertFirewall(ctx, project, fw)
+				})
+				if err != nil {
+					zd.log.Error("Unable to create firewall", zap.Error(err), zap.String("project", project))
+					result.Fail(f.Resource(), "insert", err)
+					continue
+				}
+				switch mode {
+				case types.Repairable:
+					zd.firewalls[f] = change
+				case types.Destruction:
+					finalise(zd.svc, zd.log, change)
+				}
+			}
+			zd.log.Info("Denied zone traffic", zap.String("name", fw.Name), zap.String("tag", tag), zap.String("project", project))
+			result.Affect(f.Resource(), "insert")
+		}
+	}
+}
+
+// Restore brings back each zone in the order they were taken down, waiting the stagger between zones.
+// Instances are started before the network is opened back up so they can become healthy first.
+func (zd *zoneDriver) Restore() (restored []types.Outcome) {
+	zd.lock.Lock()
+	defer zd.lock.Unlock()
+	ctx := context.Background()
+	for i, zone := range zd.zones {
+		if len(zd.stopped[zone]) == 0 {
+			continue
+		}
+		if i > 0 && zd.stagger > 0 {
+			time.Sleep(zd.stagger)
+		}
+		zd.log.Info("Restoring zone", zap.String("zone", zone))
+		for _, s := range zd.stopped[zone] {
+			instance := s.instance
+			if err := zd.svc.Provider.StartInstance(ctx, instance.Project, instance.CompleteZone(), instance.Name); err != nil {
+				zd.log.Error("Failed to start instance", zap.String("instance", instance.Name), zap.Error(err))
+				restored = append(restored, types.Restore(instance.Resource(), "start", err))
+				continue
+			}
+			if err := zd.svc.Journal.Revert(s.change); err != nil {
+				zd.log.Error("Failed to journal started instance", zap.String("instance", instance.Name), zap.Error(err))
+			}
+			restored = append(restored, types.Restore(instance.Resource(), "start", nil))
+		}
+	}
+	for f, change := range zd.firewalls {
+		if err := zd.svc.Provider.DeleteFirewall(ctx, f.Project, f.Name); err != nil {
+			zd.log.Error("Failed to remove firewall", zap.Error(err), zap.String("project", f.Project), zap.String("firewall", f.Name))
+			restored = append(restored, types.Restore(f.Resource(), "delete", err))
+			continue
+		}
+		if err := zd.svc.Journal.Revert(change); err != nil {
+			zd.log.Error("Failed to journal removed firewall", zap.Error(err), zap.String("firewall", f.Name))
+		}
+		restored = append(restored, types.Restore(f.Resource(), "delete", nil))
+	}
+	for _, t := range zd.tagged {
+		instance := t.instance
+		if err := resetTags(ctx, zd.svc, instance.Project, instance.CompleteZone(), instance.Name, instance.Tags); err != nil {
+			zd.log.Error("Failed to reset tags", zap.Error(err), zap.String("instance", instance.Name))
+			restored = append(restored, types.Restore(instance.Resource(), "tag", err))
+			continue
+		}
+		if err := zd.svc.Journal.Revert(t.change); err != nil {
+			zd.log.Error("Failed to journal reset tags", zap.Error(err), zap.String("instance", instance.Name))
+		}
+		restored = append(restored, types.Restore(instance.Resource(), "tag", nil))
+	}
+	zd.stopped = make(map[string][]*stopped)
+	zd.firewalls = make(map[*types.Firewall]string)
+	zd.tagged, zd.zones = nil, nil
+	return restored
+}
+
+// chooseZones returns the zones listed in the settings, otherwise picks count zones
+// at random from those the step includes using the step's seed.
+func (zd *zoneDriver) chooseZones(step *types.Step, settings types.ZoneOutageSettings) ([]string, error) {
+	if len(settings.Zones) > 0 {
+		for _, zone := range settings.Zones {
+			found := false
+			for _, known := range zd.metadata.Zones {
+				if known == zone {
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown zone %s", zone)
+			}
+		}
+		return settings.Zones, nil
+	}
+	candidates := make([]string, 0, len(zd.metadata.Zones))
+	for _, zone := range zd.metadata.Zones {
+		region, _ := splitZone(zone)
+		if len(step.Include.Zones) > 0 && !inZones(zone, step.Include.Zones) ||
+			len(step.Include.Regions) > 0 && !inRegions(region, step.Include.Regions) ||
+			inZones(zone, step.Exclude.Zones) || inRegions(region, step.Exclude.Regions) {
+			continue
+		}
+		candidates = append(candidates, zone)
+	}
+	sort.Strings(candidates)
+	count := settings.Count
+	if count == 0 {
+		count = 1
+	}
+	if count > len(candidates) {
+		return nil, fmt.Errorf("unable to choose %d zones from %d candidates", count, len(candidates))
+	}
+	r := rand.New(rand.NewSource(step.Seed))
+	r.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates[:count], nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,183 @@
+package minions
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+func zoneStep(settings types.ZoneOutageSettings) types.Step {
+	return types.Step{Projects: []string{"p"}, Sample: 1, Seed: 1, Include: demo, Settings: types.Settings{ZoneOutage: settings}}
+}
+
+// tagged returns the names of every instance carrying a wargames tag
+func (f *fixture) tagged() []string {
+	var tagged []string
+	for _, instance := range f.fake.Instances() {
+		for _, tag := range instance.Tags {
+			if strings.HasPrefix(tag, "wargames-") {
+				tagged = append(tagged, instance.Name)
+			}
+		}
+	}
+	return tagged
+}
+
+func TestZoneOutageStopsAndRestoresZone(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewZoneOutage(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), zoneStep(types.ZoneOutageSettings{Zones: []string{"us-central1-a"}}), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 2 {
+		t.Fatalf("result %+v, want every instance in the zone stopped", result)
+	}
+	stopped := f.stopped()
+	if len(stopped) != 2 {
+		t.Fatalf("stopped %v, want the instances in us-central1-a", stopped)
+	}
+	for _, name := range stopped {
+		if !strings.Contains(name, "us-central1-a") {
+			t.Errorf("instance %s outside of the zone was stopped", name)
+		}
+	}
+	if changes := f.outstanding(t); len(changes) != 2 || changes[0].Kind != KindInstanceStop {
+		t.Errorf("journal has %v, want every stop", changes)
+	}
+	if restored := m.Restore(); len(restored) != 2 {
+		t.Errorf("restored %+v, want every instance", restored)
+	}
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("instances %v are still stopped", stopped)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestZoneOutageDryRunChangesNothing(t *testing.T) {
+	f := newFixture(t, 1)
+	result := NewZoneOutage(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), zoneStep(types.ZoneOutageSettings{Count: 2, Deny: true}), types.DryRun)
+	// Every instance is reported stopped and tagged along with a firewall in each direction
+	if len(result.Affected) != 10 {
+		t.Errorf("result %+v, want everything reported", result)
+	}
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("instances %v were stopped during a dry run", stopped)
+	}
+	if firewalls := f.fake.Firewalls(); len(firewalls) != 0 {
+		t.Errorf("firewalls %v were created during a dry run", firewalls)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has changes %v from a dry run", changes)
+	}
+}
+
+func TestZoneOutageDenyRestoresNetwork(t *testing.T) {
+	f := newFixture(t, 1)
+	m := NewZoneOutage(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), zoneStep(types.ZoneOutageSettings{Zones: []string{"us-central1-b"}, Deny: true}), types.Repairable)
+	if result.Error != "" || len(result.Failed) != 0 {
+		t.Fatalf("result %+v, want the zone denied", result)
+	}
+	if tagged := f.tagged(); len(tagged) != 2 {
+		t.Errorf("tagged %v, want the instances in the zone", tagged)
+	}
+	if firewalls := f.fake.Firewalls(); len(firewalls) != 2 {
+		t.Errorf("firewalls %v, want ingress and egress denied", firewalls)
+	}
+	m.Restore()
+	if tagged := f.tagged(); len(tagged) != 0 {
+		t.Errorf("instances %v are still tagged", tagged)
+	}
+	if firewalls := f.fake.Firewalls(); len(firewalls) != 0 {
+		t.Errorf("firewalls %v were not removed", firewalls)
+	}
+	if changes := f.outstanding(t); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestZoneOutageChoosesZones(t *testing.T) {
+	f := newFixture(t, 1)
+	zd := NewZoneOutage(zap.NewNop(), f.svc, f.metadata).(*zoneDriver)
+	step := zoneStep(types.ZoneOutageSettings{})
+	first, err := zd.chooseZones(&step, step.Settings.ZoneOutage)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again, _ := zd.chooseZones(&step, step.Settings.ZoneOutage); len(first) != 1 || again[0] != first[0] {
+		t.Errorf("chose %v then %v, want the same zone for the seed", first, again)
+	}
+	step.Exclude.Zones = []string{first[0]}
+	if other, err := zd.chooseZones(&step, step.Settings.ZoneOutage); err != nil || other[0] == first[0] {
+		t.Errorf("chose %v with %v, want the excluded zone skipped", other, err)
+	}
+	for name, settings := range map[string]types.ZoneOutageSettings{
+		"unknown zone": {Zones: []string{"europe-west1-b"}},
+		"too many":     {Count: 3},
+	} {
+		if _, err := zd.chooseZones(&step, settings); err == nil {
+			t.Errorf("%s should fail", name)
+		}
+	}
+}
+
+func TestRevertRemovesZoneOutage(t *testing.T) {
+	f := newFixture(t, 1)
+	NewZoneOutage(zap.NewNop(), f.svc, f.metadata).Do(context.Background(), zoneStep(types.ZoneOutageSettings{Zones: []string{"us-central1-a"}, Deny: true}), types.Repairable)
+	for _, e := range f.outstanding(t) {
+		if err := Revert(context.Background(), f.svc, e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if stopped := f.stopped(); len(stopped) != 0 {
+		t.Errorf("instances %v are still stopped", stopped)
+	}
+	if tagged := f.tagged(); len(tagged) != 0 {
+		t.Errorf("instances %v are still tagged", tagged)
+	}
+	if firewalls := f.fake.Firewalls(); len(firewalls) != 0 {
+		t.Errorf("firewalls %v were not removed", firewalls)
+	}
+}
+
+func TestZoneOutageLeavesStoppedInstancesStopped(t *testing.T) {
+	f := newFixture(t, 1)
+	var name string
+	for _, instance := range f.fake.Instances() {
+		if instance.CompleteZone() == "us-central1-a" {
+			name = instance.Name
+			break
+		}
+	}
+	if err := f.fake.StopInstance(context.Background(), "p", "us-central1-a", name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := NewZoneOutage(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), zoneStep(types.ZoneOutageSettings{Zones: []string{"us-central1-a"}}), types.Repairable)
+	if result.Error != "" || len(result.Affected) != 1 || len(result.Skipped) != 1 {
+		t.Fatalf("result %+v, want the stopped instance skipped", result)
+	}
+	m.Restore()
+	if stopped := f.stopped(); len(stopped) != 1 || stopped[0] != name {
+		t.Errorf("stopped %v once restored, want %s left stopped", stopped, name)
+	}
+}
+
+func TestZoneOutageAppliesLimits(t *testing.T) {
+	f := newFixture(t, 1)
+	step := zoneStep(types.ZoneOutageSettings{Zones: []string{"us-central1-a"}})
+	step.Limits = types.Limits{MaxTargets: 1}
+	m := NewZoneOutage(zap.NewNop(), f.svc, f.metadata)
+	result := m.Do(context.Background(), step, types.Repairable)
+	if result.Error != "" || len(result.Affected) != 1 || len(result.Skipped) != 1 {
+		t.Fatalf("result %+v, want only one instance stopped", result)
+	}
+	if stopped := f.stopped(); len(stopped) != 1 {
+		t.Errorf("stopped %v, want only one instance", stopped)
+	}
+	m.Restore()
+}
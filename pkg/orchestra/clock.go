@@ -0,0 +1,74 @@
+package orchestra
+
+import (
+	"sync"
+	"time"
+)
+
+// clock tracks how long a step has left to wait and allows it to be paused or extended
+type clock struct {
+	lock      sync.Mutex
+	deadline  time.Time
+	remaining time.Duration
+	paused    bool
+	changed   chan struct{}
+}
+
+func newClock(wait time.Duration) *clock {
+	return &clock{
+		deadline: time.Now().Add(wait),
+		changed:  make(chan struct{}, 1),
+	}
+}
+
+// state returns how long is left to wait and if the clock is paused
+func (c *clock) state() (time.Duration, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.paused {
+		return c.remaining, true
+	}
+	return time.Until(c.deadline), false
+}
+
+// Pause stops the clock from counting down till it is resumed
+func (c *clock) Pause() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.paused {
+		return
+	}
+	c.remaining, c.paused = time.Until(c.deadline), true
+	c.notify()
+}
+
+// Resume continues counting down from where the clock was paused
+func (c *clock) Resume() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.paused {
+		return
+	}
+	c.deadline, c.paused = time.Now().Add(c.remaining), false
+	c.notify()
+}
+
+// Extend adds the duration onto the time left to wait
+func (c *clock) Extend(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.paused {
+		c.remaining += d
+	} else {
+		c.deadline = c.deadline.Add(d)
+	}
+	c.notify()
+}
+
+// notify must be called while holding the lock
+func (c *clock) notify() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,41 @@
+package orchestra
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockPauseAndResume(t *testing.T) {
+	c := newClock(time.Minute)
+	c.Pause()
+	remaining, paused := c.state()
+	if !paused || remaining > time.Minute || remaining < 59*time.Second {
+		t.Fatalf("clock has %v remaining and paused %v, want about a minute paused", remaining, paused)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if again, _ := c.state(); again != remaining {
+		t.Errorf("paused clock went from %v to %v, want it stopped", remaining, again)
+	}
+	c.Resume()
+	if _, paused := c.state(); paused {
+		t.Error("clock is still paused once resumed")
+	}
+	select {
+	case <-c.changed:
+	default:
+		t.Error("changing the clock should notify the waiting step")
+	}
+}
+
+func TestClockExtend(t *testing.T) {
+	c := newClock(time.Second)
+	c.Extend(time.Minute)
+	if remaining, _ := c.state(); remaining <= time.Minute {
+		t.Errorf("clock has %v remaining, want more than a minute", remaining)
+	}
+	c.Pause()
+	c.Extend(time.Minute)
+	if remaining, _ := c.state(); remaining <= 2*time.Minute {
+		t.Errorf("paused clock has %v remaining, want more than two minutes", remaining)
+	}
+}
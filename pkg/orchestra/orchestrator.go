@@ -2,77 +2,422 @@ package orchestra
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/MovieStoreGuy/skirmish/pkg/metrics"
 	"github.com/MovieStoreGuy/skirmish/pkg/minions"
+	"github.com/MovieStoreGuy/skirmish/pkg/provider"
 	"github.com/MovieStoreGuy/skirmish/pkg/signal"
 	"github.com/MovieStoreGuy/skirmish/pkg/types"
 
 	"go.uber.org/zap"
-	"google.golang.org/api/compute/v1"
 )
 
+// stopGrace is how long the minions of a step that ran out of time have to return once cancelled before it is restored
+const stopGrace = time.Minute
+
 type orchestrator struct {
+	// lock guards the running steps and the progress of the execution
+	lock     sync.Mutex
+	result   *types.PlanResult
+	running  []*active
 	ctx      context.Context
 	cancel   context.CancelFunc
 	logger   *zap.Logger
-	handler  *signal.Handler
 	metadata types.Metadata
 	services *types.Services
 	factory  map[string]func(*zap.Logger, *types.Services, *types.Metadata) minions.Minion
 }
 
-// NewRunner returns an orchestrator configured to party
-func NewRunner(ctx context.Context, cancel context.CancelFunc, logger *zap.Logger) (Runner, error) {
+// NewRunner returns an orchestrator configured to party,
+// any services not already set will be loaded once the plan is executed.
+func NewRunner(ctx context.Context, cancel context.CancelFunc, logger *zap.Logger, services *types.Services) (Runner, error) {
+	if services == nil {
+		services = &types.Services{}
+	}
 	o := &orchestrator{
 		ctx:      ctx,
 		cancel:   cancel,
 		logger:   logger,
-		handler:  signal.NewHandler(),
-		services: &types.Services{},
+		services: services,
 		factory: map[string]func(*zap.Logger, *types.Services, *types.Metadata) minions.Minion{
-			"instance": minions.NewInstance,
-			"ingress":  minions.NewNetworkDriver("INGRESS"),
-			"egress":   minions.NewNetworkDriver("EGRESS"),
+			"instance":    minions.NewInstance,
+			"ingress":     minions.NewNetworkDriver("INGRESS"),
+			"egress":      minions.NewNetworkDriver("EGRESS"),
+			"mig":         minions.NewGroup,
+			"zone-outage": minions.NewZoneOutage,
+			"disk":        minions.NewDisk,
+			"maintenance": minions.NewMaintenance,
+			"route":       minions.NewRoute,
+			"cloudsql":    minions.NewCloudSQL,
+			"gke":         minions.NewGKE,
+			"backend":     minions.NewBackend,
+			"iam":         minions.NewIAM,
+			"agent":       minions.NewAgent,
+			"netem":       minions.NewNetem,
+			"proxy":       minions.NewProxy,
 		},
 	}
 	return o, nil
 }
 
-func (o *orchestrator) Execute(plan *types.Plan) error {
+func (o *orchestrator) Execute(plan *types.Plan) (*types.PlanResult, error) {
+	result := &types.PlanResult{
+		Mode:  plan.Mode,
+		Start: time.Now(),
+	}
+	o.lock.Lock()
+	o.result = result
+	o.lock.Unlock()
+	defer func() {
+		o.lock.Lock()
+		defer o.lock.Unlock()
+		result.End = time.Now()
+	}()
+	if err := o.prepare(plan); err != nil {
+		return result, err
+	}
+	deps, err := plan.Dependencies()
+	if err != nil {
+		return result, err
+	}
+	// Plans whose limits can't be satisfied are rejected before any step makes a change
+	for _, step := range plan.Steps {
+		if err := minions.Preflight(o.ctx, o.services, &o.metadata, step); err != nil {
+			return result, fmt.Errorf("step %s: %w", step.Name, err)
+		}
+	}
+	// Once a step has failed no other step is started, though steps already running are left to finish
+	var (
+		wg      sync.WaitGroup
+		done    = make([]chan struct{}, len(plan.Steps))
+		stop    = make(chan struct{})
+		once    sync.Once
+		failure error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			failure = err
+			close(stop)
+		})
+	}
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	for i, step := range plan.Steps {
+		i, step := i, step
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+			for _, dep := range deps[i] {
+				<-done[dep]
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := o.ctx.Err(); err != nil {
+				fail(err)
+				return
+			}
+			if err := o.runStep(plan, step); err != nil {
+				fail(err)
+			}
+		}()
+	}
+	wg.Wait()
+	return result, failure
+}
+
+// active tracks a step that is currently running
+type active struct {
+	result  *types.StepResult
+	clock   *clock
+	handler *signal.Handler
+}
+
+func (o *orchestrator) Preview(plan *types.Plan) (*types.PlanResult, error) {
+	result := &types.PlanResult{
+		Mode:  types.DryRun,
+		Start: time.Now(),
+	}
+	defer func() {
+		result.End = time.Now()
+	}()
+	if err := o.prepare(plan); err != nil {
+		return result, err
+	}
+	for _, step := range plan.Steps {
+		step.Seed = seed(step)
+		selection := minions.Preview(o.ctx, o.services, &o.metadata, step)
+		result.Steps = append(result.Steps, types.StepResult{
+			Name:        step.Name,
+			Description: step.Description,
+			Seed:        step.Seed,
+			Minions:     []types.MinionResult{selection},
+			Error:       selection.Error,
+		})
+	}
+	return result, nil
+}
+
+// prepare loads the services and metadata required by the plan
+func (o *orchestrator) prepare(plan *types.Plan) error {
 	if err := o.loadServices(); err != nil {
 		return err
 	}
-	handler := signal.NewHandler()
-	// In the event something horrid happens, we need to ensure service is restored
-	// so if any events have been stored then we need to clean up and report back
-	defer handler.Finalise()
-	defer handler.Done()
 	for _, project := range plan.Projects {
 		if err := o.collectMetadata(project); err != nil {
 			return err
 		}
 	}
-	for _, step := range plan.Steps {
-		handler.Done()
-		handler.Finalise()
-		handler = signal.NewHandler()
-		o.handler = handler
-		o.logger.Info("Starting execution", zap.String("name", step.Name), zap.String("description", step.Description))
-		for _, op := range step.Operations {
-			gen, exist := o.factory[op]
-			if !exist {
-				return fmt.Errorf("no operation listed as %s", op)
-			}
-			min := gen(o.logger, o.services, &o.metadata)
-			go min.Do(o.ctx, step, plan.Mode)
-			handler.Register(min.Restore)
+	return nil
+}
+
+// seed returns the step's sampling seed, picking a random one when the plan did not set one
+func seed(step types.Step) int64 {
+	if step.Seed != 0 {
+		return step.Seed
+	}
+	return time.Now().UnixNano()
+}
+
+// runStep will start every minion of the step, wait for them to finish or the step deadline
+// then wait for the step duration before restoring everything that was changed.
+// The steady state is checked before the step starts, while it waits and once it is restored,
+// if it is breached while waiting then the step is restored straight away.
+func (o *orchestrator) runStep(plan *types.Plan, step types.Step) (err error) {
+	step.Seed = seed(step)
+	var (
+		mode   = plan.Mode
+		steady = plan.SteadyState.Merge(step.SteadyState)
+		result = &types.StepResult{
+			Name:        step.Name,
+			Description: step.Description,
+			Start:       time.Now(),
+			Seed:        step.Seed,
+			Minions:     make([]types.MinionResult, len(step.Operations)),
 		}
-		o.logger.Info("finished starting all operations", zap.String("name", step.Name), zap.String("description", step.Description))
-		if plan.Mode != types.DryRun {
-			time.Sleep(step.Wait)
+		mins = make([]minions.Minion, len(step.Operations))
+	)
+	a := &active{result: result}
+	o.lock.Lock()
+	o.running = append(o.running, a)
+	o.lock.Unlock()
+	defer o.finish(a)
+	for i, op := range step.Operations {
+		gen, exist := o.factory[op]
+		if !exist {
+			o.lock.Lock()
+			defer o.lock.Unlock()
+			result.Error = fmt.Sprintf("no operation listed as %s", op)
+			result.End = time.Now()
+			return errors.New(result.Error)
 		}
+		mins[i] = gen(o.logger, o.services, &o.metadata)
+		result.Minions[i].Minion = op
+	}
+	probes, healthy := o.verify(o.ctx, steady, types.ProbeBefore)
+	o.lock.Lock()
+	result.Probes = append(result.Probes, probes...)
+	if !healthy {
+		result.Aborted = true
+		result.Error = "steady state was not met before the step started"
+		result.End = time.Now()
+		o.lock.Unlock()
+		return fmt.Errorf("step %s: %s", step.Name, result.Error)
+	}
+	o.lock.Unlock()
+	// In the event something horrid happens, we need to ensure service is restored
+	// so every restore is registered before any minion starts and the handler is shared
+	handler := signal.NewHandler()
+	for i, min := range mins {
+		i, min := i, min
+		handler.Register(func() {
+			restored := min.Restore()
+			o.lock.Lock()
+			defer o.lock.Unlock()
+			result.Minions[i].Restored = append(result.Minions[i].Restored, restored...)
+			metrics.ObserveRestore(result.Minions[i].Minion, restored)
+		})
+	}
+	o.lock.Lock()
+	a.handler = handler
+	o.lock.Unlock()
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		handler.Run()
+		o.logger.Error("Step panicked, its changes have been restored", zap.String("name", step.Name), zap.Any("panic", r))
+		o.lock.Lock()
+		defer o.lock.Unlock()
+		result.Error = fmt.Sprintf("step panicked: %v", r)
+		result.End = time.Now()
+		err = fmt.Errorf("step %s: %s", step.Name, result.Error)
+	}()
+
+	ctx, cancel := context.WithCancel(o.ctx)
+	if step.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(o.ctx, step.Timeout)
+	}
+	defer cancel()
+
+	o.logger.Info("Starting execution", zap.String("name", step.Name), zap.String("description", step.Description), zap.Int64("seed", step.Seed))
+	metrics.StepStarted(step.Name)
+	defer func() {
+		metrics.StepFinished(step.Name, time.Since(result.Start))
+	}()
+	var wg sync.WaitGroup
+	for i, min := range mins {
+		i, min := i, min
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := do(ctx, min, step, mode)
+			o.lock.Lock()
+			defer o.lock.Unlock()
+			r.Minion = result.Minions[i].Minion
+			result.Minions[i] = r
+			metrics.ObserveMinion(r, mode)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	timedOut := false
+	select {
+	case <-done:
+		o.logger.Info("finished all operations", zap.String("name", step.Name), zap.String("description", step.Description))
+	case <-ctx.Done():
+		o.logger.Error("Step did not finish all operations in time", zap.String("name", step.Name), zap.Duration("timeout", step.Timeout), zap.Error(ctx.Err()))
+		// The minions have been cancelled, waiting for them to return ensures nothing is changed after the restore
+		select {
+		case <-done:
+		case <-time.After(stopGrace):
+			o.logger.Error("Operations did not stop once cancelled", zap.String("name", step.Name), zap.Duration("grace", stopGrace))
+		}
+		timedOut = true
+		o.lock.Lock()
+		result.Error = fmt.Sprintf("step did not finish: %v", ctx.Err())
+		o.lock.Unlock()
+	}
+	breached := false
+	if mode != types.DryRun {
+		c := newClock(step.Wait)
+		o.lock.Lock()
+		a.clock = c
+		o.lock.Unlock()
+		probes, breached = o.await(c, steady)
+		o.lock.Lock()
+		a.clock = nil
+		result.Probes = append(result.Probes, probes...)
+		o.lock.Unlock()
+	}
+	// Restore has to happen before the result is returned so it can be included
+	handler.Run()
+	// The execution context could have been cancelled which shouldn't stop checking the restore
+	probes, healthy = o.verify(context.Background(), steady, types.ProbeAfter)
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	result.Probes = append(result.Probes, probes...)
+	result.End = time.Now()
+	switch {
+	case breached:
+		result.Aborted = true
+		result.Error = "steady state was breached while waiting"
+		return fmt.Errorf("step %s: %s", step.Name, result.Error)
+	case timedOut:
+		return fmt.Errorf("step %s: %s", step.Name, result.Error)
+	case !healthy && result.Error == "":
+		result.Error = "steady state was not met once restored"
+	}
+	return nil
+}
+
+// do runs the minion, a panic becomes the minion's error so the step is still restored
+func do(ctx context.Context, min minions.Minion, step types.Step, mode string) (result types.MinionResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			result.Error = fmt.Sprintf("minion panicked: %v", r)
+		}
+	}()
+	return min.Do(ctx, step, mode)
+}
+
+// finish moves the step from running into the completed steps of the plan
+func (o *orchestrator) finish(a *active) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for i, running := range o.running {
+		if running == a {
+			o.running = append(o.running[:i], o.running[i+1:]...)
+			break
+		}
+	}
+	if o.result != nil {
+		o.result.Steps = append(o.result.Steps, *a.result)
+	}
+}
+
+func (o *orchestrator) Progress() Progress {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	var p Progress
+	if o.result != nil {
+		p.Result = *o.result
+		p.Result.Steps = append([]types.StepResult(nil), o.result.Steps...)
+	}
+	for _, a := range o.running {
+		sp := StepProgress{Step: *a.result}
+		sp.Step.Minions = append([]types.MinionResult(nil), a.result.Minions...)
+		sp.Step.Probes = append([]types.ProbeResult(nil), a.result.Probes...)
+		if a.clock != nil {
+			sp.Waiting = true
+			sp.Remaining, sp.Paused = a.clock.state()
+		}
+		p.Running = append(p.Running, sp)
+	}
+	return p
+}
+
+func (o *orchestrator) Pause() error {
+	return o.adjust(func(c *clock) { c.Pause() })
+}
+
+func (o *orchestrator) Resume() error {
+	return o.adjust(func(c *clock) { c.Resume() })
+}
+
+func (o *orchestrator) Extend(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("extend requires a positive duration")
+	}
+	return o.adjust(func(c *clock) { c.Extend(d) })
+}
+
+// adjust applies the change to the clock of every currently waiting step
+func (o *orchestrator) adjust(change func(*clock)) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	waiting := false
+	for _, a := range o.running {
+		if a.clock != nil {
+			change(a.clock)
+			waiting = true
+		}
+	}
+	if !waiting {
+		return ErrNotWaiting
 	}
 	return nil
 }
@@ -81,16 +426,28 @@ func (o *orchestrator) Shutdown() error {
 	if o.cancel != nil {
 		o.cancel()
 	}
-	o.handler.Finalise()
+	o.lock.Lock()
+	handlers := make([]*signal.Handler, 0, len(o.running))
+	for _, a := range o.running {
+		if a.handler != nil {
+			handlers = append(handlers, a.handler)
+		}
+	}
+	o.lock.Unlock()
+	for _, handler := range handlers {
+		handler.Run()
+	}
 	return nil
 }
 
 func (o *orchestrator) loadServices() error {
-	c, err := compute.NewService(o.ctx)
-	if err != nil {
+	if o.services.Provider != nil {
+		return nil
+	}
+	if err := provider.Connect(o.ctx, o.services); err != nil {
 		return err
 	}
-	o.services.Compute = c
+	o.services.Provider = metrics.Instrument(provider.NewGCE(o.services.Compute, o.services.SQLAdmin, o.services.Container, o.services.Resources))
 	return nil
 }
 
@@ -106,21 +463,11 @@ func (o *orchestrator) String() string {
 func (o *orchestrator) collectMetadata(project string) error {
 	var err error
 	o.metadata.Once.Do(func() {
-		err = o.services.Compute.Zones.List(project).Pages(o.ctx, func(list *compute.ZoneList) error {
-			for _, item := range list.Items {
-				o.metadata.Zones = append(o.metadata.Zones, item.Name)
-			}
-			return nil
-		})
+		o.metadata.Zones, err = o.services.Provider.ListZones(o.ctx, project)
 		if err != nil {
 			return
 		}
-		err = o.services.Compute.Regions.List(project).Pages(o.ctx, func(list *compute.RegionList) error {
-			for _, item := range list.Items {
-				o.metadata.Regions = append(o.metadata.Regions, item.Name)
-			}
-			return nil
-		})
+		o.metadata.Regions, err = o.services.Provider.ListRegions(o.ctx, project)
 	})
 	return err
 }
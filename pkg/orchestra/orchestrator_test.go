@@ -0,0 +1,447 @@
+package orchestra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/journal"
+	"github.com/MovieStoreGuy/skirmish/pkg/minions"
+	"github.com/MovieStoreGuy/skirmish/pkg/provider"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// stub is a minion that affects a single resource, when block is set Do waits for the step to be cancelled
+// and when panics is set Do panics instead.
+type stub struct {
+	lock     sync.Mutex
+	block    bool
+	panics   bool
+	done     int
+	restored int
+}
+
+func (s *stub) Do(ctx context.Context, step types.Step, mode string) (result types.MinionResult) {
+	if s.block {
+		<-ctx.Done()
+		result.Error = ctx.Err().Error()
+		return result
+	}
+	if s.panics {
+		panic("stub")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.done++
+	result.Affect(types.Resource{Kind: "stub", Name: step.Name}, mode)
+	return result
+}
+
+func (s *stub) Restore() []types.Outcome {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.restored++
+	return []types.Outcome{types.Restore(types.Resource{Kind: "stub"}, "restore", nil)}
+}
+
+// newStubbed returns an orchestrator where every operation is served by the stub
+func newStubbed(s *stub) *orchestrator {
+	return &orchestrator{
+		ctx:      context.Background(),
+		logger:   zap.NewNop(),
+		services: &types.Services{Provider: provider.NewFake()},
+		factory: map[string]func(*zap.Logger, *types.Services, *types.Metadata) minions.Minion{
+			"stub": func(*zap.Logger, *types.Services, *types.Metadata) minions.Minion { return s },
+		},
+	}
+}
+
+func TestExecuteReportsEveryStep(t *testing.T) {
+	s := &stub{}
+	plan := &types.Plan{Mode: types.Repairable, Steps: []types.Step{
+		{Name: "first", Operations: []string{"stub"}},
+		{Name: "second", Operations: []string{"stub"}},
+	}}
+	result, err := newStubbed(s).Execute(plan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Steps) != 2 {
+		t.Fatalf("reported %d steps, want 2", len(result.Steps))
+	}
+	for _, step := range result.Steps {
+		if len(step.Minions) != 1 || step.Minions[0].Minion != "stub" {
+			t.Fatalf("step %s reported minions %+v, want the stub", step.Name, step.Minions)
+		}
+		m := step.Minions[0]
+		if len(m.Affected) != 1 || m.Affected[0].Name != step.Name {
+			t.Errorf("step %s affected %+v, want the step's resource", step.Name, m.Affected)
+		}
+		if len(m.Restored) == 0 {
+			t.Errorf("step %s reported nothing restored", step.Name)
+		}
+	}
+	if s.done != 2 || s.restored != 2 {
+		t.Errorf("stub ran %d times and restored %d times, want each step restored once", s.done, s.restored)
+	}
+}
+
+func TestExecuteRestoresPanickingMinion(t *testing.T) {
+	s := &stub{panics: true}
+	plan := &types.Plan{Mode: types.Repairable, Steps: []types.Step{
+		{Name: "panics", Operations: []string{"stub"}},
+	}}
+	result, err := newStubbed(s).Execute(plan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Steps) != 1 || len(result.Steps[0].Minions) != 1 {
+		t.Fatalf("steps %+v, want the step reported", result.Steps)
+	}
+	if m := result.Steps[0].Minions[0]; !strings.Contains(m.Error, "panicked") {
+		t.Errorf("minion reported %q, want the panic", m.Error)
+	}
+	if s.restored != 1 {
+		t.Errorf("stub restored %d times, want once", s.restored)
+	}
+}
+
+func TestExecuteReportsStepTimeout(t *testing.T) {
+	plan := &types.Plan{Mode: types.Repairable, Steps: []types.Step{
+		{Name: "slow", Operations: []string{"stub"}, Timeout: 10 * time.Millisecond},
+	}}
+	s := &stub{block: true}
+	result, err := newStubbed(s).Execute(plan)
+	if err == nil {
+		t.Error("a step that ran out of time should fail the plan")
+	}
+	if len(result.Steps) != 1 || result.Steps[0].Error == "" {
+		t.Fatalf("steps %+v, want the timeout reported", result.Steps)
+	}
+	// The minion is waited on once cancelled so its result is recorded before the step is restored
+	if minion := result.Steps[0].Minions[0]; minion.Error != context.DeadlineExceeded.Error() || s.restored != 1 {
+		t.Errorf("minion %+v restored %d times, want it stopped then restored once", minion, s.restored)
+	}
+}
+
+func TestExecuteRejectsUnknownOperation(t *testing.T) {
+	plan := &types.Plan{Mode: types.Repairable, Steps: []types.Step{
+		{Name: "unknown", Operations: []string{"missing"}},
+		{Name: "never", Operations: []string{"stub"}},
+	}}
+	s := &stub{}
+	if _, err := newStubbed(s).Execute(plan); err == nil {
+		t.Error("an unknown operation should fail the plan")
+	}
+	if s.done != 0 {
+		t.Error("steps after the failed step should not run")
+	}
+}
+
+func TestExecuteDryRunDoesNotWait(t *testing.T) {
+	plan := &types.Plan{Mode: types.DryRun, Steps: []types.Step{
+		{Name: "dryrun", Operations: []string{"stub"}, Wait: time.Minute},
+	}}
+	start := time.Now()
+	if _, err := newStubbed(&stub{}).Execute(plan); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if took := time.Since(start); took >= time.Minute {
+		t.Errorf("dry run took %v, want it to skip the wait", took)
+	}
+}
+
+func TestExecuteRunsParallelGroupTogether(t *testing.T) {
+	plan := &types.Plan{Mode: types.Repairable, Steps: []types.Step{
+		{Name: "first", Operations: []string{"stub"}, Parallel: "outage", Wait: 200 * time.Millisecond},
+		{Name: "second", Operations: []string{"stub"}, Parallel: "outage", Wait: 200 * time.Millisecond},
+		{Name: "after", Operations: []string{"stub"}},
+	}}
+	o := newStubbed(&stub{})
+	waiting := make(chan int, 1)
+	go func() {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			if p := o.Progress(); len(p.Running) == 2 && p.Running[0].Waiting && p.Running[1].Waiting {
+				waiting <- len(p.Running)
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		waiting <- 0
+	}()
+	result, err := o.Execute(plan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := <-waiting; n != 2 {
+		t.Error("the steps within the parallel group never waited together")
+	}
+	var order []string
+	for _, step := range result.Steps {
+		order = append(order, step.Name)
+	}
+	if len(order) != 3 || order[2] != "after" {
+		t.Errorf("steps finished in order %v, want the group before the step after it", order)
+	}
+}
+
+// newRunner returns an orchestrator backed by a populated fake provider and a journal kept in a temporary file
+func newRunner(t *testing.T) (Runner, *provider.Fake, string) {
+	fake := provider.NewFake("us-central1-a", "us-central1-b")
+	fake.Populate(2, "p")
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := journal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	r, err := NewRunner(ctx, cancel, zap.NewNop(), &types.Services{Provider: fake, Journal: j})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, fake, path
+}
+
+func stopStep(name string) types.Step {
+	return types.Step{Name: name, Operations: []string{"instance"}, Projects: []string{"p"}, Sample: 1, Wait: 10 * time.Millisecond}
+}
+
+// command returns a probe that runs the shell script
+func command(name, script string) types.Probe {
+	return types.Probe{Name: name, Command: &types.CommandProbe{Path: "/bin/sh", Args: []string{"-c", script}}}
+}
+
+// flaky returns a probe that passes the first time it runs then fails from then on
+func flaky(t *testing.T) types.Probe {
+	marker := filepath.Join(t.TempDir(), "checked")
+	return command("flaky", "test ! -e "+marker+" && touch "+marker)
+}
+
+func stoppedInstances(fake *provider.Fake) []string {
+	var stopped []string
+	for _, instance := range fake.Instances() {
+		if instance.Status != provider.StatusRunning {
+			stopped = append(stopped, instance.Name)
+		}
+	}
+	return stopped
+}
+
+func outstanding(t *testing.T, path string) []journal.Entry {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := journal.Read(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return journal.Outstanding(entries)
+}
+
+func TestExecuteAbortsWhenSteadyStateNotMet(t *testing.T) {
+	r, fake, _ := newRunner(t)
+	plan := &types.Plan{
+		Mode:        types.Repairable,
+		Projects:    []string{"p"},
+		SteadyState: types.SteadyState{Probes: []types.Probe{command("unhealthy", "exit 1")}},
+		Steps:       []types.Step{stopStep("first"), stopStep("second")},
+	}
+	result, err := r.Execute(plan)
+	if err == nil {
+		t.Fatal("a failing probe before the step should abort the plan")
+	}
+	if len(result.Steps) != 1 || !result.Steps[0].Aborted {
+		t.Fatalf("steps %+v, want only the first step aborted", result.Steps)
+	}
+	if affected := result.Steps[0].Minions[0].Affected; len(affected) != 0 {
+		t.Errorf("aborted step affected %v", affected)
+	}
+	if stopped := stoppedInstances(fake); len(stopped) != 0 {
+		t.Errorf("instances %v were stopped", stopped)
+	}
+}
+
+func TestExecuteRejectsUnsatisfiableLimits(t *testing.T) {
+	r, fake, path := newRunner(t)
+	limited := stopStep("limited")
+	limited.Limits = types.Limits{MinRemainingPerLabel: map[string]int{"app=demo-0": 10}}
+	plan := &types.Plan{Mode: types.Repairable, Projects: []string{"p"}, Steps: []types.Step{stopStep("first"), limited}}
+	if _, err := r.Execute(plan); err == nil {
+		t.Fatal("a plan whose limits can't be satisfied should fail")
+	}
+	// Even the step before the unsatisfiable one is never started
+	if stopped := stoppedInstances(fake); len(stopped) != 0 {
+		t.Errorf("instances %v were stopped", stopped)
+	}
+	if changes := outstanding(t, path); len(changes) != 0 {
+		t.Errorf("journal has changes %v", changes)
+	}
+}
+
+func TestExecuteRestoresOnProbeBreach(t *testing.T) {
+	r, fake, path := newRunner(t)
+	step := stopStep("breached")
+	step.Wait = time.Minute
+	step.SteadyState = types.SteadyState{Interval: 10 * time.Millisecond, Probes: []types.Probe{flaky(t)}}
+	plan := &types.Plan{
+		Mode:     types.Repairable,
+		Projects: []string{"p"},
+		Steps:    []types.Step{step, stopStep("never")},
+	}
+	start := time.Now()
+	result, err := r.Execute(plan)
+	if err == nil || !strings.Contains(err.Error(), "breached") {
+		t.Fatalf("error %v, want the steady state breached", err)
+	}
+	if took := time.Since(start); took >= step.Wait {
+		t.Errorf("step took %v, want it aborted before the wait finished", took)
+	}
+	if len(result.Steps) != 1 || !result.Steps[0].Aborted {
+		t.Fatalf("steps %+v, want only the breached step aborted", result.Steps)
+	}
+	m := result.Steps[0].Minions[0]
+	if len(m.Affected) == 0 || len(m.Restored) != len(m.Affected) {
+		t.Errorf("affected %d and restored %d, want everything affected restored", len(m.Affected), len(m.Restored))
+	}
+	if stopped := stoppedInstances(fake); len(stopped) != 0 {
+		t.Errorf("instances %v are still stopped", stopped)
+	}
+	if changes := outstanding(t, path); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestExecuteRestoresEveryStep(t *testing.T) {
+	r, fake, path := newRunner(t)
+	plan := &types.Plan{
+		Mode:     types.Repairable,
+		Projects: []string{"p"},
+		Steps:    []types.Step{stopStep("first"), stopStep("second")},
+	}
+	result, err := r.Execute(plan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Steps) != 2 {
+		t.Fatalf("ran %d steps, want 2", len(result.Steps))
+	}
+	for _, step := range result.Steps {
+		if step.Error != "" || len(step.Minions) != 1 {
+			t.Fatalf("step %s returned %+v", step.Name, step)
+		}
+		m := step.Minions[0]
+		if len(m.Affected) != len(fake.Instances()) || len(m.Restored) != len(m.Affected) {
+			t.Errorf("step %s affected %d and restored %d, want every instance", step.Name, len(m.Affected), len(m.Restored))
+		}
+		for _, restored := range m.Restored {
+			if restored.Error != "" {
+				t.Errorf("step %s failed to restore %s: %s", step.Name, restored.Resource.Name, restored.Error)
+			}
+		}
+	}
+	if stopped := stoppedInstances(fake); len(stopped) != 0 {
+		t.Errorf("instances %v are still stopped", stopped)
+	}
+	if changes := outstanding(t, path); len(changes) != 0 {
+		t.Errorf("journal has outstanding changes %v", changes)
+	}
+}
+
+func TestExecuteDryRunChangesNothing(t *testing.T) {
+	r, fake, path := newRunner(t)
+	plan := &types.Plan{Mode: types.DryRun, Projects: []string{"p"}, Steps: []types.Step{stopStep("dryrun")}}
+	result, err := r.Execute(plan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Steps) != 1 || len(result.Steps[0].Minions[0].Affected) == 0 {
+		t.Fatalf("result %+v, want the instances reported", result.Steps)
+	}
+	if stopped := stoppedInstances(fake); len(stopped) != 0 {
+		t.Errorf("instances %v were stopped during a dry run", stopped)
+	}
+	if changes := outstanding(t, path); len(changes) != 0 {
+		t.Errorf("journal has changes %v from a dry run", changes)
+	}
+}
+
+func TestExecuteToleratesProbeFailures(t *testing.T) {
+	r, fake, _ := newRunner(t)
+	step := stopStep("tolerated")
+	step.Wait = 100 * time.Millisecond
+	step.SteadyState = types.SteadyState{Interval: 10 * time.Millisecond, Tolerance: 1000, Probes: []types.Probe{flaky(t)}}
+	result, err := r.Execute(&types.Plan{Mode: types.Repairable, Projects: []string{"p"}, Steps: []types.Step{step}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Steps) != 1 || result.Steps[0].Aborted {
+		t.Fatalf("steps %+v, want the step to wait out the failures", result.Steps)
+	}
+	// The probe still fails once restored which is reported against the step
+	if result.Steps[0].Error == "" {
+		t.Error("step did not report the steady state failing once restored")
+	}
+	phases := make(map[string]int)
+	for _, p := range result.Steps[0].Probes {
+		phases[p.Phase]++
+	}
+	if phases[types.ProbeBefore] != 1 || phases[types.ProbeDuring] == 0 || phases[types.ProbeAfter] != 1 {
+		t.Errorf("probes ran %v, want before, during and after the step", phases)
+	}
+	if stopped := stoppedInstances(fake); len(stopped) != 0 {
+		t.Errorf("instances %v are still stopped", stopped)
+	}
+}
+
+// selected returns the names of the instances the step's minions affected
+func selected(step types.StepResult) []string {
+	var names []string
+	for _, m := range step.Minions {
+		for _, o := range m.Affected {
+			names = append(names, o.Name)
+		}
+	}
+	return names
+}
+
+func TestPreviewChangesNothing(t *testing.T) {
+	r, fake, path := newRunner(t)
+	step := stopStep("preview")
+	step.Sample, step.Seed = 0.5, 42
+	plan := &types.Plan{Mode: types.Repairable, Projects: []string{"p"}, Steps: []types.Step{step, stopStep("unseeded")}}
+	result, err := r.Preview(plan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Mode != types.DryRun || len(result.Steps) != 2 {
+		t.Fatalf("result %+v, want a dry run of both steps", result)
+	}
+	if result.Steps[0].Seed != 42 || result.Steps[1].Seed == 0 {
+		t.Errorf("steps seeded with %d and %d, want the set seed and a random one", result.Steps[0].Seed, result.Steps[1].Seed)
+	}
+	again, err := r.Preview(plan)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(selected(again.Steps[0]), selected(result.Steps[0])) {
+		t.Error("previewing with the same seed selected different instances")
+	}
+	if stopped := stoppedInstances(fake); len(stopped) != 0 {
+		t.Errorf("preview stopped %v", stopped)
+	}
+	if changes := outstanding(t, path); len(changes) != 0 {
+		t.Errorf("preview journaled %v", changes)
+	}
+}
@@ -1,13 +1,51 @@
 package orchestra
 
-import "github.com/MovieStoreGuy/skirmish/pkg/types"
+import (
+	"errors"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+// ErrNotWaiting is returned when adjusting a wait while no step is waiting
+var ErrNotWaiting = errors.New("no step is currently waiting")
 
 // Runner defines the operation for the orchestration of chaos
 type Runner interface {
-	// Execute will run the game plan and load all the required services
-	Execute(plan *types.Plan) error
+	// Execute will run the game plan and load all the required services,
+	// the returned result contains everything that happened in each step even if an error occurred.
+	Execute(plan *types.Plan) (*types.PlanResult, error)
+
+	// Preview resolves which resources each step of the plan would select without changing anything
+	Preview(plan *types.Plan) (*types.PlanResult, error)
+
+	// Progress returns a snapshot of the executing plan
+	Progress() Progress
+
+	// Pause stops every running step's wait from counting down until it is resumed
+	Pause() error
+
+	// Resume continues counting down every running step's wait
+	Resume() error
+
+	// Extend lengthens every running step's wait by the duration
+	Extend(d time.Duration) error
 
 	// Shutdown is an idempotent operation that will
 	// ensure the stared skirmish will cancel straight away
 	Shutdown() error
 }
+
+// Progress is a snapshot of an executing plan
+type Progress struct {
+	Result  types.PlanResult `json:"result"`
+	Running []StepProgress   `json:"running,omitempty"`
+}
+
+// StepProgress is a snapshot of a step that is still running
+type StepProgress struct {
+	Step      types.StepResult `json:"step"`
+	Waiting   bool             `json:"waiting"`
+	Paused    bool             `json:"paused"`
+	Remaining time.Duration    `json:"remaining"`
+}
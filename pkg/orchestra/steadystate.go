@@ -0,0 +1,70 @@
+package orchestra
+
+import (
+	"context"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/probe"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+const defaultProbeInterval = 30 * time.Second
+
+// verify will check every probe once and report back if the system is in a steady state
+func (o *orchestrator) verify(ctx context.Context, steady types.SteadyState, phase string) ([]types.ProbeResult, bool) {
+	results, healthy := probe.RunAll(ctx, steady.Probes, phase)
+	for _, r := range results {
+		if !r.Ok {
+			o.logger.Error("Probe outside of steady state", zap.String("probe", r.Probe), zap.String("phase", phase), zap.String("error", r.Error))
+		}
+	}
+	return results, healthy
+}
+
+// await will wait till the clock runs out while checking the steady state at every interval,
+// returning early if any probe fails more than the tolerated amount of times in a row.
+func (o *orchestrator) await(c *clock, steady types.SteadyState) (results []types.ProbeResult, breached bool) {
+	interval := steady.Interval
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	if len(steady.Probes) == 0 {
+		ticker.Stop()
+	}
+	failures := make([]int, len(steady.Probes))
+	for {
+		remaining, paused := c.state()
+		timer := time.NewTimer(remaining)
+		if paused {
+			timer.Stop()
+		}
+		select {
+		case <-timer.C:
+			return results, false
+		case <-o.ctx.Done():
+			timer.Stop()
+			return results, false
+		case <-c.changed:
+		case <-ticker.C:
+			checked, _ := o.verify(o.ctx, steady, types.ProbeDuring)
+			results = append(results, checked...)
+			for i, r := range checked {
+				if r.Ok {
+					failures[i] = 0
+					continue
+				}
+				failures[i]++
+				if failures[i] > steady.Tolerance {
+					o.logger.Error("Steady state breached, aborting step", zap.String("probe", r.Probe), zap.Int("failures", failures[i]))
+					timer.Stop()
+					return results, true
+				}
+			}
+		}
+		timer.Stop()
+	}
+}
@@ -0,0 +1,141 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	// maxBody limits how much of a response is read to match against
+	maxBody = 1 << 20
+)
+
+// Run will check the probe once and report if the system is within tolerance
+func Run(ctx context.Context, p types.Probe, phase string) types.ProbeResult {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := types.ProbeResult{
+		Probe: p.Name,
+		Phase: phase,
+		Time:  time.Now(),
+	}
+	var err error
+	switch {
+	case p.HTTP != nil:
+		err = checkHTTP(ctx, p.HTTP)
+	case p.TCP != nil:
+		err = checkTCP(ctx, p.TCP)
+	case p.Command != nil:
+		err = checkCommand(ctx, p.Command)
+	default:
+		err = fmt.Errorf("probe %s has nothing to check", p.Name)
+	}
+	result.Latency = time.Since(result.Time)
+	if err == nil && p.MaxLatency > 0 && result.Latency > p.MaxLatency {
+		err = fmt.Errorf("latency %v exceeded %v", result.Latency, p.MaxLatency)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Ok = err == nil
+	return result
+}
+
+// RunAll will check every probe once and report if all of them were within tolerance
+func RunAll(ctx context.Context, probes []types.Probe, phase string) ([]types.ProbeResult, bool) {
+	results := make([]types.ProbeResult, 0, len(probes))
+	healthy := true
+	for _, p := range probes {
+		r := Run(ctx, p, phase)
+		healthy = healthy && r.Ok
+		results = append(results, r)
+	}
+	return results, healthy
+}
+
+func checkHTTP(ctx context.Context, p *types.HTTPProbe) error {
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return err
+	}
+	accepted := len(p.Status) == 0 && resp.StatusCode < 400
+	for _, status := range p.Status {
+		if status == resp.StatusCode {
+			accepted = true
+		}
+	}
+	if !accepted {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return match(p.Body, body, "body")
+}
+
+func checkTCP(ctx context.Context, p *types.TCPProbe) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func checkCommand(ctx context.Context, p *types.CommandProbe) error {
+	out, err := exec.CommandContext(ctx, p.Path, p.Args...).CombinedOutput()
+	code := 0
+	if err != nil {
+		exit, ok := err.(*exec.ExitError)
+		if !ok {
+			return err
+		}
+		code = exit.ExitCode()
+	}
+	if code != p.ExitCode {
+		return fmt.Errorf("exited with %d, expected %d", code, p.ExitCode)
+	}
+	return match(p.Output, out, "output")
+}
+
+func match(expr string, content []byte, what string) error {
+	if expr == "" {
+		return nil
+	}
+	r, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	if !r.Match(content) {
+		return fmt.Errorf("%s did not match %s", what, expr)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+func TestHTTPProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Probe") != "skirmish" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+	headers := map[string]string{"X-Probe": "skirmish"}
+	for name, tc := range map[string]struct {
+		probe *types.HTTPProbe
+		ok    bool
+	}{
+		"healthy":          {&types.HTTPProbe{URL: srv.URL, Headers: headers, Body: `"ok"`}, true},
+		"missing header":   {&types.HTTPProbe{URL: srv.URL}, false},
+		"accepted status":  {&types.HTTPProbe{URL: srv.URL, Status: []int{http.StatusBadRequest}}, true},
+		"unexpected body":  {&types.HTTPProbe{URL: srv.URL, Headers: headers, Body: `"degraded"`}, false},
+		"unexpected code":  {&types.HTTPProbe{URL: srv.URL, Headers: headers, Status: []int{http.StatusNoContent}}, false},
+		"unreachable host": {&types.HTTPProbe{URL: "http://127.0.0.1:1"}, false},
+	} {
+		r := Run(context.Background(), types.Probe{Name: name, HTTP: tc.probe}, types.ProbeBefore)
+		if r.Ok != tc.ok {
+			t.Errorf("%s probe returned ok %v with %q, want %v", name, r.Ok, r.Error, tc.ok)
+		}
+		if r.Probe != name || r.Phase != types.ProbeBefore {
+			t.Errorf("%s probe reported as %s during %s", name, r.Probe, r.Phase)
+		}
+	}
+}
+
+func TestTCPProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	if r := Run(context.Background(), types.Probe{TCP: &types.TCPProbe{Address: address}}, types.ProbeDuring); !r.Ok {
+		t.Errorf("probe of a listening address failed: %s", r.Error)
+	}
+	l.Close()
+	if r := Run(context.Background(), types.Probe{TCP: &types.TCPProbe{Address: address}}, types.ProbeDuring); r.Ok {
+		t.Error("probe of a closed address should fail")
+	}
+}
+
+func TestCommandProbe(t *testing.T) {
+	for name, tc := range map[string]struct {
+		probe *types.CommandProbe
+		ok    bool
+	}{
+		"exit code":        {&types.CommandProbe{Path: "/bin/sh", Args: []string{"-c", "exit 3"}, ExitCode: 3}, true},
+		"unexpected exit":  {&types.CommandProbe{Path: "/bin/sh", Args: []string{"-c", "exit 1"}}, false},
+		"output":           {&types.CommandProbe{Path: "/bin/sh", Args: []string{"-c", "echo replicas=3"}, Output: "replicas=[1-9]"}, true},
+		"unmatched output": {&types.CommandProbe{Path: "/bin/sh", Args: []string{"-c", "echo replicas=0"}, Output: "replicas=[1-9]"}, false},
+		"missing command":  {&types.CommandProbe{Path: "/does/not/exist"}, false},
+	} {
+		if r := Run(context.Background(), types.Probe{Name: name, Command: tc.probe}, types.ProbeAfter); r.Ok != tc.ok {
+			t.Errorf("%s probe returned ok %v with %q, want %v", name, r.Ok, r.Error, tc.ok)
+		}
+	}
+}
+
+func TestProbeLatencyAndTimeout(t *testing.T) {
+	slow := &types.CommandProbe{Path: "/bin/sh", Args: []string{"-c", "sleep 0.1"}}
+	if r := Run(context.Background(), types.Probe{Command: slow, MaxLatency: 10 * time.Millisecond}, types.ProbeDuring); r.Ok {
+		t.Error("probe slower than the max latency should fail")
+	}
+	if r := Run(context.Background(), types.Probe{Command: slow, Timeout: 10 * time.Millisecond}, types.ProbeDuring); r.Ok {
+		t.Error("probe slower than its timeout should fail")
+	}
+	if r := Run(context.Background(), types.Probe{Name: "empty"}, types.ProbeDuring); r.Ok {
+		t.Error("probe with nothing to check should fail")
+	}
+}
+
+func TestRunAll(t *testing.T) {
+	healthy := types.Probe{Name: "healthy", Command: &types.CommandProbe{Path: "/bin/sh", Args: []string{"-c", "true"}}}
+	unhealthy := types.Probe{Name: "unhealthy", Command: &types.CommandProbe{Path: "/bin/sh", Args: []string{"-c", "false"}}}
+	results, ok := RunAll(context.Background(), []types.Probe{unhealthy, healthy}, types.ProbeBefore)
+	if ok {
+		t.Error("a failing probe should leave the system unhealthy")
+	}
+	if len(results) != 2 || results[0].Ok || !results[1].Ok {
+		t.Errorf("results %+v, want every probe checked", results)
+	}
+	if _, ok := RunAll(context.Background(), nil, types.ProbeBefore); !ok {
+		t.Error("no probes should be healthy")
+	}
+}
@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// rawBackendService keeps each backend as the exact JSON returned by the API so that fields
+// unknown to the compute client, such as those of network endpoint groups, are written back as they were.
+type rawBackendService struct {
+	Fingerprint string            `json:"fingerprint"`
+	Backends    []json.RawMessage `json:"backends"`
+}
+
+func (g *gce) GetBackendService(ctx context.Context, project, region, name string) (*types.BackendService, error) {
+	var raw rawBackendService
+	if err := g.rest(ctx, http.MethodGet, backendServicePath(project, region, name), nil, &raw); err != nil {
+		return nil, err
+	}
+	service := &types.BackendService{
+		Name:        name,
+		Project:     project,
+		Region:      region,
+		Fingerprint: raw.Fingerprint,
+	}
+	for _, config := range raw.Backends {
+		var backend struct {
+			Group string `json:"group"`
+		}
+		if err := json.Unmarshal(config, &backend); err != nil {
+			return nil, err
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, config); err != nil {
+			return nil, err
+		}
+		service.Backends = append(service.Backends, types.Backend{Group: backend.Group, Config: compact.Bytes()})
+	}
+	return service, nil
+}
+
+func (g *gce) UpdateBackendService(ctx context.Context, project, region, name string, backends []types.Backend, fingerprint string) error {
+	patch := rawBackendService{
+		Fingerprint: fingerprint,
+		// An empty list is sent rather than null so that every backend can be removed
+		Backends: make([]json.RawMessage, 0, len(backends)),
+	}
+	for _, backend := range backends {
+		config, err := backendConfig(backend)
+		if err != nil {
+			return err
+		}
+		patch.Backends = append(patch.Backends, config)
+	}
+	var op compute.Operation
+	if err := g.rest(ctx, http.MethodPatch, backendServicePath(project, region, name), patch, &op); err != nil {
+		return err
+	}
+	return g.wait(ctx, project, &op, nil)
+}
+
+// rest makes a request against the compute API without the generated client so the JSON isn't
+// limited to the fields the client knows about, the response is decoded into out when provided.
+func (g *gce) rest(ctx context.Context, method, path string, body, out interface{}) error {
+	return g.request(ctx, method, g.svc.BasePath+path, body, out)
+}
+
+// request makes a JSON request against any of the Google APIs authenticated with the default credentials,
+// the response is decoded into out when provided.
+func (g *gce) request(ctx context.Context, method, url string, body, out interface{}) error {
+	client, err := g.restClient()
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", types.ErrNotFound, url)
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return fmt.Errorf("%w: %s", types.ErrConflict, url)
+	case resp.StatusCode >= 300:
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s responded %s: %s", url, resp.Status, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// restClient returns the client requests are made with, it is only built once
+// since creating the authenticated transport is too costly to repeat for every request.
+func (g *gce) restClient() (*http.Client, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.client != nil {
+		return g.client, nil
+	}
+	// The client outlives the request so it must not be bound to its context
+	client, _, err := htransport.NewClient(context.Background(), option.WithScopes(compute.CloudPlatformScope))
+	if err != nil {
+		return nil, err
+	}
+	g.client = client
+	return client, nil
+}
+
+// backendConfig returns the backend's configuration, with its capacity scaler set to zero when drained
+func backendConfig(backend types.Backend) (json.RawMessage, error) {
+	if !backend.Drained {
+		return backend.Config, nil
+	}
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(backend.Config, &config); err != nil {
+		return nil, err
+	}
+	config["capacityScaler"] = json.RawMessage("0")
+	return json.Marshal(config)
+}
+
+// backendServicePath returns the path of the backend service relative to the projects endpoint
+func backendServicePath(project, region, name string) string {
+	if region == "" {
+		return fmt.Sprintf("%s/global/backendServices/%s", project, name)
+	}
+	return fmt.Sprintf("%s/regions/%s/backendServices/%s", project, region, name)
+}
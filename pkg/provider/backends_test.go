@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestRestReusesClient(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/p/global/backendServices/web" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"fingerprint":"f","backends":[{"group":"g","capacityScaler":1}]}`))
+	}))
+	defer srv.Close()
+	svc, err := compute.New(srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.BasePath = srv.URL + "/"
+	// A client built from the default credentials would fail without them, so every request has to use this one
+	client := srv.Client()
+	g := &gce{svc: svc, client: client}
+	for i := 0; i < 2; i++ {
+		service, err := g.GetBackendService(context.Background(), "p", "", "web")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if service.Fingerprint != "f" || len(service.Backends) != 1 {
+			t.Errorf("service %+v, want the backend read", service)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("made %d requests, want 2", requests)
+	}
+	if g.client != client {
+		t.Error("the client was replaced, want it built once and reused")
+	}
+}
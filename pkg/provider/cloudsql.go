@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"google.golang.org/api/sqladmin/v1beta4"
+)
+
+func (g *gce) ListDatabases(ctx context.Context, project string) ([]*types.Database, error) {
+	var databases []*types.Database
+	call := g.sql.Instances.List(project)
+	for {
+		resp, err := call.Context(ctx).Do()
+		if err != nil {
+			return nil, convertError(err)
+		}
+		for _, item := range resp.Items {
+			databases = append(databases, convertDatabase(project, item))
+		}
+		if resp.NextPageToken == "" {
+			return databases, nil
+		}
+		call.PageToken(resp.NextPageToken)
+	}
+}
+
+func (g *gce) FailoverDatabase(ctx context.Context, project, name string, settingsVersion int64) error {
+	req := &sqladmin.InstancesFailoverRequest{
+		FailoverContext: &sqladmin.FailoverContext{SettingsVersion: settingsVersion},
+	}
+	return g.sqlOperation(ctx, project)(g.sql.Instances.Failover(project, name, req).Context(ctx).Do())
+}
+
+func (g *gce) RestartDatabase(ctx context.Context, project, name string) error {
+	return g.sqlOperation(ctx, project)(g.sql.Instances.Restart(project, name).Context(ctx).Do())
+}
+
+func (g *gce) SetDatabaseAuthorizedNetworks(ctx context.Context, project, name string, networks []types.AuthorizedNetwork) error {
+	current, err := g.sql.Instances.Get(project, name).Context(ctx).Do()
+	if err != nil {
+		return convertError(err)
+	}
+	if current.Settings == nil {
+		return fmt.Errorf("database %s has no settings", name)
+	}
+	ip := &sqladmin.IpConfiguration{
+		AuthorizedNetworks: make([]*sqladmin.AclEntry, 0, len(networks)),
+		// An empty list needs to be sent to remove every network
+		ForceSendFields: []string{"AuthorizedNetworks"},
+	}
+	if current.Settings.IpConfiguration != nil {
+		ip.Ipv4Enabled = current.Settings.IpConfiguration.Ipv4Enabled
+		ip.PrivateNetwork = current.Settings.IpConfiguration.PrivateNetwork
+		ip.RequireSsl = current.Settings.IpConfiguration.RequireSsl
+	}
+	for _, n := range networks {
+		ip.AuthorizedNetworks = append(ip.AuthorizedNetworks, &sqladmin.AclEntry{
+			Name:           n.Name,
+			Value:          n.Value,
+			ExpirationTime: n.ExpirationTime,
+		})
+	}
+	patch := &sqladmin.DatabaseInstance{
+		Settings: &sqladmin.Settings{
+			// The settings version rejects the patch if the database was changed since it was read
+			SettingsVersion: current.Settings.SettingsVersion,
+			IpConfiguration: ip,
+		},
+	}
+	return g.sqlOperation(ctx, project)(g.sql.Instances.Patch(project, name, patch).Context(ctx).Do())
+}
+
+func convertDatabase(project string, item *sqladmin.DatabaseInstance) *types.Database {
+	database := &types.Database{
+		Name:    item.Name,
+		Project: project,
+		Region:  item.Region,
+		Zone:    item.GceZone,
+		State:   item.State,
+	}
+	if item.Settings == nil {
+		return database
+	}
+	database.HighlyAvailable = item.Settings.AvailabilityType == "REGIONAL"
+	database.Labels = item.Settings.UserLabels
+	database.SettingsVersion = item.Settings.SettingsVersion
+	if item.Settings.IpConfiguration != nil {
+		for _, n := range item.Settings.IpConfiguration.AuthorizedNetworks {
+			database.AuthorizedNetworks = append(database.AuthorizedNetworks, types.AuthorizedNetwork{
+				Name:           n.Name,
+				Value:          n.Value,
+				ExpirationTime: n.ExpirationTime,
+			})
+		}
+	}
+	return database
+}
+
+// sqlOperation returns a func that waits for the Cloud SQL operation to be done and converts the errors it reported
+// into a go error, an operation still running once the context ends is wrapped as types.ErrUnfinished.
+func (g *gce) sqlOperation(ctx context.Context, project string) func(*sqladmin.Operation, error) error {
+	return func(op *sqladmin.Operation, err error) error {
+		if err != nil {
+			return convertError(err)
+		}
+		if op == nil {
+			return nil
+		}
+		ctx, cancel := bounded(ctx)
+		defer cancel()
+		for op.Status != "DONE" {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w: operation %s is %s: %v", types.ErrUnfinished, op.Name, op.Status, ctx.Err())
+			case <-time.After(operationPoll):
+			}
+			next, err := g.sql.Operations.Get(project, op.Name).Context(ctx).Do()
+			if err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+				return fmt.Errorf("%w: unable to check operation %s: %v", types.ErrUnfinished, op.Name, convertError(err))
+			}
+			op = next
+		}
+		if op.Error == nil {
+			return nil
+		}
+		msgs := make([]string, 0, len(op.Error.Errors))
+		for _, e := range op.Error.Errors {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("operation %s failed: %s", op.Name, strings.Join(msgs, ", "))
+	}
+}
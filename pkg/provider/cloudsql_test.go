@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"google.golang.org/api/sqladmin/v1beta4"
+)
+
+// fakeSQL serves the operation returned by restarting a database until it has been polled enough times to be done
+func fakeSQL(t *testing.T, polls int32, failure *sqladmin.OperationErrors) (*gce, *int32) {
+	poll := operationPoll
+	operationPoll = time.Millisecond
+	t.Cleanup(func() { operationPoll = poll })
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := &sqladmin.Operation{Name: "op-1", Status: "RUNNING"}
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/instances/db/restart"):
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/projects/p/operations/op-1"):
+			if atomic.AddInt32(&count, 1) >= polls {
+				op.Status, op.Error = "DONE", failure
+			}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(op)
+	}))
+	t.Cleanup(srv.Close)
+	svc, err := sqladmin.New(srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.BasePath = srv.URL + "/"
+	return &gce{sql: svc}, &count
+}
+
+func TestSQLOperationWaitsUntilDone(t *testing.T) {
+	g, count := fakeSQL(t, 2, nil)
+	if err := g.RestartDatabase(context.Background(), "p", "db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *count != 2 {
+		t.Errorf("operation was polled %d times, want 2", *count)
+	}
+}
+
+func TestSQLOperationReportsFailure(t *testing.T) {
+	g, _ := fakeSQL(t, 1, &sqladmin.OperationErrors{Errors: []*sqladmin.OperationError{{Code: "INTERNAL_ERROR", Message: "no"}}})
+	err := g.RestartDatabase(context.Background(), "p", "db")
+	if err == nil || !strings.Contains(err.Error(), "INTERNAL_ERROR") {
+		t.Fatalf("expected the operation error, got %v", err)
+	}
+}
+
+func TestSQLOperationUnfinishedAtDeadline(t *testing.T) {
+	g, _ := fakeSQL(t, 1000, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := g.RestartDatabase(ctx, "p", "db"); !errors.Is(err, types.ErrUnfinished) {
+		t.Fatalf("expected an unfinished operation, got %v", err)
+	}
+}
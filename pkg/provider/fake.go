@@ -0,0 +1,1017 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+const (
+	// StatusRunning is the status of an instance that is running
+	StatusRunning = "RUNNING"
+	// StatusTerminated is the status of an instance that has been stopped
+	StatusTerminated = "TERMINATED"
+	// FakeIdentity is the member the fake provider reports it is authenticated as
+	FakeIdentity = "serviceAccount:skirmish@fake.iam.gserviceaccount.com"
+)
+
+// Fake is an in memory provider that keeps track of all instance and firewall state
+// so that plans can be run without needing access to a cloud.
+type Fake struct {
+	lock      sync.Mutex
+	sequence  uint64
+	zones     []string
+	instances map[string]*types.Instance
+	firewalls map[string]*types.FirewallRule
+	routes    map[string]*types.Route
+	databases map[string]*fakeDatabase
+	backends  map[string]*types.BackendService
+	policies  map[string]*types.Policy
+	// nodePools are keyed by project, location, cluster and pool while cordoned uses the node in place of the pool
+	nodePools map[string]*fakeNodePool
+	cordoned  map[string]bool
+	groups    map[string]*fakeGroup
+	// disks tracks every disk that exists along with the snapshot taken of each disk
+	disks     map[string]bool
+	snapshots map[string]string
+	// populate is the number of instances per zone to create for a project the first time it is listed
+	populate  int
+	populated map[string]bool
+}
+
+// NewFake returns an empty in memory provider where every project has the provided zones
+func NewFake(zones ...string) *Fake {
+	return &Fake{
+		zones:     zones,
+		instances: make(map[string]*types.Instance),
+		firewalls: make(map[string]*types.FirewallRule),
+		routes:    make(map[string]*types.Route),
+		databases: make(map[string]*fakeDatabase),
+		backends:  make(map[string]*types.BackendService),
+		policies:  make(map[string]*types.Policy),
+		nodePools: make(map[string]*fakeNodePool),
+		cordoned:  make(map[string]bool),
+		groups:    make(map[string]*fakeGroup),
+		disks:     make(map[string]bool),
+		snapshots: make(map[string]string),
+		populated: make(map[string]bool),
+	}
+}
+
+// AutoPopulate will create count instances in every zone of a project the first time it is listed
+func (f *Fake) AutoPopulate(count int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.populate = count
+}
+
+// fakeGroup is a managed instance group along with the names of the instances it manages
+type fakeGroup struct {
+	group   types.InstanceGroup
+	policy  json.RawMessage
+	members []string
+	created int
+}
+
+// fakeNodePool is a GKE node pool backed by an instance group in each of its zones
+type fakeNodePool struct {
+	pool   types.NodePool
+	groups []*fakeGroup
+}
+
+// fakeDatabase is a Cloud SQL instance along with the zone of its standby
+type fakeDatabase struct {
+	database *types.Database
+	standby  string
+}
+
+// AddInstance stores a copy of the instance as running within the fake
+func (f *Fake) AddInstance(instance *types.Instance) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.addInstance(instance)
+}
+
+// AddInstanceGroup creates a managed instance group along with size running instances
+func (f *Fake) AddInstanceGroup(project, zone, name string, size int64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	g := &fakeGroup{
+		group: types.InstanceGroup{
+			Name:    name,
+			Zone:    zone,
+			Project: project,
+		},
+		policy: json.RawMessage(`{"maxSurge":{"fixed":1},"minimalAction":"REPLACE","type":"OPPORTUNISTIC"}`),
+	}
+	f.groups[instanceKey(project, zone, name)] = g
+	f.resize(g, size)
+}
+
+// addInstance must be called while holding the lock
+func (f *Fake) addInstance(instance *types.Instance) {
+	stored := copyInstance(instance)
+	if stored.Status == "" {
+		stored.Status = StatusRunning
+	}
+	if stored.Id == 0 {
+		stored.Id = f.next()
+	}
+	if stored.InternalIP == "" {
+		stored.InternalIP = fmt.Sprintf("10.%d.%d.%d", stored.Id>>16&0xff, stored.Id>>8&0xff, stored.Id&0xff)
+	}
+	stored.LabelFingerprint = f.fingerprint()
+	stored.TagFingerprint = f.fingerprint()
+	for _, disk := range stored.Disks {
+		f.disks[disk.Source] = true
+	}
+	if stored.Scheduling.OnHostMaintenance == "" {
+		stored.Scheduling = types.Scheduling{OnHostMaintenance: types.MaintenanceMigrate, AutomaticRestart: true}
+	}
+	f.instances[instanceKey(stored.Project, stored.CompleteZone(), stored.Name)] = stored
+}
+
+// Populate adds count running instances and a managed instance group of count instances into every zone of each project
+func (f *Fake) Populate(count int, projects ...string) {
+	for _, project := range projects {
+		for _, zone := range f.zones {
+			index := strings.LastIndex(zone, "-")
+			for i := 0; i < count; i++ {
+				name := fmt.Sprintf("demo-%s-%d", zone, i)
+				f.AddInstance(&types.Instance{
+					Name:    name,
+					Region:  zone[:index],
+					Zone:    zone[index+1:],
+					Project: project,
+					Labels: map[string]string{
+						"app": fmt.Sprintf("demo-%d", i),
+					},
+					Disks: []types.AttachedDisk{
+						{Source: diskSource(project, zone, name), DeviceName: "persistent-disk-0", Mode: "READ_WRITE", Boot: true, AutoDelete: true},
+						{Source: diskSource(project, zone, name+"-data"), DeviceName: "data", Mode: "READ_WRITE"},
+					},
+				})
+			}
+			f.AddInstanceGroup(project, zone, "demo-mig-"+zone, int64(count))
+		}
+		service := &types.BackendService{Name: "demo-backend", Project: project}
+		for _, zone := range f.zones {
+			group := fmt.Sprintf("projects/%s/zones/%s/instanceGroups/demo-mig-%s", project, zone, zone)
+			service.Backends = append(service.Backends, types.Backend{
+				Group:  group,
+				Config: json.RawMessage(fmt.Sprintf(`{"balancingMode":"RATE","capacityScaler":1,"group":%q,"maxRatePerInstance":100}`, group)),
+			})
+		}
+		f.AddBackendService(service)
+		orders := fmt.Sprintf("serviceAccount:orders@%s.iam.gserviceaccount.com", project)
+		f.AddPolicy(&types.Policy{Project: project, Bindings: []types.Binding{
+			{Role: "roles/owner", Members: []string{"user:admin@example.com", FakeIdentity}},
+			{Role: "roles/pubsub.publisher", Members: []string{orders}},
+			{Role: "roles/cloudsql.client", Members: []string{orders, fmt.Sprintf("serviceAccount:billing@%s.iam.gserviceaccount.com", project)}},
+		}})
+		var (
+			regions []string
+			zones   = make(map[string][]string)
+		)
+		for _, zone := range f.zones {
+			region := zone[:strings.LastIndex(zone, "-")]
+			if len(zones[region]) == 0 {
+				regions = append(regions, region)
+			}
+			zones[region] = append(zones[region], zone)
+		}
+		for _, region := range regions {
+			zones := zones[region]
+			f.AddNodePool(project, region, "demo-gke", "default-pool", zones, int64(count))
+			f.AddDatabase(&types.Database{
+				Name:    "demo-db-" + region,
+				Project: project,
+				Region:  region,
+				Zone:    zones[0],
+				Labels:  map[string]string{"app": "demo-db"},
+				AuthorizedNetworks: []types.AuthorizedNetwork{
+					{Name: "office", Value: "198.51.100.0/24"},
+				},
+			}, zones[len(zones)-1])
+		}
+	}
+}
+
+// AddBackendService stores a copy of the backend service
+func (f *Fake) AddBackendService(service *types.BackendService) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	stored := *service
+	stored.Backends = append([]types.Backend(nil), service.Backends...)
+	stored.Fingerprint = f.fingerprint()
+	f.backends[strings.Join([]string{service.Project, service.Region, service.Name}, "/")] = &stored
+}
+
+// BackendServices returns a copy of every backend service currently stored in the fake
+func (f *Fake) BackendServices() []*types.BackendService {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	keys := make([]string, 0, len(f.backends))
+	for key := range f.backends {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	services := make([]*types.BackendService, 0, len(keys))
+	for _, key := range keys {
+		service := *f.backends[key]
+		service.Backends = append([]types.Backend(nil), service.Backends...)
+		services = append(services, &service)
+	}
+	return services
+}
+
+func (f *Fake) GetBackendService(ctx context.Context, project, region, name string) (*types.BackendService, error) {
+	f.autoPopulate(project)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	stored, exist := f.backends[strings.Join([]string{project, region, name}, "/")]
+	if !exist {
+		return nil, fmt.Errorf("%w: backend service %s", types.ErrNotFound, name)
+	}
+	service := *stored
+	service.Backends = append([]types.Backend(nil), stored.Backends...)
+	return &service, nil
+}
+
+func (f *Fake) UpdateBackendService(ctx context.Context, project, region, name string, backends []types.Backend, fingerprint string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	stored, exist := f.backends[strings.Join([]string{project, region, name}, "/")]
+	if !exist {
+		return fmt.Errorf("%w: backend service %s", types.ErrNotFound, name)
+	}
+	if fingerprint != stored.Fingerprint {
+		return fmt.Errorf("%w: backend service %s", types.ErrConflict, name)
+	}
+	updated := make([]types.Backend, 0, len(backends))
+	for _, backend := range backends {
+		config, err := backendConfig(backend)
+		if err != nil {
+			return err
+		}
+		updated = append(updated, types.Backend{Group: backend.Group, Config: config})
+	}
+	stored.Backends, stored.Fingerprint = updated, f.fingerprint()
+	return nil
+}
+
+// AddPolicy stores a copy of the project's IAM policy
+func (f *Fake) AddPolicy(policy *types.Policy) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	stored := copyPolicy(policy)
+	stored.Etag = f.fingerprint()
+	f.policies[policy.Project] = stored
+}
+
+// Policies returns a copy of every IAM policy currently stored in the fake
+func (f *Fake) Policies() []*types.Policy {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	projects := make([]string, 0, len(f.policies))
+	for project := range f.policies {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+	policies := make([]*types.Policy, 0, len(projects))
+	for _, project := range projects {
+		policies = append(policies, copyPolicy(f.policies[project]))
+	}
+	return policies
+}
+
+func (f *Fake) Identity(ctx context.Context) (string, error) {
+	return FakeIdentity, nil
+}
+
+// fakeRoles are the permissions of the roles the fake knows of, any other role has no permissions
+var fakeRoles = map[string][]string{
+	"roles/owner":                           {"resourcemanager.projects.get", "resourcemanager.projects.getIamPolicy", "resourcemanager.projects.setIamPolicy"},
+	"roles/resourcemanager.projectIamAdmin": {"resourcemanager.projects.getIamPolicy", "resourcemanager.projects.setIamPolicy"},
+	"roles/viewer":                          {"resourcemanager.projects.get", "resourcemanager.projects.getIamPolicy"},
+	"roles/pubsub.publisher":                {"pubsub.topics.publish"},
+	"roles/cloudsql.client":                 {"cloudsql.instances.connect", "cloudsql.instances.get"},
+}
+
+func (f *Fake) RolePermissions(ctx context.Context, role string) ([]string, error) {
+	return append([]string(nil), fakeRoles[role]...), nil
+}
+
+func (f *Fake) GetIamPolicy(ctx context.Context, project string) (*types.Policy, error) {
+	f.autoPopulate(project)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	stored, exist := f.policies[project]
+	if !exist {
+		return nil, fmt.Errorf("%w: project %s", types.ErrNotFound, project)
+	}
+	return copyPolicy(stored), nil
+}
+
+func (f *Fake) SetIamBindings(ctx context.Context, project string, bindings []types.Binding, etag string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	stored, exist := f.policies[project]
+	if !exist {
+		return fmt.Errorf("%w: project %s", types.ErrNotFound, project)
+	}
+	if etag != stored.Etag {
+		return fmt.Errorf("%w: policy of project %s", types.ErrConflict, project)
+	}
+	updated := copyPolicy(&types.Policy{Project: project, Bindings: bindings})
+	for _, b := range updated.Bindings {
+		if len(b.Members) == 0 {
+			return fmt.Errorf("binding for %s has no members", b.Role)
+		}
+	}
+	stored.Bindings, stored.Etag = updated.Bindings, f.fingerprint()
+	return nil
+}
+
+// AddNodePool creates a node pool in the cluster with size nodes in each of the zones
+func (f *Fake) AddNodePool(project, location, cluster, pool string, zones []string, size int64) {
+	p := &fakeNodePool{pool: types.NodePool{Name: pool, Cluster: cluster, Location: location, Project: project}}
+	for _, zone := range zones {
+		name := fmt.Sprintf("gke-%s-%s-%s-grp", cluster, pool, zone[strings.LastIndex(zone, "-")+1:])
+		f.AddInstanceGroup(project, zone, name, size)
+		f.lock.Lock()
+		p.groups = append(p.groups, f.groups[instanceKey(project, zone, name)])
+		f.lock.Unlock()
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.nodePools[strings.Join([]string{project, location, cluster, pool}, "/")] = p
+}
+
+// Cordoned returns the nodes currently marked as unschedulable
+func (f *Fake) Cordoned() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	names := make([]string, 0, len(f.cordoned))
+	for key, cordoned := range f.cordoned {
+		if cordoned {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *Fake) ListNodePools(ctx context.Context, project, location, cluster string) ([]*types.NodePool, error) {
+	f.autoPopulate(project)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var pools []*types.NodePool
+	for _, p := range f.nodePools {
+		if p.pool.Project != project || p.pool.Location != location || p.pool.Cluster != cluster {
+			continue
+		}
+		pool := p.pool
+		for _, g := range p.groups {
+			group := g.group
+			pool.Groups = append(pool.Groups, &group)
+			if group.TargetSize > pool.NodeCount {
+				pool.NodeCount = group.TargetSize
+			}
+		}
+		pools = append(pools, &pool)
+	}
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("%w: cluster %s", types.ErrNotFound, cluster)
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Name < pools[j].Name })
+	return pools, nil
+}
+
+func (f *Fake) ResizeNodePool(ctx context.Context, project, location, cluster, pool string, size int64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	p, exist := f.nodePools[strings.Join([]string{project, location, cluster, pool}, "/")]
+	if !exist {
+		return fmt.Errorf("%w: node pool %s", types.ErrNotFound, pool)
+	}
+	for _, g := range p.groups {
+		f.resize(g, size)
+	}
+	return nil
+}
+
+func (f *Fake) SetNodeSchedulable(ctx context.Context, project, location, cluster, node string, schedulable bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.hasNode(project, location, cluster, node) {
+		return fmt.Errorf("%w: node %s", types.ErrNotFound, node)
+	}
+	f.cordoned[strings.Join([]string{project, location, cluster, node}, "/")] = !schedulable
+	return nil
+}
+
+// DrainNode only checks the node exists as the fake doesn't run any pods
+func (f *Fake) DrainNode(ctx context.Context, project, location, cluster, node string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.hasNode(project, location, cluster, node) {
+		return fmt.Errorf("%w: node %s", types.ErrNotFound, node)
+	}
+	return nil
+}
+
+// hasNode must be called while holding the lock
+func (f *Fake) hasNode(project, location, cluster, node string) bool {
+	for _, p := range f.nodePools {
+		if p.pool.Project != project || p.pool.Location != location || p.pool.Cluster != cluster {
+			continue
+		}
+		for _, g := range p.groups {
+			for _, member := range g.members {
+				if member == node {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// AddDatabase stores the database, it is highly available when the standby zone differs from its zone
+func (f *Fake) AddDatabase(database *types.Database, standby string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	stored := copyDatabase(database)
+	if stored.State == "" {
+		stored.State = "RUNNABLE"
+	}
+	stored.HighlyAvailable = standby != stored.Zone
+	stored.SettingsVersion = int64(f.next())
+	f.databases[database.Project+"/"+database.Name] = &fakeDatabase{database: stored, standby: standby}
+}
+
+// Databases returns a copy of every database currently stored in the fake
+func (f *Fake) Databases() []*types.Database {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	keys := make([]string, 0, len(f.databases))
+	for key := range f.databases {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	databases := make([]*types.Database, 0, len(keys))
+	for _, key := range keys {
+		databases = append(databases, copyDatabase(f.databases[key].database))
+	}
+	return databases
+}
+
+func (f *Fake) ListDatabases(ctx context.Context, project string) ([]*types.Database, error) {
+	f.autoPopulate(project)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var databases []*types.Database
+	for _, d := range f.databases {
+		if d.database.Project == project {
+			databases = append(databases, copyDatabase(d.database))
+		}
+	}
+	sort.Slice(databases, func(i, j int) bool {
+		return databases[i].Name < databases[j].Name
+	})
+	return databases, nil
+}
+
+// FailoverDatabase swaps the zone of the primary with its standby
+func (f *Fake) FailoverDatabase(ctx context.Context, project, name string, settingsVersion int64) error {
+	return f.updateDatabase(project, name, func(d *fakeDatabase) error {
+		if !d.database.HighlyAvailable {
+			return fmt.Errorf("database %s is not highly available", name)
+		}
+		if settingsVersion != d.database.SettingsVersion {
+			return fmt.Errorf("%w: settings of %s", types.ErrConflict, name)
+		}
+		d.database.Zone, d.standby = d.standby, d.database.Zone
+		return nil
+	})
+}
+
+func (f *Fake) RestartDatabase(ctx context.Context, project, name string) error {
+	return f.updateDatabase(project, name, func(d *fakeDatabase) error {
+		d.database.State = "RUNNABLE"
+		return nil
+	})
+}
+
+func (f *Fake) SetDatabaseAuthorizedNetworks(ctx context.Context, project, name string, networks []types.AuthorizedNetwork) error {
+	return f.updateDatabase(project, name, func(d *fakeDatabase) error {
+		d.database.AuthorizedNetworks = append([]types.AuthorizedNetwork(nil), networks...)
+		d.database.SettingsVersion = int64(f.next())
+		return nil
+	})
+}
+
+// updateDatabase will apply fn to the stored database while holding the lock
+func (f *Fake) updateDatabase(project, name string, fn func(*fakeDatabase) error) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	d, exist := f.databases[project+"/"+name]
+	if !exist {
+		return fmt.Errorf("%w: database %s", types.ErrNotFound, name)
+	}
+	return fn(d)
+}
+
+// autoPopulate fills the project the first time it is listed when configured to
+func (f *Fake) autoPopulate(project string) {
+	f.lock.Lock()
+	count := f.populate
+	if f.populated[project] {
+		count = 0
+	}
+	f.populated[project] = true
+	f.lock.Unlock()
+	if count > 0 {
+		f.Populate(count, project)
+	}
+}
+
+// Instances returns a copy of every instance currently stored in the fake
+func (f *Fake) Instances() []*types.Instance {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	keys := make([]string, 0, len(f.instances))
+	for key := range f.instances {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	instances := make([]*types.Instance, 0, len(keys))
+	for _, key := range keys {
+		instances = append(instances, copyInstance(f.instances[key]))
+	}
+	return instances
+}
+
+// Snapshots returns the names of every snapshot currently stored in the fake
+func (f *Fake) Snapshots() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	names := make([]string, 0, len(f.snapshots))
+	for key := range f.snapshots {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Routes returns the names of every route currently stored in the fake
+func (f *Fake) Routes() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	names := make([]string, 0, len(f.routes))
+	for key := range f.routes {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Firewalls returns the names of every firewall currently stored in the fake
+func (f *Fake) Firewalls() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	names := make([]string, 0, len(f.firewalls))
+	for key := range f.firewalls {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *Fake) ListZones(ctx context.Context, project string) ([]string, error) {
+	return append([]string(nil), f.zones...), nil
+}
+
+func (f *Fake) ListRegions(ctx context.Context, project string) ([]string, error) {
+	seen := make(map[string]bool)
+	var regions []string
+	for _, zone := range f.zones {
+		region := zone[:strings.LastIndex(zone, "-")]
+		if !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
+	}
+	return regions, nil
+}
+
+func (f *Fake) ListInstances(ctx context.Context, project, zone string) ([]*types.Instance, error) {
+	f.autoPopulate(project)
+	var instances []*types.Instance
+	for _, instance := range f.Instances() {
+		if instance.Project == project && instance.CompleteZone() == zone {
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
+
+func (f *Fake) GetInstance(ctx context.Context, project, zone, name string) (*types.Instance, error) {
+	var instance *types.Instance
+	err := f.update(project, zone, name, func(i *types.Instance) error {
+		instance = copyInstance(i)
+		return nil
+	})
+	return instance, err
+}
+
+func (f *Fake) StopInstance(ctx context.Context, project, zone, name string) error {
+	return f.update(project, zone, name, func(i *types.Instance) error {
+		i.Status = StatusTerminated
+		return nil
+	})
+}
+
+func (f *Fake) StartInstance(ctx context.Context, project, zone, name string) error {
+	return f.update(project, zone, name, func(i *types.Instance) error {
+		i.Status = StatusRunning
+		return nil
+	})
+}
+
+func (f *Fake) DeleteInstance(ctx context.Context, project, zone, name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key := instanceKey(project, zone, name)
+	if _, exist := f.instances[key]; !exist {
+		return fmt.Errorf("%w: instance %s", types.ErrNotFound, key)
+	}
+	delete(f.instances, key)
+	return nil
+}
+
+func (f *Fake) SetInstanceLabels(ctx context.Context, project, zone, name string, labels map[string]string, fingerprint string) error {
+	return f.update(project, zone, name, func(i *types.Instance) error {
+		if fingerprint != i.LabelFingerprint {
+			return fmt.Errorf("%w: labels of %s", types.ErrConflict, name)
+		}
+		i.Labels = copyLabels(labels)
+		i.LabelFingerprint = f.fingerprint()
+		return nil
+	})
+}
+
+func (f *Fake) SetInstanceTags(ctx context.Context, project, zone, name string, tags []string, fingerprint string) error {
+	return f.update(project, zone, name, func(i *types.Instance) error {
+		if fingerprint != i.TagFingerprint {
+			return fmt.Errorf("%w: tags of %s", types.ErrConflict, name)
+		}
+		i.Tags = append([]string(nil), tags...)
+		i.TagFingerprint = f.fingerprint()
+		return nil
+	})
+}
+
+// SimulateMaintenanceEvent terminates the instance when it is not set to migrate and won't automatically restart
+func (f *Fake) SimulateMaintenanceEvent(ctx context.Context, project, zone, name string) error {
+	return f.update(project, zone, name, func(i *types.Instance) error {
+		if i.Scheduling.OnHostMaintenance == types.MaintenanceTerminate && !i.Scheduling.AutomaticRestart {
+			i.Status = StatusTerminated
+		}
+		return nil
+	})
+}
+
+func (f *Fake) SetInstanceScheduling(ctx context.Context, project, zone, name string, scheduling types.Scheduling) error {
+	return f.update(project, zone, name, func(i *types.Instance) error {
+		i.Scheduling = scheduling
+		return nil
+	})
+}
+
+func (f *Fake) AttachDisk(ctx context.Context, project, zone, name string, disk types.AttachedDisk) error {
+	return f.update(project, zone, name, func(i *types.Instance) error {
+		if !f.disks[disk.Source] {
+			return fmt.Errorf("%w: disk %s", types.ErrNotFound, disk.Source)
+		}
+		for _, attached := range i.Disks {
+			if attached.DeviceName == disk.DeviceName {
+				return fmt.Errorf("device %s is already attached to %s", disk.DeviceName, name)
+			}
+		}
+		i.Disks = append(i.Disks, disk)
+		return nil
+	})
+}
+
+func (f *Fake) DetachDisk(ctx context.Context, project, zone, name, device string) error {
+	return f.update(project, zone, name, func(i *types.Instance) error {
+		for index, attached := range i.Disks {
+			if attached.DeviceName == device {
+				i.Disks = append(i.Disks[:index], i.Disks[index+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: device %s of %s", types.ErrNotFound, device, name)
+	})
+}
+
+func (f *Fake) SnapshotDisk(ctx context.Context, project, zone, disk, snapshot string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	source := diskSource(project, zone, disk)
+	if !f.disks[source] {
+		return fmt.Errorf("%w: disk %s", types.ErrNotFound, source)
+	}
+	f.snapshots[project+"/"+snapshot] = source
+	return nil
+}
+
+func (f *Fake) DeleteDisk(ctx context.Context, project, zone, disk string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	source := diskSource(project, zone, disk)
+	if !f.disks[source] {
+		return fmt.Errorf("%w: disk %s", types.ErrNotFound, source)
+	}
+	for _, instance := range f.instances {
+		for _, attached := range instance.Disks {
+			if attached.Source == source {
+				return fmt.Errorf("disk %s is in use by %s", disk, instance.Name)
+			}
+		}
+	}
+	delete(f.disks, source)
+	return nil
+}
+
+func (f *Fake) ListInstanceGroups(ctx context.Context, project, zone string) ([]*types.InstanceGroup, error) {
+	f.autoPopulate(project)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var groups []*types.InstanceGroup
+	for _, g := range f.groups {
+		if g.group.Project == project && g.group.Zone == zone {
+			group := g.group
+			groups = append(groups, &group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+func (f *Fake) ListGroupInstances(ctx context.Context, project, zone, group string) ([]string, error) {
+	var members []string
+	err := f.updateGroup(project, zone, group, func(g *fakeGroup) error {
+		members = append(members, g.members...)
+		return nil
+	})
+	return members, err
+}
+
+func (f *Fake) ResizeInstanceGroup(ctx context.Context, project, zone, group string, size int64) error {
+	return f.updateGroup(project, zone, group, func(g *fakeGroup) error {
+		if size < 0 {
+			return fmt.Errorf("group %s can not be resized to %d", group, size)
+		}
+		f.resize(g, size)
+		return nil
+	})
+}
+
+func (f *Fake) AbandonGroupInstances(ctx context.Context, project, zone, group string, instances []string) error {
+	return f.updateGroup(project, zone, group, func(g *fakeGroup) error {
+		for _, name := range instances {
+			index := -1
+			for i, member := range g.members {
+				if member == name {
+					index = i
+				}
+			}
+			if index < 0 {
+				return fmt.Errorf("%w: instance %s is not managed by %s", types.ErrNotFound, name, group)
+			}
+			g.members = append(g.members[:index], g.members[index+1:]...)
+			g.group.TargetSize--
+		}
+		return nil
+	})
+}
+
+func (f *Fake) RecreateGroupInstances(ctx context.Context, project, zone, group string, instances []string) error {
+	return f.updateGroup(project, zone, group, func(g *fakeGroup) error {
+		for _, name := range instances {
+			instance, exist := f.instances[instanceKey(project, zone, name)]
+			if !exist {
+				return fmt.Errorf("%w: instance %s", types.ErrNotFound, name)
+			}
+			instance.Id, instance.Status = f.next(), StatusRunning
+		}
+		return nil
+	})
+}
+
+func (f *Fake) RestartInstanceGroup(ctx context.Context, project, zone, group string) error {
+	return f.updateGroup(project, zone, group, func(g *fakeGroup) error {
+		g.policy = json.RawMessage(`{"maxSurge":{"fixed":1},"minimalAction":"RESTART","type":"PROACTIVE"}`)
+		for _, name := range g.members {
+			if instance, exist := f.instances[instanceKey(project, zone, name)]; exist {
+				instance.Status = StatusRunning
+			}
+		}
+		return nil
+	})
+}
+
+func (f *Fake) GetGroupUpdatePolicy(ctx context.Context, project, zone, group string) (json.RawMessage, error) {
+	var policy json.RawMessage
+	err := f.updateGroup(project, zone, group, func(g *fakeGroup) error {
+		policy = append(policy, g.policy...)
+		return nil
+	})
+	return policy, err
+}
+
+func (f *Fake) SetGroupUpdatePolicy(ctx context.Context, project, zone, group string, policy json.RawMessage) error {
+	return f.updateGroup(project, zone, group, func(g *fakeGroup) error {
+		if !json.Valid(policy) {
+			return fmt.Errorf("invalid update policy for %s", group)
+		}
+		g.policy = append(json.RawMessage(nil), policy...)
+		return nil
+	})
+}
+
+// GroupUpdatePolicy returns the current update policy of the group
+func (f *Fake) GroupUpdatePolicy(project, zone, group string) json.RawMessage {
+	policy, _ := f.GetGroupUpdatePolicy(context.Background(), project, zone, group)
+	return policy
+}
+
+func (f *Fake) InsertFirewall(ctx context.Context, project string, rule *types.FirewallRule) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key := project + "/" + rule.Name
+	if _, exist := f.firewalls[key]; exist {
+		return fmt.Errorf("firewall %s already exists", key)
+	}
+	// Mirroring the constraints the compute API places on firewalls
+	switch {
+	case len(rule.TargetTags) > 0 && len(rule.TargetServiceAccounts) > 0:
+		return fmt.Errorf("firewall %s can't target both tags and service accounts", key)
+	case len(rule.SourceTags) > 0 && rule.Direction == "EGRESS":
+		return fmt.Errorf("firewall %s can't use source tags on egress", key)
+	case (len(rule.Denied) > 0) == (len(rule.Allowed) > 0):
+		return fmt.Errorf("firewall %s requires either denied or allowed traffic", key)
+	}
+	stored := *rule
+	f.firewalls[key] = &stored
+	return nil
+}
+
+func (f *Fake) InsertRoute(ctx context.Context, project string, route *types.Route) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key := project + "/" + route.Name
+	if _, exist := f.routes[key]; exist {
+		return fmt.Errorf("route %s already exists", key)
+	}
+	if route.NextHopIp == "" && route.NextHopInstance == "" {
+		return fmt.Errorf("route %s requires a next hop", key)
+	}
+	stored := *route
+	f.routes[key] = &stored
+	return nil
+}
+
+func (f *Fake) DeleteRoute(ctx context.Context, project, name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key := project + "/" + name
+	if _, exist := f.routes[key]; !exist {
+		return fmt.Errorf("%w: route %s", types.ErrNotFound, key)
+	}
+	delete(f.routes, key)
+	return nil
+}
+
+func (f *Fake) DeleteFirewall(ctx context.Context, project, name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key := project + "/" + name
+	if _, exist := f.firewalls[key]; !exist {
+		return fmt.Errorf("%w: firewall %s", types.ErrNotFound, key)
+	}
+	delete(f.firewalls, key)
+	return nil
+}
+
+// update will apply fn to the stored instance while holding the lock
+func (f *Fake) update(project, zone, name string, fn func(*types.Instance) error) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key := instanceKey(project, zone, name)
+	instance, exist := f.instances[key]
+	if !exist {
+		return fmt.Errorf("%w: instance %s", types.ErrNotFound, key)
+	}
+	return fn(instance)
+}
+
+// updateGroup will apply fn to the stored group while holding the lock
+func (f *Fake) updateGroup(project, zone, name string, fn func(*fakeGroup) error) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key := instanceKey(project, zone, name)
+	g, exist := f.groups[key]
+	if !exist {
+		return fmt.Errorf("%w: instance group %s", types.ErrNotFound, key)
+	}
+	return fn(g)
+}
+
+// resize creates or deletes the newest members until the group is at size, it must be called while holding the lock
+func (f *Fake) resize(g *fakeGroup, size int64) {
+	index := strings.LastIndex(g.group.Zone, "-")
+	for int64(len(g.members)) < size {
+		name := fmt.Sprintf("%s-%d", g.group.Name, g.created)
+		g.created++
+		f.addInstance(&types.Instance{
+			Name:    name,
+			Region:  g.group.Zone[:index],
+			Zone:    g.group.Zone[index+1:],
+			Project: g.group.Project,
+			Labels: map[string]string{
+				"app": g.group.Name,
+			},
+		})
+		g.members = append(g.members, name)
+	}
+	for int64(len(g.members)) > size {
+		name := g.members[len(g.members)-1]
+		delete(f.instances, instanceKey(g.group.Project, g.group.Zone, name))
+		g.members = g.members[:len(g.members)-1]
+	}
+	g.group.TargetSize = size
+}
+
+// next must be called while holding the lock
+func (f *Fake) next() uint64 {
+	f.sequence++
+	return f.sequence
+}
+
+// fingerprint must be called while holding the lock
+func (f *Fake) fingerprint() string {
+	return fmt.Sprintf("fp-%d", f.next())
+}
+
+func copyPolicy(policy *types.Policy) *types.Policy {
+	copied := *policy
+	copied.Bindings = make([]types.Binding, 0, len(policy.Bindings))
+	for _, b := range policy.Bindings {
+		b.Members = append([]string(nil), b.Members...)
+		copied.Bindings = append(copied.Bindings, b)
+	}
+	return &copied
+}
+
+func diskSource(project, zone, name string) string {
+	return fmt.Sprintf("projects/%s/zones/%s/disks/%s", project, zone, name)
+}
+
+func instanceKey(project, zone, name string) string {
+	return project + "/" + zone + "/" + name
+}
+
+func copyInstance(i *types.Instance) *types.Instance {
+	c := *i
+	c.Labels = copyLabels(i.Labels)
+	c.Tags = append([]string(nil), i.Tags...)
+	c.Disks = append([]types.AttachedDisk(nil), i.Disks...)
+	return &c
+}
+
+func copyDatabase(d *types.Database) *types.Database {
+	c := *d
+	c.Labels = copyLabels(d.Labels)
+	c.AuthorizedNetworks = append([]types.AuthorizedNetwork(nil), d.AuthorizedNetworks...)
+	return &c
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,502 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sqladmin/v1beta4"
+)
+
+type gce struct {
+	svc *compute.Service
+	sql *sqladmin.Service
+	gke *container.Service
+	crm *cloudresourcemanager.Service
+
+	lock     sync.Mutex
+	clusters map[string]*clusterClient
+	// client makes the requests that go around the generated clients
+	client *http.Client
+}
+
+// NewGCE returns a provider that operates against Google Compute Engine, Cloud SQL, GKE and project IAM
+func NewGCE(svc *compute.Service, sql *sqladmin.Service, gke *container.Service, crm *cloudresourcemanager.Service) types.Provider {
+	return &gce{svc: svc, sql: sql, gke: gke, crm: crm}
+}
+
+// Connect creates any of the Google API clients missing from the services using the default credentials
+func Connect(ctx context.Context, svc *types.Services) (err error) {
+	if svc.Compute == nil {
+		if svc.Compute, err = compute.NewService(ctx); err != nil {
+			return err
+		}
+	}
+	if svc.SQLAdmin == nil {
+		if svc.SQLAdmin, err = sqladmin.NewService(ctx); err != nil {
+			return err
+		}
+	}
+	if svc.Container == nil {
+		if svc.Container, err = container.NewService(ctx); err != nil {
+			return err
+		}
+	}
+	if svc.Resources == nil {
+		if svc.Resources, err = cloudresourcemanager.NewService(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *gce) ListZones(ctx context.Context, project string) ([]string, error) {
+	var zones []string
+	err := g.svc.Zones.List(project).Pages(ctx, func(list *compute.ZoneList) error {
+		for _, item := range list.Items {
+			zones = append(zones, item.Name)
+		}
+		return nil
+	})
+	return zones, convertError(err)
+}
+
+func (g *gce) ListRegions(ctx context.Context, project string) ([]string, error) {
+	var regions []string
+	err := g.svc.Regions.List(project).Pages(ctx, func(list *compute.RegionList) error {
+		for _, item := range list.Items {
+			regions = append(regions, item.Name)
+		}
+		return nil
+	})
+	return regions, convertError(err)
+}
+
+func (g *gce) ListInstances(ctx context.Context, project, zone string) ([]*types.Instance, error) {
+	var instances []*types.Instance
+	err := g.svc.Instances.List(project, zone).Pages(ctx, func(list *compute.InstanceList) error {
+		for _, item := range list.Items {
+			instance, err := convertInstance(project, item)
+			if err != nil {
+				return err
+			}
+			instances = append(instances, instance)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return instances, nil
+}
+
+func (g *gce) GetInstance(ctx context.Context, project, zone, name string) (*types.Instance, error) {
+	item, err := g.svc.Instances.Get(project, zone, name).Context(ctx).Do()
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return convertInstance(project, item)
+}
+
+func (g *gce) StopInstance(ctx context.Context, project, zone, name string) error {
+	return g.operation(ctx, project)(g.svc.Instances.Stop(project, zone, name).Context(ctx).Do())
+}
+
+func (g *gce) StartInstance(ctx context.Context, project, zone, name string) error {
+	return g.operation(ctx, project)(g.svc.Instances.Start(project, zone, name).Context(ctx).Do())
+}
+
+func (g *gce) DeleteInstance(ctx context.Context, project, zone, name string) error {
+	return g.operation(ctx, project)(g.svc.Instances.Delete(project, zone, name).Context(ctx).Do())
+}
+
+func (g *gce) SetInstanceLabels(ctx context.Context, project, zone, name string, labels map[string]string, fingerprint string) error {
+	return g.operation(ctx, project)(g.svc.Instances.SetLabels(project, zone, name, &compute.InstancesSetLabelsRequest{
+		Labels:           labels,
+		LabelFingerprint: fingerprint,
+	}).Context(ctx).Do())
+}
+
+func (g *gce) SetInstanceTags(ctx context.Context, project, zone, name string, tags []string, fingerprint string) error {
+	return g.operation(ctx, project)(g.svc.Instances.SetTags(project, zone, name, &compute.Tags{
+		Items:       tags,
+		Fingerprint: fingerprint,
+	}).Context(ctx).Do())
+}
+
+func (g *gce) SimulateMaintenanceEvent(ctx context.Context, project, zone, name string) error {
+	return g.operation(ctx, project)(g.svc.Instances.SimulateMaintenanceEvent(project, zone, name).Context(ctx).Do())
+}
+
+// SetInstanceScheduling only replaces the maintenance behaviour, keeping the rest of the instance scheduling
+func (g *gce) SetInstanceScheduling(ctx context.Context, project, zone, name string, scheduling types.Scheduling) error {
+	item, err := g.svc.Instances.Get(project, zone, name).Context(ctx).Do()
+	if err != nil {
+		return convertError(err)
+	}
+	current := &compute.Scheduling{}
+	if item.Scheduling != nil {
+		*current = *item.Scheduling
+	}
+	current.OnHostMaintenance = scheduling.OnHostMaintenance
+	current.AutomaticRestart = googleapi.Bool(scheduling.AutomaticRestart)
+	current.ForceSendFields = append(current.ForceSendFields, "AutomaticRestart")
+	return g.operation(ctx, project)(g.svc.Instances.SetScheduling(project, zone, name, current).Context(ctx).Do())
+}
+
+func (g *gce) AttachDisk(ctx context.Context, project, zone, name string, disk types.AttachedDisk) error {
+	return g.operation(ctx, project)(g.svc.Instances.AttachDisk(project, zone, name, &compute.AttachedDisk{
+		Source:     disk.Source,
+		DeviceName: disk.DeviceName,
+		Mode:       disk.Mode,
+		Boot:       disk.Boot,
+		AutoDelete: disk.AutoDelete,
+	}).Context(ctx).Do())
+}
+
+func (g *gce) DetachDisk(ctx context.Context, project, zone, name, device string) error {
+	return g.operation(ctx, project)(g.svc.Instances.DetachDisk(project, zone, name, device).Context(ctx).Do())
+}
+
+// SnapshotDisk waits for the snapshot to be uploaded and READY since the operation finishes once the snapshot is created
+func (g *gce) SnapshotDisk(ctx context.Context, project, zone, disk, snapshot string) error {
+	err := g.operation(ctx, project)(g.svc.Disks.CreateSnapshot(project, zone, disk, &compute.Snapshot{
+		Name: snapshot,
+	}).Context(ctx).Do())
+	if err != nil {
+		return err
+	}
+	if _, set := ctx.Deadline(); !set {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, operationTimeout)
+		defer cancel()
+	}
+	for {
+		item, err := g.svc.Snapshots.Get(project, snapshot).Context(ctx).Do()
+		switch {
+		case err != nil:
+			return convertError(err)
+		case item.Status == "READY":
+			return nil
+		case item.Status == "FAILED" || item.Status == "DELETING":
+			return fmt.Errorf("snapshot %s of %s is %s", snapshot, disk, item.Status)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("snapshot %s of %s is %s: %v", snapshot, disk, item.Status, ctx.Err())
+		case <-time.After(operationPoll):
+		}
+	}
+}
+
+func (g *gce) DeleteDisk(ctx context.Context, project, zone, disk string) error {
+	return g.operation(ctx, project)(g.svc.Disks.Delete(project, zone, disk).Context(ctx).Do())
+}
+
+func (g *gce) ListInstanceGroups(ctx context.Context, project, zone string) ([]*types.InstanceGroup, error) {
+	var groups []*types.InstanceGroup
+	err := g.svc.InstanceGroupManagers.List(project, zone).Pages(ctx, func(list *compute.InstanceGroupManagerList) error {
+		for _, item := range list.Items {
+			group := &types.InstanceGroup{
+				Name:       item.Name,
+				Zone:       zone,
+				Project:    project,
+				TargetSize: item.TargetSize,
+			}
+			groups = append(groups, group)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return groups, nil
+}
+
+func (g *gce) ListGroupInstances(ctx context.Context, project, zone, group string) ([]string, error) {
+	resp, err := g.svc.InstanceGroupManagers.ListManagedInstances(project, zone, group).Context(ctx).Do()
+	if err != nil {
+		return nil, convertError(err)
+	}
+	names := make([]string, 0, len(resp.ManagedInstances))
+	for _, item := range resp.ManagedInstances {
+		names = append(names, path.Base(item.Instance))
+	}
+	return names, nil
+}
+
+func (g *gce) ResizeInstanceGroup(ctx context.Context, project, zone, group string, size int64) error {
+	return g.operation(ctx, project)(g.svc.InstanceGroupManagers.Resize(project, zone, group, size).Context(ctx).Do())
+}
+
+func (g *gce) AbandonGroupInstances(ctx context.Context, project, zone, group string, instances []string) error {
+	return g.operation(ctx, project)(g.svc.InstanceGroupManagers.AbandonInstances(project, zone, group, &compute.InstanceGroupManagersAbandonInstancesRequest{
+		Instances: instanceURLs(zone, instances),
+	}).Context(ctx).Do())
+}
+
+func (g *gce) RecreateGroupInstances(ctx context.Context, project, zone, group string, instances []string) error {
+	return g.operation(ctx, project)(g.svc.InstanceGroupManagers.RecreateInstances(project, zone, group, &compute.InstanceGroupManagersRecreateInstancesRequest{
+		Instances: instanceURLs(zone, instances),
+	}).Context(ctx).Do())
+}
+
+// RestartInstanceGroup renames every version of the group so that a proactive update restarts each instance,
+// which is the same approach taken by gcloud's rolling-action restart.
+func (g *gce) RestartInstanceGroup(ctx context.Context, project, zone, group string) error {
+	current, err := g.svc.InstanceGroupManagers.Get(project, zone, group).Context(ctx).Do()
+	if err != nil {
+		return convertError(err)
+	}
+	policy := &compute.InstanceGroupManagerUpdatePolicy{}
+	if current.UpdatePolicy != nil {
+		*policy = *current.UpdatePolicy
+	}
+	policy.Type, policy.MinimalAction = "PROACTIVE", "RESTART"
+	versions := make([]*compute.InstanceGroupManagerVersion, 0, len(current.Versions))
+	stamp := time.Now().UTC().Format(time.RFC3339)
+	for _, v := range current.Versions {
+		version := *v
+		version.Name = "0/" + stamp
+		versions = append(versions, &version)
+	}
+	return g.operation(ctx, project)(g.svc.InstanceGroupManagers.Patch(project, zone, group, &compute.InstanceGroupManager{
+		UpdatePolicy: policy,
+		Versions:     versions,
+		Fingerprint:  current.Fingerprint,
+	}).Context(ctx).Do())
+}
+
+// rawGroupManager keeps the update policy as the exact JSON returned by the API so that
+// fields unknown to the compute client are put back as they were.
+type rawGroupManager struct {
+	Fingerprint  string          `json:"fingerprint,omitempty"`
+	UpdatePolicy json.RawMessage `json:"updatePolicy,omitempty"`
+}
+
+// defaultUpdatePolicy is what compute applies to a group created without an update policy
+var defaultUpdatePolicy = json.RawMessage(`{"type":"OPPORTUNISTIC","minimalAction":"REPLACE"}`)
+
+func (g *gce) GetGroupUpdatePolicy(ctx context.Context, project, zone, group string) (json.RawMessage, error) {
+	var raw rawGroupManager
+	if err := g.rest(ctx, http.MethodGet, groupManagerPath(project, zone, group), nil, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw.UpdatePolicy) == 0 {
+		return defaultUpdatePolicy, nil
+	}
+	return raw.UpdatePolicy, nil
+}
+
+func (g *gce) SetGroupUpdatePolicy(ctx context.Context, project, zone, group string, policy json.RawMessage) error {
+	var current rawGroupManager
+	if err := g.rest(ctx, http.MethodGet, groupManagerPath(project, zone, group), nil, &current); err != nil {
+		return err
+	}
+	var op compute.Operation
+	patch := rawGroupManager{Fingerprint: current.Fingerprint, UpdatePolicy: policy}
+	if err := g.rest(ctx, http.MethodPatch, groupManagerPath(project, zone, group), patch, &op); err != nil {
+		return err
+	}
+	return g.wait(ctx, project, &op, nil)
+}
+
+// groupManagerPath returns the path of the zonal instance group manager relative to the projects endpoint
+func groupManagerPath(project, zone, group string) string {
+	return fmt.Sprintf("%s/zones/%s/instanceGroupManagers/%s", project, zone, group)
+}
+
+func (g *gce) InsertFirewall(ctx context.Context, project string, rule *types.FirewallRule) error {
+	firewall := &compute.Firewall{
+		Direction:             rule.Direction,
+		Name:                  rule.Name,
+		Network:               rule.Network,
+		Priority:              rule.Priority,
+		TargetTags:            rule.TargetTags,
+		SourceTags:            rule.SourceTags,
+		SourceRanges:          rule.SourceRanges,
+		DestinationRanges:     rule.DestinationRanges,
+		TargetServiceAccounts: rule.TargetServiceAccounts,
+		// Priority 0 is the highest priority so it must always be sent
+		ForceSendFields: []string{"Priority"},
+	}
+	if rule.Log {
+		firewall.LogConfig = &compute.FirewallLogConfig{Enable: true}
+	}
+	for _, deny := range rule.Denied {
+		firewall.Denied = append(firewall.Denied, &compute.FirewallDenied{
+			IPProtocol: deny.Protocol,
+			Ports:      deny.Ports,
+		})
+	}
+	for _, allow := range rule.Allowed {
+		firewall.Allowed = append(firewall.Allowed, &compute.FirewallAllowed{
+			IPProtocol: allow.Protocol,
+			Ports:      allow.Ports,
+		})
+	}
+	return g.operation(ctx, project)(g.svc.Firewalls.Insert(project, firewall).Context(ctx).Do())
+}
+
+func (g *gce) DeleteFirewall(ctx context.Context, project, name string) error {
+	return g.operation(ctx, project)(g.svc.Firewalls.Delete(project, name).Context(ctx).Do())
+}
+
+func (g *gce) InsertRoute(ctx context.Context, project string, route *types.Route) error {
+	r := &compute.Route{
+		Name:            route.Name,
+		Network:         route.Network,
+		DestRange:       route.DestRange,
+		Priority:        route.Priority,
+		NextHopIp:       route.NextHopIp,
+		NextHopInstance: route.NextHopInstance,
+		// Priority 0 is the highest priority so it must always be sent
+		ForceSendFields: []string{"Priority"},
+	}
+	return g.operation(ctx, project)(g.svc.Routes.Insert(project, r).Context(ctx).Do())
+}
+
+func (g *gce) DeleteRoute(ctx context.Context, project, name string) error {
+	return g.operation(ctx, project)(g.svc.Routes.Delete(project, name).Context(ctx).Do())
+}
+
+// instanceURLs returns the partial URLs the instance group API expects to reference instances
+func instanceURLs(zone string, instances []string) []string {
+	urls := make([]string, 0, len(instances))
+	for _, name := range instances {
+		urls = append(urls, fmt.Sprintf("zones/%s/instances/%s", zone, name))
+	}
+	return urls
+}
+
+// convertInstance maps the compute representation into the internal one
+func convertInstance(project string, item *compute.Instance) (*types.Instance, error) {
+	combined := strings.Split(path.Base(item.Zone), "-")
+	if len(combined) != 3 {
+		return nil, errors.New("incorrect amount of values to use")
+	}
+	instance := &types.Instance{
+		Id:               item.Id,
+		Name:             item.Name,
+		Zone:             combined[2],
+		Region:           combined[0] + "-" + combined[1],
+		Project:          project,
+		Status:           item.Status,
+		Labels:           item.Labels,
+		LabelFingerprint: item.LabelFingerprint,
+	}
+	if item.Tags != nil {
+		instance.Tags = item.Tags.Items
+		instance.TagFingerprint = item.Tags.Fingerprint
+	}
+	if len(item.NetworkInterfaces) > 0 {
+		instance.InternalIP = item.NetworkInterfaces[0].NetworkIP
+	}
+	if item.Scheduling != nil {
+		instance.Scheduling.OnHostMaintenance = item.Scheduling.OnHostMaintenance
+		// Automatic restart is enabled unless it has been explicitly disabled
+		instance.Scheduling.AutomaticRestart = item.Scheduling.AutomaticRestart == nil || *item.Scheduling.AutomaticRestart
+	}
+	for _, disk := range item.Disks {
+		instance.Disks = append(instance.Disks, types.AttachedDisk{
+			Source:     disk.Source,
+			DeviceName: disk.DeviceName,
+			Mode:       disk.Mode,
+			Boot:       disk.Boot,
+			AutoDelete: disk.AutoDelete,
+		})
+	}
+	return instance, nil
+}
+
+// operationTimeout bounds how long an operation is waited on when the context has no deadline
+const operationTimeout = 10 * time.Minute
+
+// operationPoll is how often an operation is checked until it is done
+var operationPoll = 2 * time.Second
+
+// operation returns a func that waits for the zonal, regional or global operation to be done and converts the errors
+// it reported into a go error, so it can wrap the API call directly.
+// If the context ends first the operation could still be applied, so the error is wrapped as types.ErrUnfinished.
+func (g *gce) operation(ctx context.Context, project string) func(*compute.Operation, error) error {
+	return func(op *compute.Operation, err error) error {
+		return g.wait(ctx, project, op, err)
+	}
+}
+
+// bounded applies the operationTimeout to the context when it has no deadline
+func bounded(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, set := ctx.Deadline(); set {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, operationTimeout)
+}
+
+func (g *gce) wait(ctx context.Context, project string, op *compute.Operation, err error) error {
+	if err != nil {
+		return convertError(err)
+	}
+	if op == nil {
+		return nil
+	}
+	ctx, cancel := bounded(ctx)
+	defer cancel()
+	for op.Status != "DONE" {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: operation %s is %s: %v", types.ErrUnfinished, op.Name, op.Status, ctx.Err())
+		case <-time.After(operationPoll):
+		}
+		var next *compute.Operation
+		switch {
+		case op.Zone != "":
+			next, err = g.svc.ZoneOperations.Get(project, path.Base(op.Zone), op.Name).Context(ctx).Do()
+		case op.Region != "":
+			next, err = g.svc.RegionOperations.Get(project, path.Base(op.Region), op.Name).Context(ctx).Do()
+		default:
+			next, err = g.svc.GlobalOperations.Get(project, op.Name).Context(ctx).Do()
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return fmt.Errorf("%w: unable to check operation %s: %v", types.ErrUnfinished, op.Name, convertError(err))
+		}
+		op = next
+	}
+	if op.Error == nil {
+		return nil
+	}
+	msgs := make([]string, 0, len(op.Error.Errors))
+	for _, e := range op.Error.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", e.Code, e.Message))
+	}
+	return fmt.Errorf("operation %s failed: %s", op.Name, strings.Join(msgs, ", "))
+}
+
+// convertError maps the API errors into the provider errors where applicable
+func convertError(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.Code {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %v", types.ErrNotFound, err)
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("%w: %v", types.ErrConflict, err)
+	}
+	return err
+}
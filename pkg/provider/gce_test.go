@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// fakeCompute serves the operation returned by stopping an instance until it has been polled enough times to be done
+func fakeCompute(t *testing.T, polls int32, failure *compute.OperationError) (*gce, *int32) {
+	poll := operationPoll
+	operationPoll = time.Millisecond
+	t.Cleanup(func() { operationPoll = poll })
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := &compute.Operation{Name: "op-1", Zone: "https://compute/projects/p/zones/us-central1-a", Status: "RUNNING"}
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/stop"):
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/zones/us-central1-a/operations/op-1"):
+			if atomic.AddInt32(&count, 1) >= polls {
+				op.Status, op.Error = "DONE", failure
+			}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(op)
+	}))
+	t.Cleanup(srv.Close)
+	svc, err := compute.New(srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.BasePath = srv.URL + "/"
+	return &gce{svc: svc}, &count
+}
+
+func TestOperationWaitsUntilDone(t *testing.T) {
+	g, count := fakeCompute(t, 2, nil)
+	if err := g.StopInstance(context.Background(), "p", "us-central1-a", "vm"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *count != 2 {
+		t.Errorf("operation was polled %d times, want 2", *count)
+	}
+}
+
+func TestOperationReportsFailure(t *testing.T) {
+	g, _ := fakeCompute(t, 1, &compute.OperationError{Errors: []*compute.OperationErrorErrors{{Code: "QUOTA_EXCEEDED", Message: "no"}}})
+	err := g.StopInstance(context.Background(), "p", "us-central1-a", "vm")
+	if err == nil || !strings.Contains(err.Error(), "QUOTA_EXCEEDED") {
+		t.Fatalf("expected the operation error, got %v", err)
+	}
+}
+
+func TestOperationUnfinishedAtDeadline(t *testing.T) {
+	g, _ := fakeCompute(t, 1000, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := g.StopInstance(ctx, "p", "us-central1-a", "vm"); !errors.Is(err, types.ErrUnfinished) {
+		t.Fatalf("expected an unfinished operation, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+func (g *gce) ListNodePools(ctx context.Context, project, location, cluster string) ([]*types.NodePool, error) {
+	resp, err := g.gke.Projects.Locations.Clusters.NodePools.List(clusterName(project, location, cluster)).Context(ctx).Do()
+	if err != nil {
+		return nil, convertError(err)
+	}
+	pools := make([]*types.NodePool, 0, len(resp.NodePools))
+	for _, item := range resp.NodePools {
+		pool := &types.NodePool{
+			Name:     item.Name,
+			Cluster:  cluster,
+			Location: location,
+			Project:  project,
+		}
+		for _, u := range item.InstanceGroupUrls {
+			// The urls reference the instance group manager as .../zones/<zone>/instanceGroupManagers/<name>
+			parts := strings.Split(u, "/")
+			if len(parts) < 4 {
+				return nil, fmt.Errorf("unexpected instance group url %s", u)
+			}
+			zone, name := parts[len(parts)-3], parts[len(parts)-1]
+			manager, err := g.svc.InstanceGroupManagers.Get(project, zone, name).Context(ctx).Do()
+			if err != nil {
+				return nil, convertError(err)
+			}
+			pool.Groups = append(pool.Groups, &types.InstanceGroup{
+				Name:       name,
+				Zone:       zone,
+				Project:    project,
+				TargetSize: manager.TargetSize,
+			})
+			if manager.TargetSize > pool.NodeCount {
+				pool.NodeCount = manager.TargetSize
+			}
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+func (g *gce) ResizeNodePool(ctx context.Context, project, location, cluster, pool string, size int64) error {
+	name := clusterName(project, location, cluster) + "/nodePools/" + pool
+	return g.gkeOperation(ctx, project, location)(g.gke.Projects.Locations.Clusters.NodePools.SetSize(name, &container.SetNodePoolSizeRequest{
+		NodeCount: size,
+		// Shrinking to zero nodes is valid so the count must always be sent
+		ForceSendFields: []string{"NodeCount"},
+	}).Context(ctx).Do())
+}
+
+// gkeOperation returns a func that waits for the GKE operation to be done and converts an aborted operation
+// into a go error, an operation still running once the context ends is wrapped as types.ErrUnfinished.
+func (g *gce) gkeOperation(ctx context.Context, project, location string) func(*container.Operation, error) error {
+	return func(op *container.Operation, err error) error {
+		if err != nil {
+			return convertError(err)
+		}
+		if op == nil {
+			return nil
+		}
+		ctx, cancel := bounded(ctx)
+		defer cancel()
+		for op.Status != "DONE" && op.Status != "ABORTING" {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w: operation %s is %s: %v", types.ErrUnfinished, op.Name, op.Status, ctx.Err())
+			case <-time.After(operationPoll):
+			}
+			name := fmt.Sprintf("projects/%s/locations/%s/operations/%s", project, location, op.Name)
+			next, err := g.gke.Projects.Locations.Operations.Get(name).Context(ctx).Do()
+			if err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+				return fmt.Errorf("%w: unable to check operation %s: %v", types.ErrUnfinished, op.Name, convertError(err))
+			}
+			op = next
+		}
+		if op.Status == "ABORTING" {
+			return fmt.Errorf("operation %s failed: %s", op.Name, op.StatusMessage)
+		}
+		return nil
+	}
+}
+
+func (g *gce) SetNodeSchedulable(ctx context.Context, project, location, cluster, node string, schedulable bool) error {
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{"unschedulable": !schedulable},
+	}
+	return g.kubernetes(ctx, project, location, cluster, http.MethodPatch, "/api/v1/nodes/"+node, patch, nil)
+}
+
+func (g *gce) DrainNode(ctx context.Context, project, location, cluster, node string) error {
+	var pods struct {
+		Items []struct {
+			Metadata struct {
+				Name            string            `json:"name"`
+				Namespace       string            `json:"namespace"`
+				Annotations     map[string]string `json:"annotations"`
+				OwnerReferences []struct {
+					Kind string `json:"kind"`
+				} `json:"ownerReferences"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	query := "/api/v1/pods?fieldSelector=" + url.QueryEscape("spec.nodeName="+node)
+	if err := g.kubernetes(ctx, project, location, cluster, http.MethodGet, query, nil, &pods); err != nil {
+		return err
+	}
+	var failed []string
+	for _, pod := range pods.Items {
+		meta := pod.Metadata
+		// Daemon set and static pods would be recreated on the same node so they are left alone, as kubectl drain does
+		if _, mirror := meta.Annotations["kubernetes.io/config.mirror"]; mirror {
+			continue
+		}
+		daemon := false
+		for _, owner := range meta.OwnerReferences {
+			daemon = daemon || owner.Kind == "DaemonSet"
+		}
+		if daemon {
+			continue
+		}
+		eviction := map[string]interface{}{
+			"apiVersion": "policy/v1",
+			"kind":       "Eviction",
+			"metadata":   map[string]string{"name": meta.Name, "namespace": meta.Namespace},
+		}
+		path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/eviction", meta.Namespace, meta.Name)
+		if err := g.kubernetes(ctx, project, location, cluster, http.MethodPost, path, eviction, nil); err != nil {
+			failed = append(failed, fmt.Sprintf("%s/%s: %v", meta.Namespace, meta.Name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to evict pods from %s: %s", node, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// clusterClient is the API server endpoint of a cluster with a client that trusts its certificate
+type clusterClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+// cluster returns the client for the cluster's API server, it is only built once per cluster
+// since looking up the cluster and creating the transport is too costly to repeat for every request.
+func (g *gce) cluster(ctx context.Context, project, location, cluster string) (*clusterClient, error) {
+	name := clusterName(project, location, cluster)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if cc, exist := g.clusters[name]; exist {
+		return cc, nil
+	}
+	c, err := g.gke.Projects.Locations.Clusters.Get(name).Context(ctx).Do()
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if c.MasterAuth == nil {
+		return nil, fmt.Errorf("cluster %s has no master auth", cluster)
+	}
+	ca, err := base64.StdEncoding.DecodeString(c.MasterAuth.ClusterCaCertificate)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("cluster %s has an invalid certificate", cluster)
+	}
+	// The transport outlives the request so it must not be bound to its context
+	transport, err := htransport.NewTransport(context.Background(), &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+		option.WithScopes("https://www.googleapis.com/auth/cloud-platform"))
+	if err != nil {
+		return nil, err
+	}
+	if g.clusters == nil {
+		g.clusters = make(map[string]*clusterClient)
+	}
+	cc := &clusterClient{endpoint: c.Endpoint, client: &http.Client{Transport: transport}}
+	g.clusters[name] = cc
+	return cc, nil
+}
+
+// kubernetes makes a request against the cluster's API server authenticated with the default credentials,
+// the response is decoded into out when provided.
+func (g *gce) kubernetes(ctx context.Context, project, location, cluster, method, path string, body, out interface{}) error {
+	c, err := g.cluster(ctx, project, location, cluster)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, "https://"+c.endpoint+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if method == http.MethodPatch {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", types.ErrNotFound, path)
+	case resp.StatusCode == http.StatusConflict:
+		return fmt.Errorf("%w: %s", types.ErrConflict, path)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("blocked by a pod disruption budget")
+	case resp.StatusCode >= 300:
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("kubernetes responded %s: %s", resp.Status, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func clusterName(project, location, cluster string) string {
+	return fmt.Sprintf("projects/%s/locations/%s/clusters/%s", project, location, cluster)
+}
@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"google.golang.org/api/container/v1"
+)
+
+// fakeGKE serves the operation returned by resizing a node pool until it has been polled enough times to end in status
+func fakeGKE(t *testing.T, polls int32, status string) (*gce, *int32) {
+	poll := operationPoll
+	operationPoll = time.Millisecond
+	t.Cleanup(func() { operationPoll = poll })
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := &container.Operation{Name: "op-1", Status: "RUNNING"}
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/clusters/c/nodePools/pool:setSize"):
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/projects/p/locations/us-central1/operations/op-1"):
+			if atomic.AddInt32(&count, 1) >= polls {
+				op.Status, op.StatusMessage = status, "resize failed"
+			}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(op)
+	}))
+	t.Cleanup(srv.Close)
+	svc, err := container.New(srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.BasePath = srv.URL + "/"
+	return &gce{gke: svc}, &count
+}
+
+func TestGKEOperationWaitsUntilDone(t *testing.T) {
+	g, count := fakeGKE(t, 2, "DONE")
+	if err := g.ResizeNodePool(context.Background(), "p", "us-central1", "c", "pool", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *count != 2 {
+		t.Errorf("operation was polled %d times, want 2", *count)
+	}
+}
+
+func TestGKEOperationReportsFailure(t *testing.T) {
+	g, _ := fakeGKE(t, 1, "ABORTING")
+	err := g.ResizeNodePool(context.Background(), "p", "us-central1", "c", "pool", 0)
+	if err == nil || !strings.Contains(err.Error(), "resize failed") {
+		t.Fatalf("expected the operation error, got %v", err)
+	}
+}
+
+func TestGKEOperationUnfinishedAtDeadline(t *testing.T) {
+	g, _ := fakeGKE(t, 1000, "DONE")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := g.ResizeNodePool(ctx, "p", "us-central1", "c", "pool", 0); !errors.Is(err, types.ErrUnfinished) {
+		t.Fatalf("expected an unfinished operation, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iam/v1"
+	oauth2 "google.golang.org/api/oauth2/v2"
+	"google.golang.org/api/option"
+)
+
+func (g *gce) Identity(ctx context.Context) (string, error) {
+	svc, err := oauth2.NewService(ctx, option.WithScopes(oauth2.UserinfoEmailScope))
+	if err != nil {
+		return "", err
+	}
+	info, err := svc.Userinfo.Get().Context(ctx).Do()
+	if err != nil {
+		return "", convertError(err)
+	}
+	if info.Email == "" {
+		return "", fmt.Errorf("unable to determine the email of the default credentials")
+	}
+	if strings.HasSuffix(info.Email, ".gserviceaccount.com") {
+		return "serviceAccount:" + info.Email, nil
+	}
+	return "user:" + info.Email, nil
+}
+
+func (g *gce) GetIamPolicy(ctx context.Context, project string) (*types.Policy, error) {
+	// The generated client can't request a policy version, without version 3 the conditional bindings aren't
+	// returned as they are so setting the policy back would lose their conditions.
+	req := map[string]interface{}{
+		"options": map[string]int{"requestedPolicyVersion": 3},
+	}
+	var resp cloudresourcemanager.Policy
+	if err := g.request(ctx, http.MethodPost, g.crm.BasePath+"v1/projects/"+project+":getIamPolicy", req, &resp); err != nil {
+		return nil, err
+	}
+	policy := &types.Policy{
+		Project: project,
+		Etag:    resp.Etag,
+	}
+	for _, item := range resp.Bindings {
+		binding := types.Binding{
+			Role:    item.Role,
+			Members: item.Members,
+		}
+		if item.Condition != nil {
+			condition, err := json.Marshal(item.Condition)
+			if err != nil {
+				return nil, err
+			}
+			binding.Condition = condition
+		}
+		policy.Bindings = append(policy.Bindings, binding)
+	}
+	return policy, nil
+}
+
+func (g *gce) SetIamBindings(ctx context.Context, project string, bindings []types.Binding, etag string) error {
+	policy := &cloudresourcemanager.Policy{
+		Etag:     etag,
+		Bindings: make([]*cloudresourcemanager.Binding, 0, len(bindings)),
+	}
+	for _, b := range bindings {
+		binding := &cloudresourcemanager.Binding{
+			Role:    b.Role,
+			Members: b.Members,
+		}
+		if len(b.Condition) > 0 {
+			binding.Condition = &cloudresourcemanager.Expr{}
+			if err := json.Unmarshal(b.Condition, binding.Condition); err != nil {
+				return err
+			}
+			// Conditional bindings are only accepted by version 3 policies
+			policy.Version = 3
+		}
+		policy.Bindings = append(policy.Bindings, binding)
+	}
+	_, err := g.crm.Projects.SetIamPolicy(project, &cloudresourcemanager.SetIamPolicyRequest{
+		Policy: policy,
+		// Only the bindings are replaced so the audit configuration is left as it is
+		UpdateMask: "bindings,etag",
+	}).Context(ctx).Do()
+	return iamError(err)
+}
+
+func (g *gce) RolePermissions(ctx context.Context, role string) ([]string, error) {
+	svc, err := iam.NewService(ctx, option.WithScopes(iam.CloudPlatformScope))
+	if err != nil {
+		return nil, err
+	}
+	var resp *iam.Role
+	// Custom roles are named after the project or organisation that defines them
+	switch {
+	case strings.HasPrefix(role, "projects/"):
+		resp, err = svc.Projects.Roles.Get(role).Context(ctx).Do()
+	case strings.HasPrefix(role, "organizations/"):
+		resp, err = svc.Organizations.Roles.Get(role).Context(ctx).Do()
+	default:
+		resp, err = svc.Roles.Get(role).Context(ctx).Do()
+	}
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return resp.IncludedPermissions, nil
+}
+
+// iamError converts the error the same as any other api, other than IAM reporting a stale etag as a conflict
+func iamError(err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict {
+		return fmt.Errorf("%w: %v", types.ErrConflict, err)
+	}
+	return convertError(err)
+}
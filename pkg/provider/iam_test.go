@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+func TestGetIamPolicyRequestsVersion3(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Options struct {
+				RequestedPolicyVersion int `json:"requestedPolicyVersion"`
+			} `json:"options"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Options.RequestedPolicyVersion != 3 {
+			t.Errorf("requested %+v with %v, want version 3", req, err)
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/projects/p:getIamPolicy" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"version":3,"etag":"e","bindings":[
+			{"role":"roles/viewer","members":["user:a@example.com"]},
+			{"role":"roles/editor","members":["user:b@example.com"],"condition":{"title":"expiry","expression":"request.time < timestamp('2030-01-01T00:00:00Z')"}}
+		]}`))
+	}))
+	defer srv.Close()
+	crm, err := cloudresourcemanager.New(srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crm.BasePath = srv.URL + "/"
+	g := &gce{crm: crm, client: srv.Client()}
+	policy, err := g.GetIamPolicy(context.Background(), "p")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.Etag != "e" || len(policy.Bindings) != 2 {
+		t.Fatalf("policy %+v, want both bindings", policy)
+	}
+	if len(policy.Bindings[0].Condition) != 0 || len(policy.Bindings[1].Condition) == 0 {
+		t.Errorf("bindings %+v, want only the editor binding to keep its condition", policy.Bindings)
+	}
+}
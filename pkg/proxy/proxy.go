@@ -0,0 +1,283 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+const bufferSize = 32 * 1024
+
+var (
+	registryLock sync.Mutex
+	registry     = make(map[string]*Proxy)
+)
+
+// Proxy forwards every connection accepted on the listen address to the upstream,
+// degrading the data passing through with the faults of the handle holding it.
+type Proxy struct {
+	lock     sync.Mutex
+	log      *zap.Logger
+	listen   string
+	upstream string
+	listener net.Listener
+	faults   types.ProxyFaults
+	holder   *Handle
+	links    map[*link]struct{}
+	// refs is the number of open handles, guarded by the registryLock
+	refs int
+}
+
+// Handle is one user's reference to a shared proxy, the proxy stops listening once every handle is closed
+type Handle struct {
+	proxy *Proxy
+	once  sync.Once
+}
+
+// link is a client connection paired with its upstream connection
+type link struct {
+	client, upstream net.Conn
+	once             sync.Once
+	closed           chan struct{}
+}
+
+// Open returns a handle to the proxy already listening on the address or starts a new one,
+// proxies are shared so that every step using the address forwards the same connections.
+func Open(log *zap.Logger, listen, upstream string) (*Handle, error) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if p, exist := registry[listen]; exist {
+		if p.upstream != upstream {
+			return nil, fmt.Errorf("proxy %s already forwards to %s", listen, p.upstream)
+		}
+		p.refs++
+		return &Handle{proxy: p}, nil
+	}
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+	p := &Proxy{
+		log:      log,
+		listen:   listen,
+		upstream: upstream,
+		listener: listener,
+		links:    make(map[*link]struct{}),
+		refs:     1,
+	}
+	registry[listen] = p
+	go p.accept()
+	return &Handle{proxy: p}, nil
+}
+
+// SetFaults replaces the faults applied to new and existing connections, only one handle can degrade
+// the proxy at a time so concurrent users don't replace or clear each other's faults.
+func (h *Handle) SetFaults(faults types.ProxyFaults) error {
+	p := h.proxy
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.holder != nil && p.holder != h {
+		return fmt.Errorf("proxy %s is already degraded by another step", p.listen)
+	}
+	p.holder, p.faults = h, faults
+	return nil
+}
+
+// Clear removes the handle's faults so connections are forwarded unchanged
+func (h *Handle) Clear() {
+	p := h.proxy
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.holder == h {
+		p.holder, p.faults = nil, types.ProxyFaults{}
+	}
+}
+
+// Close clears the handle's faults and releases it, the last handle to close stops the proxy
+func (h *Handle) Close() (err error) {
+	h.once.Do(func() {
+		h.Clear()
+		p := h.proxy
+		registryLock.Lock()
+		p.refs--
+		last := p.refs == 0
+		if last {
+			delete(registry, p.listen)
+		}
+		registryLock.Unlock()
+		if last {
+			err = p.close()
+		}
+	})
+	return err
+}
+
+// close stops listening and closes every connection
+func (p *Proxy) close() error {
+	err := p.listener.Close()
+	p.lock.Lock()
+	links := make([]*link, 0, len(p.links))
+	for l := range p.links {
+		links = append(links, l)
+	}
+	p.lock.Unlock()
+	for _, l := range links {
+		p.drop(l)
+	}
+	return err
+}
+
+func (p *Proxy) current() types.ProxyFaults {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.faults
+}
+
+func (p *Proxy) accept() {
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				p.log.Error("Proxy stopped accepting connections", zap.String("listen", p.listen), zap.Error(err))
+			}
+			return
+		}
+		go p.serve(client)
+	}
+}
+
+func (p *Proxy) serve(client net.Conn) {
+	if f := p.current(); f.Reset > 0 && rand.Float64()*100 < f.Reset {
+		reset(client)
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", p.upstream, 10*time.Second)
+	if err != nil {
+		p.log.Warn("Unable to connect to upstream", zap.String("upstream", p.upstream), zap.Error(err))
+		reset(client)
+		return
+	}
+	l := &link{client: client, upstream: upstream, closed: make(chan struct{})}
+	p.lock.Lock()
+	p.links[l] = struct{}{}
+	p.lock.Unlock()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.pipe(l, upstream, client, types.ProxyUpstream)
+	}()
+	go func() {
+		defer wg.Done()
+		p.pipe(l, client, upstream, types.ProxyDownstream)
+	}()
+	wg.Wait()
+	p.drop(l)
+}
+
+// pipe forwards everything read from src to dst, applying the faults that affect the direction to each read
+func (p *Proxy) pipe(l *link, dst, src net.Conn, direction string) {
+	buf := make([]byte, bufferSize)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			f := p.current()
+			if !f.Affects(direction) {
+				f = types.ProxyFaults{}
+			}
+			if f.Timeout > 0 {
+				// The data is swallowed and the connection left hanging until it times out
+				l.sleep(f.Timeout)
+				p.drop(l)
+				return
+			}
+			if !p.forward(l, dst, buf[:n], f) {
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				p.drop(l)
+				return
+			}
+			// Half close so the other direction can finish sending
+			if tcp, ok := dst.(*net.TCPConn); ok {
+				tcp.CloseWrite()
+			}
+			return
+		}
+	}
+}
+
+// forward writes the data to dst in slices with the latency and bandwidth applied, reporting if the link is still open
+func (p *Proxy) forward(l *link, dst net.Conn, data []byte, f types.ProxyFaults) bool {
+	delay := f.Latency
+	if f.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(f.Jitter)))
+	}
+	if !l.sleep(delay) {
+		return false
+	}
+	for len(data) > 0 {
+		size := len(data)
+		if f.SliceSize > 0 && f.SliceSize < size {
+			size = f.SliceSize
+		}
+		chunk := data[:size]
+		data = data[size:]
+		if f.Bandwidth > 0 && !l.sleep(time.Duration(int64(len(chunk))*int64(time.Second)/(f.Bandwidth*1024))) {
+			return false
+		}
+		if _, err := dst.Write(chunk); err != nil {
+			p.drop(l)
+			return false
+		}
+		if len(data) > 0 && !l.sleep(f.SliceDelay) {
+			return false
+		}
+	}
+	return true
+}
+
+// drop closes both sides of the link and forgets about it
+func (p *Proxy) drop(l *link) {
+	l.once.Do(func() {
+		close(l.closed)
+		l.client.Close()
+		l.upstream.Close()
+	})
+	p.lock.Lock()
+	delete(p.links, l)
+	p.lock.Unlock()
+}
+
+// sleep waits for the duration, returning false when the link was closed first
+func (l *link) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-l.closed:
+		return false
+	}
+}
+
+// reset closes the connection with a RST rather than a FIN
+func reset(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// echo starts an upstream that writes back every line it reads
+func echo(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// open starts a proxy to the upstream on a free port, returning the handle and the address it listens on.
+// Proxies are registered by their listen address so the port is chosen up front.
+func open(t *testing.T, upstream string) (*Handle, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+	h, err := Open(zap.NewNop(), address, upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h, address
+}
+
+// roundTrip sends a line through the proxy and returns how long it took to be echoed back
+func roundTrip(t *testing.T, address string) (time.Duration, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		return 0, err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	if line != "ping\n" {
+		t.Errorf("received %q, want the line echoed back", line)
+	}
+	return time.Since(start), nil
+}
+
+func TestProxyForwards(t *testing.T) {
+	_, address := open(t, echo(t))
+	if _, err := roundTrip(t, address); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestProxyAddsLatency(t *testing.T) {
+	h, address := open(t, echo(t))
+	if err := h.SetFaults(types.ProxyFaults{Latency: 50 * time.Millisecond, Direction: types.ProxyUpstream}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	took, err := roundTrip(t, address)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if took < 50*time.Millisecond {
+		t.Errorf("round trip took %v, want at least the latency", took)
+	}
+	h.Clear()
+	if took, err = roundTrip(t, address); err != nil || took >= 50*time.Millisecond {
+		t.Errorf("round trip took %v with error %v once cleared, want no latency", took, err)
+	}
+}
+
+func TestProxyResetsConnections(t *testing.T) {
+	h, address := open(t, echo(t))
+	if err := h.SetFaults(types.ProxyFaults{Reset: 100}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := roundTrip(t, address); err == nil {
+		t.Error("connection should have been reset")
+	}
+}
+
+func TestProxyTimesOutConnections(t *testing.T) {
+	h, address := open(t, echo(t))
+	if err := h.SetFaults(types.ProxyFaults{Timeout: 20 * time.Millisecond}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := roundTrip(t, address); err == nil {
+		t.Error("connection should have been closed without echoing")
+	}
+}
+
+func TestOpenRejectsDifferentUpstream(t *testing.T) {
+	_, address := open(t, echo(t))
+	h, err := Open(zap.NewNop(), address, echo(t))
+	if err == nil {
+		h.Close()
+		t.Error("opening the address with another upstream should fail")
+	}
+}
+
+func TestHandlesShareProxy(t *testing.T) {
+	upstream := echo(t)
+	first, address := open(t, upstream)
+	second, err := Open(zap.NewNop(), address, upstream)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := first.SetFaults(types.ProxyFaults{Latency: time.Millisecond}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := second.SetFaults(types.ProxyFaults{Reset: 100}); err == nil {
+		t.Error("a second handle should not replace the faults of the first")
+	}
+	// Clearing or closing the second handle must leave the first's faults alone
+	second.Clear()
+	if f := first.proxy.current(); f.Latency != time.Millisecond {
+		t.Errorf("faults %+v, want the first handle's faults kept", f)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := roundTrip(t, address); err != nil {
+		t.Fatalf("proxy should keep forwarding while the second handle is open: %v", err)
+	}
+	if err := second.SetFaults(types.ProxyFaults{Reset: 100}); err != nil {
+		t.Errorf("the second handle should degrade the proxy once the first is closed: %v", err)
+	}
+	if err := second.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conn, err := net.Dial("tcp", address); err == nil {
+		conn.Close()
+		t.Error("proxy should stop listening once every handle is closed")
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, exist := registry[address]; exist {
+		t.Error("closed proxy is still registered")
+	}
+}
@@ -0,0 +1,214 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+const (
+	// Markdown renders the report to be pasted into documents
+	Markdown = "markdown"
+	// HTML renders the report as a standalone page
+	HTML = "html"
+	// JSON renders the report to be consumed by other tools
+	JSON = "json"
+)
+
+// FormatFromPath returns the format implied by the file extension, defaulting to markdown
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return HTML
+	case ".json":
+		return JSON
+	default:
+		return Markdown
+	}
+}
+
+// Write renders the game day report of the result in the requested format
+func Write(w io.Writer, format string, result *types.PlanResult) error {
+	switch format {
+	case Markdown, "md":
+		return markdown.Execute(w, result)
+	case HTML:
+		return html.Execute(w, result)
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	default:
+		return fmt.Errorf("unknown report format %s", format)
+	}
+}
+
+var funcs = map[string]interface{}{
+	"timestamp": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+	"duration": func(start, end time.Time) string {
+		if start.IsZero() || end.IsZero() {
+			return "-"
+		}
+		return end.Sub(start).Round(time.Second).String()
+	},
+	"status": func(step types.StepResult) string {
+		switch {
+		case step.Aborted:
+			return "aborted"
+		case step.Error != "":
+			return "failed"
+		default:
+			return "completed"
+		}
+	},
+	"restored": func(o types.Outcome) string {
+		if o.Error != "" {
+			return "failed"
+		}
+		return "restored"
+	},
+	"probe": func(p types.ProbeResult) string {
+		if p.Ok {
+			return "pass"
+		}
+		return "fail"
+	},
+	// cell ensures the value does not break the markdown table it is placed within
+	"cell": func(s string) string {
+		return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+	},
+}
+
+var markdown = template.Must(template.New("markdown").Funcs(funcs).Parse(`# Game day report
+
+| Mode | Started | Finished | Duration |
+|------|---------|----------|----------|
+| {{ .Mode }} | {{ timestamp .Start }} | {{ timestamp .End }} | {{ duration .Start .End }} |
+
+## Timeline
+
+| Step | Started | Finished | Duration | Status |
+|------|---------|----------|----------|--------|
+{{- range .Steps }}
+| {{ cell .Name }} | {{ timestamp .Start }} | {{ timestamp .End }} | {{ duration .Start .End }} | {{ status . }} |
+{{- end }}
+{{ range .Steps }}
+## {{ .Name }}
+
+{{ .Description }}
+
+Sampling seed: ` + "`{{ .Seed }}`" + `
+{{ if .Error }}
+**{{ status . }}:** {{ .Error }}
+{{ end }}
+{{- range .Minions }}
+### Minion ` + "`{{ .Minion }}`" + `
+{{ if .Error }}
+**error:** {{ .Error }}
+{{ end }}
+| Resource | Kind | Project | Zone | Outcome | Action | Detail |
+|----------|------|---------|------|---------|--------|--------|
+{{- range .Affected }}
+| {{ .Name }} | {{ .Kind }} | {{ .Project }} | {{ .Zone }} | affected | {{ .Action }} | |
+{{- end }}
+{{- range .Failed }}
+| {{ .Name }} | {{ .Kind }} | {{ .Project }} | {{ .Zone }} | failed | {{ .Action }} | {{ cell .Error }} |
+{{- end }}
+{{- range .Skipped }}
+| {{ .Name }} | {{ .Kind }} | {{ .Project }} | {{ .Zone }} | skipped | | {{ cell .Reason }} |
+{{- end }}
+{{- range .Restored }}
+| {{ .Name }} | {{ .Kind }} | {{ .Project }} | {{ .Zone }} | {{ restored . }} | {{ .Action }} | {{ cell .Error }} |
+{{- end }}
+{{ end }}
+{{- if .Probes }}
+### Probes
+
+| Probe | Phase | Time | Latency | Result | Detail |
+|-------|-------|------|---------|--------|--------|
+{{- range .Probes }}
+| {{ cell .Probe }} | {{ .Phase }} | {{ timestamp .Time }} | {{ .Latency }} | {{ probe . }} | {{ cell .Error }} |
+{{- end }}
+{{ end }}
+{{- end }}`))
+
+var html = htmltemplate.Must(htmltemplate.New("html").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Game day report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #f3f3f3; }
+.failed, .aborted, .fail { color: #b00020; }
+.completed, .restored, .pass { color: #1b5e20; }
+</style>
+</head>
+<body>
+<h1>Game day report</h1>
+<table>
+<tr><th>Mode</th><th>Started</th><th>Finished</th><th>Duration</th></tr>
+<tr><td>{{ .Mode }}</td><td>{{ timestamp .Start }}</td><td>{{ timestamp .End }}</td><td>{{ duration .Start .End }}</td></tr>
+</table>
+<h2>Timeline</h2>
+<table>
+<tr><th>Step</th><th>Started</th><th>Finished</th><th>Duration</th><th>Status</th></tr>
+{{- range .Steps }}
+<tr><td>{{ .Name }}</td><td>{{ timestamp .Start }}</td><td>{{ timestamp .End }}</td><td>{{ duration .Start .End }}</td><td class="{{ status . }}">{{ status . }}</td></tr>
+{{- end }}
+</table>
+{{- range .Steps }}
+<h2>{{ .Name }}</h2>
+<p>{{ .Description }}</p>
+<p>Sampling seed: <code>{{ .Seed }}</code></p>
+{{- if .Error }}
+<p class="{{ status . }}"><strong>{{ status . }}:</strong> {{ .Error }}</p>
+{{- end }}
+{{- range .Minions }}
+<h3>Minion <code>{{ .Minion }}</code></h3>
+{{- if .Error }}
+<p class="failed"><strong>error:</strong> {{ .Error }}</p>
+{{- end }}
+<table>
+<tr><th>Resource</th><th>Kind</th><th>Project</th><th>Zone</th><th>Outcome</th><th>Action</th><th>Detail</th></tr>
+{{- range .Affected }}
+<tr><td>{{ .Name }}</td><td>{{ .Kind }}</td><td>{{ .Project }}</td><td>{{ .Zone }}</td><td>affected</td><td>{{ .Action }}</td><td></td></tr>
+{{- end }}
+{{- range .Failed }}
+<tr><td>{{ .Name }}</td><td>{{ .Kind }}</td><td>{{ .Project }}</td><td>{{ .Zone }}</td><td class="failed">failed</td><td>{{ .Action }}</td><td>{{ .Error }}</td></tr>
+{{- end }}
+{{- range .Skipped }}
+<tr><td>{{ .Name }}</td><td>{{ .Kind }}</td><td>{{ .Project }}</td><td>{{ .Zone }}</td><td>skipped</td><td></td><td>{{ .Reason }}</td></tr>
+{{- end }}
+{{- range .Restored }}
+<tr><td>{{ .Name }}</td><td>{{ .Kind }}</td><td>{{ .Project }}</td><td>{{ .Zone }}</td><td class="{{ restored . }}">{{ restored . }}</td><td>{{ .Action }}</td><td>{{ .Error }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Probes }}
+<h3>Probes</h3>
+<table>
+<tr><th>Probe</th><th>Phase</th><th>Time</th><th>Latency</th><th>Result</th><th>Detail</th></tr>
+{{- range .Probes }}
+<tr><td>{{ .Probe }}</td><td>{{ .Phase }}</td><td>{{ timestamp .Time }}</td><td>{{ .Latency }}</td><td class="{{ probe . }}">{{ probe . }}</td><td>{{ .Error }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- end }}
+</body>
+</html>
+`))
@@ -0,0 +1,108 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+)
+
+func result() *types.PlanResult {
+	start := time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)
+	instance := types.Resource{Kind: "instance", Project: "p", Zone: "us-central1-a", Name: "web-0"}
+	minion := types.MinionResult{Minion: "instance"}
+	minion.Affect(instance, "stop")
+	minion.Skip(types.Resource{Kind: "instance", Project: "p", Zone: "us-central1-a", Name: "db-0"}, "exclusion")
+	minion.Fail(types.Resource{Kind: "instance", Project: "p", Zone: "us-central1-b", Name: "web-1"}, "stop", errors.New("quota | exceeded"))
+	minion.Restored = []types.Outcome{types.Restore(instance, "start", nil)}
+	return &types.PlanResult{
+		Mode:  types.Repairable,
+		Start: start,
+		End:   start.Add(10 * time.Minute),
+		Steps: []types.StepResult{{
+			Name:        "stop <web>",
+			Description: "stop the web tier",
+			Start:       start,
+			End:         start.Add(5 * time.Minute),
+			Minions:     []types.MinionResult{minion},
+			Probes:      []types.ProbeResult{{Probe: "frontend", Phase: types.ProbeDuring, Time: start, Error: "unexpected status code 503"}},
+			Aborted:     true,
+			Error:       "steady state was breached while waiting",
+		}},
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"report.md":   Markdown,
+		"report":      Markdown,
+		"report.HTML": HTML,
+		"report.htm":  HTML,
+		"report.json": JSON,
+	} {
+		if got := FormatFromPath(path); got != want {
+			t.Errorf("FormatFromPath(%q) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, Markdown, result()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"| repairable | 2020-01-01T09:00:00Z | 2020-01-01T09:10:00Z | 10m0s |",
+		"| stop <web> | 2020-01-01T09:00:00Z | 2020-01-01T09:05:00Z | 5m0s | aborted |",
+		"**aborted:** steady state was breached while waiting",
+		"| web-0 | instance | p | us-central1-a | affected | stop | |",
+		"| db-0 | instance | p | us-central1-a | skipped | | exclusion |",
+		// The pipe would otherwise split the error across columns
+		`| web-1 | instance | p | us-central1-b | failed | stop | quota \| exceeded |`,
+		"| web-0 | instance | p | us-central1-a | restored | start |  |",
+		"| frontend | during | 2020-01-01T09:00:00Z | 0s | fail | unexpected status code 503 |",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteHTMLEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, HTML, result()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "<web>") || !strings.Contains(out, "stop &lt;web&gt;") {
+		t.Error("html should escape the step name")
+	}
+	if !strings.Contains(out, `<td class="aborted">aborted</td>`) {
+		t.Error("html is missing the step status")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, JSON, result()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded types.PlanResult
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(decoded.Steps) != 1 || len(decoded.Steps[0].Minions[0].Affected) != 1 {
+		t.Errorf("decoded %+v, want the step with its minion", decoded)
+	}
+}
+
+func TestWriteRejectsUnknownFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "pdf", result()); err == nil {
+		t.Error("an unknown format should fail")
+	}
+}
@@ -0,0 +1,349 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/metrics"
+	"github.com/MovieStoreGuy/skirmish/pkg/orchestra"
+	"github.com/MovieStoreGuy/skirmish/pkg/report"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// StateRunning is used while the plan is being executed
+	StateRunning = "running"
+	// StateFinished is used once every step of the plan has completed
+	StateFinished = "finished"
+	// StateFailed is used when the plan stopped due to an error
+	StateFailed = "failed"
+	// StateAborted is used when the plan was stopped through the API
+	StateAborted = "aborted"
+
+	// TokenEnv is the environment variable the server reads the token every request must bear from
+	TokenEnv = "SKIRMISH_SERVER_TOKEN"
+
+	// maxPlanSize limits the size of a submitted plan
+	maxPlanSize = 1 << 20
+)
+
+// Server exposes an HTTP API to submit, inspect and control game day executions
+type Server struct {
+	lock       sync.Mutex
+	ctx        context.Context
+	log        *zap.Logger
+	token      string
+	services   types.Services
+	executions map[string]*execution
+	order      []string
+}
+
+type execution struct {
+	id        string
+	plan      *types.Plan
+	runner    orchestra.Runner
+	submitted time.Time
+	state     string
+	err       error
+	result    *types.PlanResult
+}
+
+// Execution is the API representation of a submitted plan
+type Execution struct {
+	Id        string              `json:"id"`
+	State     string              `json:"state"`
+	Submitted time.Time           `json:"submitted"`
+	Error     string              `json:"error,omitempty"`
+	Plan      *types.Plan         `json:"plan,omitempty"`
+	Progress  *orchestra.Progress `json:"progress,omitempty"`
+}
+
+// New returns a server that will run every submitted plan against the services,
+// only accepting requests that bear the token.
+func New(ctx context.Context, log *zap.Logger, token string, services *types.Services) (*Server, error) {
+	if token == "" {
+		return nil, fmt.Errorf("server requires a token set with %s", TokenEnv)
+	}
+	return &Server{
+		ctx:        ctx,
+		log:        log,
+		token:      token,
+		services:   *services,
+		executions: make(map[string]*execution),
+	}, nil
+}
+
+// Handler returns the routes of the API, every request needs the token as a bearer token:
+//
+//	GET  /executions                list every execution
+//	POST /executions                submit a plan to execute
+//	GET  /executions/{id}           show the progress of an execution
+//	GET  /executions/{id}/report    render the game day report in the format query value, defaults to markdown
+//	POST /executions/{id}/pause     pause the current step's wait
+//	POST /executions/{id}/resume    resume the current step's wait
+//	POST /executions/{id}/extend    extend the current step's wait by the duration query value
+//	POST /executions/{id}/abort     abort the execution and restore everything straight away
+//	GET  /metrics                   prometheus metrics of all executions
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/executions", s.handleExecutions)
+	mux.HandleFunc("/executions/", s.handleExecution)
+	return s.authenticate(mux)
+}
+
+// Shutdown will abort every running execution so that they are restored
+func (s *Server) Shutdown() {
+	s.lock.Lock()
+	running := make([]*execution, 0, len(s.executions))
+	for _, e := range s.executions {
+		if e.state == StateRunning {
+			running = append(running, e)
+		}
+	}
+	s.lock.Unlock()
+	for _, e := range running {
+		s.abort(e)
+	}
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			fail(w, http.StatusUnauthorized, errors.New("invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleExecutions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.lock.Lock()
+		list := make([]Execution, 0, len(s.order))
+		for _, id := range s.order {
+			list = append(list, s.describe(s.executions[id], false))
+		}
+		s.lock.Unlock()
+		respond(w, http.StatusOK, list)
+	case http.MethodPost:
+		buff, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPlanSize))
+		if err != nil {
+			fail(w, http.StatusBadRequest, err)
+			return
+		}
+		plan, err := types.ParsePlan(buff)
+		if err != nil {
+			fail(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := rejectCommands(plan); err != nil {
+			fail(w, http.StatusBadRequest, err)
+			return
+		}
+		e, err := s.submit(plan)
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err)
+			return
+		}
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		respond(w, http.StatusCreated, s.describe(e, true))
+	default:
+		fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *Server) handleExecution(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/executions/"), "/"), "/")
+	s.lock.Lock()
+	e, exist := s.executions[parts[0]]
+	s.lock.Unlock()
+	if !exist {
+		fail(w, http.StatusNotFound, errors.New("no execution found"))
+		return
+	}
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		respond(w, http.StatusOK, s.describe(e, true))
+		return
+	}
+	if r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "report" {
+		s.report(w, r, e)
+		return
+	}
+	if r.Method != http.MethodPost || len(parts) != 2 {
+		fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	var err error
+	switch parts[1] {
+	case "pause":
+		err = e.runner.Pause()
+	case "resume":
+		err = e.runner.Resume()
+	case "extend":
+		var d time.Duration
+		if d, err = time.ParseDuration(r.URL.Query().Get("duration")); err == nil {
+			err = e.runner.Extend(d)
+		}
+	case "abort":
+		err = s.abort(e)
+	default:
+		fail(w, http.StatusNotFound, errors.New("unknown action "+parts[1]))
+		return
+	}
+	if err != nil {
+		fail(w, http.StatusConflict, err)
+		return
+	}
+	s.log.Info("Applied action to execution", zap.String("execution", e.id), zap.String("action", parts[1]))
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	respond(w, http.StatusOK, s.describe(e, true))
+}
+
+// report renders everything that has happened so far in the execution
+func (s *Server) report(w http.ResponseWriter, r *http.Request, e *execution) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = report.Markdown
+	}
+	p := e.runner.Progress()
+	result := p.Result
+	for _, running := range p.Running {
+		result.Steps = append(result.Steps, running.Step)
+	}
+	var buf bytes.Buffer
+	if err := report.Write(&buf, format, &result); err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	switch format {
+	case report.HTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	case report.JSON:
+		w.Header().Set("Content-Type", "application/json")
+	default:
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	}
+	w.Write(buf.Bytes())
+}
+
+// rejectCommands stops plans submitted over the API from running commands on the server's host,
+// command probes can only be used when running a plan from the command line.
+func rejectCommands(plan *types.Plan) error {
+	states := []types.SteadyState{plan.SteadyState}
+	for _, step := range plan.Steps {
+		states = append(states, step.SteadyState)
+	}
+	for _, state := range states {
+		for _, p := range state.Probes {
+			if p.Command != nil {
+				return fmt.Errorf("probe %s runs a command, which is not allowed over the API", p.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// submit will start executing the plan in the background
+func (s *Server) submit(plan *types.Plan) (*execution, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	services := s.services
+	runner, err := orchestra.NewRunner(ctx, cancel, s.log.With(zap.String("execution", id.String())), &services)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	e := &execution{
+		id:        id.String(),
+		plan:      plan,
+		runner:    runner,
+		submitted: time.Now(),
+		state:     StateRunning,
+	}
+	s.lock.Lock()
+	s.executions[e.id] = e
+	s.order = append(s.order, e.id)
+	s.lock.Unlock()
+	go func() {
+		defer cancel()
+		result, err := runner.Execute(plan)
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		e.result, e.err = result, err
+		switch {
+		case e.state == StateAborted:
+		case err != nil:
+			e.state = StateFailed
+		default:
+			e.state = StateFinished
+		}
+		s.log.Info("Execution completed", zap.String("execution", e.id), zap.String("state", e.state), zap.Error(err))
+	}()
+	s.log.Info("Submitted execution", zap.String("execution", e.id))
+	return e, nil
+}
+
+// abort uses the same path as a signal to stop and restore the execution
+func (s *Server) abort(e *execution) error {
+	s.lock.Lock()
+	if e.state != StateRunning {
+		s.lock.Unlock()
+		return errors.New("execution is not running")
+	}
+	e.state = StateAborted
+	s.lock.Unlock()
+	return e.runner.Shutdown()
+}
+
+// describe must be called while holding the lock
+func (s *Server) describe(e *execution, detailed bool) Execution {
+	d := Execution{
+		Id:        e.id,
+		State:     e.state,
+		Submitted: e.submitted,
+	}
+	if e.err != nil {
+		d.Error = e.err.Error()
+	}
+	if detailed {
+		p := e.runner.Progress()
+		d.Plan, d.Progress = e.plan, &p
+	}
+	return d
+}
+
+func respond(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func fail(w http.ResponseWriter, status int, err error) {
+	respond(w, status, map[string]string{"error": err.Error()})
+}
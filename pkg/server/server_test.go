@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/orchestra"
+	"github.com/MovieStoreGuy/skirmish/pkg/provider"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+const token = "secret"
+
+const plan = `
+mode: %s
+projects: [p]
+steps:
+- name: stop
+  operations: [instance]
+  projects: [p]
+  sample: 100
+  include:
+    wildcards: ["^demo-"]
+  wait: 1m
+`
+
+func newServer(t *testing.T) (*httptest.Server, *provider.Fake) {
+	fake := provider.NewFake("us-central1-a")
+	fake.Populate(1, "p")
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := New(ctx, zap.NewNop(), token, &types.Services{Provider: fake})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		s.Shutdown()
+		cancel()
+		srv.Close()
+	})
+	return srv, fake
+}
+
+// call makes the request against the API decoding the response into v when set
+func call(t *testing.T, method, url, body string, v interface{}) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func submit(t *testing.T, srv *httptest.Server, mode string) Execution {
+	var e Execution
+	if status := call(t, http.MethodPost, srv.URL+"/executions", fmt.Sprintf(plan, mode), &e); status != http.StatusCreated {
+		t.Fatalf("submit returned %d, want %d", status, http.StatusCreated)
+	}
+	return e
+}
+
+// await polls the execution until the condition is met
+func await(t *testing.T, srv *httptest.Server, id string, cond func(Execution) bool) Execution {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var e Execution
+		if status := call(t, http.MethodGet, srv.URL+"/executions/"+id, "", &e); status != http.StatusOK {
+			t.Fatalf("get returned %d, want %d", status, http.StatusOK)
+		}
+		if cond(e) {
+			return e
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("execution %+v never reached the expected state", e)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func stopped(fake *provider.Fake) int {
+	count := 0
+	for _, instance := range fake.Instances() {
+		if instance.Status != provider.StatusRunning {
+			count++
+		}
+	}
+	return count
+}
+
+// running returns the progress of the only step still running
+func running(e Execution) orchestra.StepProgress {
+	if e.Progress == nil || len(e.Progress.Running) != 1 {
+		return orchestra.StepProgress{}
+	}
+	return e.Progress.Running[0]
+}
+
+func TestControlAndAbortExecution(t *testing.T) {
+	srv, fake := newServer(t)
+	e := submit(t, srv, types.Repairable)
+	url := srv.URL + "/executions/" + e.Id
+	await(t, srv, e.Id, func(e Execution) bool { return running(e).Waiting })
+	if n := stopped(fake); n != 2 {
+		t.Errorf("%d instances stopped, want 2", n)
+	}
+	var paused Execution
+	if status := call(t, http.MethodPost, url+"/pause", "", &paused); status != http.StatusOK || !running(paused).Paused {
+		t.Errorf("pause returned %d with %+v, want the wait paused", status, running(paused))
+	}
+	if status := call(t, http.MethodPost, url+"/extend?duration=1m", "", &paused); status != http.StatusOK || running(paused).Remaining <= time.Minute {
+		t.Errorf("extend returned %d with %v remaining, want more than a minute", status, running(paused).Remaining)
+	}
+	if status := call(t, http.MethodPost, url+"/extend?duration=soon", "", nil); status != http.StatusConflict {
+		t.Errorf("extend with an invalid duration returned %d, want %d", status, http.StatusConflict)
+	}
+	var resumed Execution
+	if status := call(t, http.MethodPost, url+"/resume", "", &resumed); status != http.StatusOK || running(resumed).Paused {
+		t.Errorf("resume returned %d with %+v, want the wait resumed", status, running(resumed))
+	}
+	var aborted Execution
+	if status := call(t, http.MethodPost, url+"/abort", "", &aborted); status != http.StatusOK || aborted.State != StateAborted {
+		t.Errorf("abort returned %d in state %s, want %s", status, aborted.State, StateAborted)
+	}
+	await(t, srv, e.Id, func(e Execution) bool { return len(e.Progress.Result.Steps) == 1 })
+	if n := stopped(fake); n != 0 {
+		t.Errorf("%d instances are still stopped once aborted", n)
+	}
+}
+
+func TestFinishedExecutionRejectsActions(t *testing.T) {
+	srv, _ := newServer(t)
+	e := submit(t, srv, types.DryRun)
+	await(t, srv, e.Id, func(e Execution) bool { return e.State == StateFinished })
+	for _, action := range []string{"pause", "resume", "abort"} {
+		if status := call(t, http.MethodPost, srv.URL+"/executions/"+e.Id+"/"+action, "", nil); status != http.StatusConflict {
+			t.Errorf("%s returned %d, want %d", action, status, http.StatusConflict)
+		}
+	}
+	if status := call(t, http.MethodPost, srv.URL+"/executions/"+e.Id+"/unknown", "", nil); status != http.StatusNotFound {
+		t.Errorf("unknown action returned %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestListExecutions(t *testing.T) {
+	srv, _ := newServer(t)
+	first, second := submit(t, srv, types.DryRun), submit(t, srv, types.DryRun)
+	var list []Execution
+	if status := call(t, http.MethodGet, srv.URL+"/executions", "", &list); status != http.StatusOK {
+		t.Fatalf("list returned %d, want %d", status, http.StatusOK)
+	}
+	if len(list) != 2 || list[0].Id != first.Id || list[1].Id != second.Id {
+		t.Errorf("listed %+v, want both executions in the order submitted", list)
+	}
+	if list[0].Progress != nil || list[0].Plan != nil {
+		t.Error("listed executions should not include their progress")
+	}
+}
+
+func TestRejectsInvalidRequests(t *testing.T) {
+	srv, _ := newServer(t)
+	if status := call(t, http.MethodPost, srv.URL+"/executions", "mode: everything", nil); status != http.StatusBadRequest {
+		t.Errorf("invalid plan returned %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := call(t, http.MethodGet, srv.URL+"/executions/missing", "", nil); status != http.StatusNotFound {
+		t.Errorf("unknown execution returned %d, want %d", status, http.StatusNotFound)
+	}
+	if status := call(t, http.MethodDelete, srv.URL+"/executions", "", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("delete returned %d, want %d", status, http.StatusMethodNotAllowed)
+	}
+	command := fmt.Sprintf(plan, types.DryRun) + `  steadyState:
+    probes:
+    - name: shell
+      command:
+        path: /bin/true
+`
+	var rejected map[string]string
+	if status := call(t, http.MethodPost, srv.URL+"/executions", command, &rejected); status != http.StatusBadRequest || !strings.Contains(rejected["error"], "not allowed") {
+		t.Errorf("plan with a command probe returned %d with %v, want %d", status, rejected, http.StatusBadRequest)
+	}
+}
+
+func TestRequiresToken(t *testing.T) {
+	if _, err := New(context.Background(), zap.NewNop(), "", &types.Services{}); err == nil {
+		t.Error("expected the server to refuse to start without a token")
+	}
+	srv, _ := newServer(t)
+	for name, header := range map[string]string{
+		"missing": "",
+		"wrong":   "Bearer guess",
+	} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/executions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s token returned %d, want %d", name, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestReportExecution(t *testing.T) {
+	srv, _ := newServer(t)
+	e := submit(t, srv, types.DryRun)
+	await(t, srv, e.Id, func(e Execution) bool { return e.State == StateFinished })
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/executions/"+e.Id+"/report?format=html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("report returned %d as %s, want html", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "<h2>stop</h2>") {
+		t.Errorf("report is missing the step:\n%s", body)
+	}
+	if status := call(t, http.MethodGet, srv.URL+"/executions/"+e.Id+"/report?format=pdf", "", nil); status != http.StatusBadRequest {
+		t.Errorf("unknown format returned %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -15,6 +15,7 @@ type Handler struct {
 	lock            sync.Mutex
 	issueShutdown   sync.Once
 	closeConnection sync.Once
+	runOperations   sync.Once
 }
 
 // Register allows to define what operations need to happen when the system
@@ -58,14 +59,26 @@ func (h *Handler) Finalise() {
 	default:
 		fmt.Fprintf(os.Stderr, "Recovered from %v, terminating gracefully\n", r)
 	}
-	for _, op := range h.operations {
-		op()
-	}
+	h.Run()
 	h.closeConnection.Do(func() {
 		close(h.shutdown)
 	})
 }
 
+// Run performs every registered operation, they are only ever performed once
+// regardless of how many times Run or Finalise are called.
+// Calls made while the operations are being performed wait for them to finish.
+func (h *Handler) Run() {
+	h.runOperations.Do(func() {
+		h.lock.Lock()
+		operations := append([]func(){}, h.operations...)
+		h.lock.Unlock()
+		for _, op := range operations {
+			op()
+		}
+	})
+}
+
 // Done to be called outside of the
 func (h *Handler) Done() {
 	h.issueShutdown.Do(func() {
@@ -0,0 +1,98 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	// FaultCPU burns CPU on the host
+	FaultCPU = "cpu"
+	// FaultMemory allocates and holds memory on the host
+	FaultMemory = "memory"
+	// FaultDisk fills a filesystem of the host with a file
+	FaultDisk = "disk"
+	// FaultKill kills every process with the name, it can not be reverted
+	FaultKill = "kill"
+	// FaultStop pauses every process with the name using SIGSTOP until it is reverted
+	FaultStop = "stop"
+)
+
+// faultId limits ids to what can safely be used as a file name, such as a UUID
+var faultId = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// Fault is injected into a host by its agent and reverted by the agent once the TTL expires
+type Fault struct {
+	// Id is set by the orchestrator so the fault can be journaled before it is injected
+	Id        string        `json:"id,omitempty" yaml:"-"`
+	Kind      string        `json:"kind" yaml:"kind" description:"one of cpu, memory, disk, kill or stop"`
+	TTL       time.Duration `json:"ttl" yaml:"ttl" description:"how long until the agent reverts the fault by itself, defaults to the step's wait plus a minute"`
+	Workers   int           `json:"workers,omitempty" yaml:"workers" description:"the number of cores a cpu fault burns, defaults to every core"`
+	Load      int           `json:"load,omitempty" yaml:"load" description:"the percentage [1,100] of each core a cpu fault burns, defaults to 100"`
+	Megabytes int64         `json:"megabytes,omitempty" yaml:"megabytes" description:"the memory a memory fault holds or the size of the file a disk fault writes, a disk fault fills the filesystem when unset"`
+	Path      string        `json:"path,omitempty" yaml:"path" description:"the directory a disk fault writes to, defaults to the temporary directory"`
+	Process   string        `json:"process,omitempty" yaml:"process" description:"the name of the processes a kill or stop fault signals"`
+	// Netem is set from the netem settings of the step rather than the agent faults
+	Netem *Netem `json:"netem,omitempty" yaml:"-"`
+}
+
+// Validate ensures the fault can be injected, it is exported so the agent can check the faults it receives
+func (f Fault) Validate() error {
+	if f.Id != "" && !faultId.MatchString(f.Id) {
+		return fmt.Errorf("has fault id %q that isn't made of letters, digits and dashes", f.Id)
+	}
+	switch f.Kind {
+	case FaultCPU:
+		if f.Workers < 0 {
+			return fmt.Errorf("has a negative cpu workers")
+		}
+		if f.Load < 0 || f.Load > 100 {
+			return fmt.Errorf("has cpu load %d outside of [0, 100]", f.Load)
+		}
+	case FaultMemory:
+		if f.Megabytes <= 0 {
+			return fmt.Errorf("has a memory fault without megabytes")
+		}
+	case FaultDisk:
+		if f.Megabytes < 0 {
+			return fmt.Errorf("has negative disk megabytes")
+		}
+	case FaultKill, FaultStop:
+		if f.Process == "" {
+			return fmt.Errorf("has a %s fault without a process", f.Kind)
+		}
+	case FaultNetem:
+		if f.Netem == nil || !f.Netem.Enabled() {
+			return fmt.Errorf("has a netem fault without a delay, loss, corrupt or rate")
+		}
+		if err := f.Netem.validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("has unknown agent fault %s", f.Kind)
+	}
+	if f.TTL < 0 {
+		return fmt.Errorf("has a negative %s fault ttl", f.Kind)
+	}
+	return nil
+}
+
+// AgentSettings configures the faults the agent minion has the agents running on each instance inject
+type AgentSettings struct {
+	Port   int     `json:"port,omitempty" yaml:"port" description:"the port the agents listen on, defaults to 7070"`
+	Host   string  `json:"host,omitempty" yaml:"host" description:"the address to reach every agent on instead of each instance's internal IP, such as 127.0.0.1 to test locally"`
+	Faults []Fault `json:"faults" yaml:"faults" description:"the faults to inject into each instance"`
+}
+
+func (a AgentSettings) validate() error {
+	if a.Port < 0 || a.Port > 65535 {
+		return fmt.Errorf("has agent port %d outside of [0, 65535]", a.Port)
+	}
+	for _, f := range a.Faults {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// BackendRemove removes the sampled backends from the backend service
+	BackendRemove = "remove"
+	// BackendDrain sets the capacity scaler of the sampled backends to zero
+	BackendDrain = "drain"
+)
+
+// BackendService is a load balancer backend service, regional services have a region set
+type BackendService struct {
+	Name        string
+	Project     string
+	Region      string
+	Fingerprint string
+	Backends    []Backend
+}
+
+// Backend is an instance group or network endpoint group serving a backend service
+type Backend struct {
+	Group string `json:"group"`
+	// Config is the provider's exact configuration of the backend so it can be written back unchanged
+	Config json.RawMessage `json:"config"`
+	// Drained sets the capacity scaler of the backend to zero when it is updated
+	Drained bool `json:"-"`
+}
+
+// BackendSettings configures which backend service the backend minion drains and how
+type BackendSettings struct {
+	Service string `json:"service" yaml:"service" description:"the name of the backend service"`
+	Region  string `json:"region,omitempty" yaml:"region" description:"the region of a regional backend service, global when unset"`
+	Action  string `json:"action" yaml:"action" description:"one of remove or drain"`
+}
+
+func (b BackendSettings) validate() error {
+	switch b.Action {
+	case "", BackendRemove, BackendDrain:
+	default:
+		return fmt.Errorf("has unknown backend action %s", b.Action)
+	}
+	if b.Action != "" && b.Service == "" {
+		return fmt.Errorf("has a backend action without a service")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package types
+
+import "fmt"
+
+const (
+	// DatabaseFailover fails a highly available instance over to its standby
+	DatabaseFailover = "failover"
+	// DatabaseRestart restarts the instance
+	DatabaseRestart = "restart"
+	// DatabaseDeauthorize removes every authorized network from the instance
+	DatabaseDeauthorize = "deauthorize"
+)
+
+// Database is a Cloud SQL instance
+type Database struct {
+	Name    string
+	Project string
+	Region  string
+	// Zone is the complete zone the primary is currently running in
+	Zone  string
+	State string
+	// HighlyAvailable is set for regional instances that have a standby to fail over to
+	HighlyAvailable    bool
+	Labels             map[string]string
+	SettingsVersion    int64
+	AuthorizedNetworks []AuthorizedNetwork
+}
+
+// AuthorizedNetwork is a CIDR range allowed to connect to the database's public address
+type AuthorizedNetwork struct {
+	Name           string `json:"name,omitempty"`
+	Value          string `json:"value"`
+	ExpirationTime string `json:"expirationTime,omitempty"`
+}
+
+// Resource returns the identifier used when reporting on the database
+func (d *Database) Resource() Resource {
+	return Resource{
+		Kind:    "cloudsql",
+		Project: d.Project,
+		Zone:    d.Zone,
+		Name:    d.Name,
+	}
+}
+
+// DatabaseSettings configures how the cloudsql minion disrupts databases
+type DatabaseSettings struct {
+	Action string `json:"action" yaml:"action" description:"one of failover, restart or deauthorize"`
+}
+
+func (d DatabaseSettings) validate() error {
+	switch d.Action {
+	case "", DatabaseFailover, DatabaseRestart, DatabaseDeauthorize:
+	default:
+		return fmt.Errorf("has unknown cloudsql action %s", d.Action)
+	}
+	return nil
+}
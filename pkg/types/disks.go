@@ -0,0 +1,35 @@
+package types
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// AttachedDisk is a disk attached to an instance, everything required to attach it again
+type AttachedDisk struct {
+	Source     string `json:"source"`
+	DeviceName string `json:"deviceName"`
+	Mode       string `json:"mode"`
+	Boot       bool   `json:"boot"`
+	AutoDelete bool   `json:"autoDelete"`
+}
+
+// Name returns the name of the disk from its source
+func (d AttachedDisk) Name() string {
+	return path.Base(d.Source)
+}
+
+// DiskSettings configures which disks the disk minion targets
+type DiskSettings struct {
+	Devices []string `json:"devices,omitempty" yaml:"devices" description:"regular expressions of the device names to target, every non boot disk when unset"`
+}
+
+func (d DiskSettings) validate() error {
+	for _, device := range d.Devices {
+		if _, err := regexp.Compile(device); err != nil {
+			return fmt.Errorf("has invalid disk device %s: %v", device, err)
+		}
+	}
+	return nil
+}
@@ -7,5 +7,34 @@ type Firewall struct {
 	Name      string
 	Id        uint64
 	Instances []*Instance
-	Labels    map[string]string
+	// Tag is the network tag applied to the instances the firewall targets
+	Tag string
+}
+
+// FirewallRule is the provider independent definition of a firewall to create
+type FirewallRule struct {
+	Name       string
+	Network    string
+	Direction  string
+	Priority   int64
+	TargetTags []string
+	SourceTags []string
+	// SourceRanges and DestinationRanges are CIDR blocks the rule applies to
+	SourceRanges      []string
+	DestinationRanges []string
+	// TargetServiceAccounts can't be combined with TargetTags
+	TargetServiceAccounts []string
+	Log                   bool
+	Denied                []Deny
+	// Allowed uses the same protocol and ports as Denied but lets the traffic through
+	Allowed []Deny
+}
+
+// Resource returns the identifier used when reporting on the firewall
+func (f *Firewall) Resource() Resource {
+	return Resource{
+		Kind:    "firewall",
+		Project: f.Project,
+		Name:    f.Name,
+	}
 }
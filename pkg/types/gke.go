@@ -0,0 +1,57 @@
+package types
+
+import "fmt"
+
+const (
+	// GKEDrain cordons and drains the sampled nodes
+	GKEDrain = "drain"
+	// GKEResize shrinks the node pools
+	GKEResize = "resize"
+	// GKEDelete deletes the sampled node VMs, leaving the node pool to recreate them
+	GKEDelete = "delete"
+)
+
+// NodePool is a GKE node pool along with the instance groups that back it
+type NodePool struct {
+	Name     string
+	Cluster  string
+	Location string
+	Project  string
+	// NodeCount is the number of nodes within each zone of the pool
+	NodeCount int64
+	Groups    []*InstanceGroup
+}
+
+// Resource returns the identifier used when reporting on the node pool
+func (n *NodePool) Resource() Resource {
+	return Resource{
+		Kind:    "node-pool",
+		Project: n.Project,
+		Zone:    n.Location,
+		Name:    n.Cluster + "/" + n.Name,
+	}
+}
+
+// GKESettings configures which cluster the gke minion disrupts and how
+type GKESettings struct {
+	Cluster   string   `json:"cluster" yaml:"cluster" description:"the name of the cluster"`
+	Location  string   `json:"location" yaml:"location" description:"the zone or region of the cluster"`
+	NodePools []string `json:"nodePools,omitempty" yaml:"nodePools" description:"the node pools to disrupt, every node pool when unset"`
+	Action    string   `json:"action" yaml:"action" description:"one of drain, resize or delete"`
+	ShrinkBy  int64    `json:"shrinkBy,omitempty" yaml:"shrinkBy" description:"how many nodes per zone a resize removes from each pool, defaults to 1"`
+}
+
+func (g GKESettings) validate() error {
+	switch g.Action {
+	case "", GKEDrain, GKEResize, GKEDelete:
+	default:
+		return fmt.Errorf("has unknown gke action %s", g.Action)
+	}
+	if g.Action != "" && (g.Cluster == "" || g.Location == "") {
+		return fmt.Errorf("has a gke action without a cluster and location")
+	}
+	if g.ShrinkBy < 0 {
+		return fmt.Errorf("has a negative gke shrinkBy")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ID returns the identifier other steps depend on, defaulting to the step's name
+func (s *Step) ID() string {
+	if s.Id != "" {
+		return s.Id
+	}
+	return s.Name
+}
+
+// Dependencies resolves the index of every step each step has to wait on before it can start.
+// Steps that don't declare dependsOn wait on the step before them unless they share its parallel group,
+// in which case they start alongside the group, so plans without either run strictly in order.
+func (p *Plan) Dependencies() ([][]int, error) {
+	ids := make(map[string]int, len(p.Steps))
+	for index, s := range p.Steps {
+		existing, exist := ids[s.ID()]
+		switch {
+		case !exist:
+			ids[s.ID()] = index
+		case s.Id != "" && existing >= 0 && p.Steps[existing].Id != "":
+			return nil, fmt.Errorf("step %d has duplicate id %s", index, s.Id)
+		default:
+			// Steps that only share a name can't be referenced
+			ids[s.ID()] = -1
+		}
+	}
+	var (
+		deps     = make([][]int, len(p.Steps))
+		previous []int
+		groups   = make(map[string][]int)
+	)
+	for index, s := range p.Steps {
+		switch {
+		case len(s.DependsOn) > 0:
+			for _, ref := range s.DependsOn {
+				dep, exist := ids[ref]
+				if !exist {
+					return nil, fmt.Errorf("step %d depends on unknown step %s", index, ref)
+				}
+				if dep < 0 {
+					return nil, fmt.Errorf("step %d depends on %s which is shared by multiple steps, set an id to reference it", index, ref)
+				}
+				if dep == index {
+					return nil, fmt.Errorf("step %d depends on itself", index)
+				}
+				deps[index] = append(deps[index], dep)
+			}
+		case s.Parallel != "" && len(groups[s.Parallel]) > 0:
+			deps[index] = append(deps[index], deps[groups[s.Parallel][0]]...)
+		default:
+			deps[index] = append(deps[index], previous...)
+		}
+		if s.Parallel != "" {
+			groups[s.Parallel] = append(groups[s.Parallel], index)
+			previous = groups[s.Parallel]
+		} else {
+			previous = []int{index}
+		}
+	}
+	if cycle := findCycle(deps); cycle != nil {
+		names := make([]string, 0, len(cycle))
+		for _, index := range cycle {
+			names = append(names, p.Steps[index].ID())
+		}
+		return nil, fmt.Errorf("steps have a dependency cycle %s", strings.Join(names, " -> "))
+	}
+	return deps, nil
+}
+
+// findCycle returns the indexes that form the first cycle found within the graph
+func findCycle(deps [][]int) []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var (
+		state = make([]int, len(deps))
+		path  []int
+		visit func(int) []int
+	)
+	visit = func(node int) []int {
+		state[node] = visiting
+		path = append(path, node)
+		for _, dep := range deps[node] {
+			switch state[dep] {
+			case visiting:
+				for i, n := range path {
+					if n == dep {
+						return append(append([]int(nil), path[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[node] = visited
+		return nil
+	}
+	for node := range deps {
+		if state[node] == unvisited {
+			if cycle := visit(node); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDependenciesRunInOrderByDefault(t *testing.T) {
+	plan := &Plan{Steps: []Step{{Name: "a"}, {Name: "b"}, {Name: "c"}}}
+	deps, err := plan.Dependencies()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := [][]int{nil, {0}, {1}}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("dependencies %v, want %v", deps, want)
+	}
+}
+
+func TestDependenciesStartParallelGroupTogether(t *testing.T) {
+	plan := &Plan{Steps: []Step{
+		{Name: "setup"},
+		{Name: "a", Parallel: "outage"},
+		{Name: "b", Parallel: "outage"},
+		{Name: "verify"},
+	}}
+	deps, err := plan.Dependencies()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The step after the group waits for every step within it
+	if want := [][]int{nil, {0}, {0}, {1, 2}}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("dependencies %v, want %v", deps, want)
+	}
+}
+
+func TestDependenciesUseDependsOn(t *testing.T) {
+	plan := &Plan{Steps: []Step{
+		{Name: "a"},
+		{Id: "second", Name: "b"},
+		{Name: "c", DependsOn: []string{"a", "second"}},
+	}}
+	deps, err := plan.Dependencies()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := [][]int{nil, {0}, {0, 1}}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("dependencies %v, want %v", deps, want)
+	}
+}
+
+func TestDependenciesRejectInvalidReferences(t *testing.T) {
+	for name, steps := range map[string][]Step{
+		"unknown":   {{Name: "a", DependsOn: []string{"missing"}}},
+		"itself":    {{Name: "a", DependsOn: []string{"a"}}},
+		"shared":    {{Name: "a"}, {Name: "a"}, {Name: "b", DependsOn: []string{"a"}}},
+		"duplicate": {{Id: "a", Name: "first"}, {Id: "a", Name: "second"}},
+	} {
+		plan := &Plan{Steps: steps}
+		if _, err := plan.Dependencies(); err == nil {
+			t.Errorf("%s reference should fail", name)
+		}
+	}
+}
+
+func TestDependenciesRejectCycle(t *testing.T) {
+	plan := &Plan{Steps: []Step{
+		{Name: "a", DependsOn: []string{"c"}},
+		{Name: "b", DependsOn: []string{"a"}},
+		{Name: "c", DependsOn: []string{"b"}},
+	}}
+	_, err := plan.Dependencies()
+	if err == nil {
+		t.Fatal("a dependency cycle should fail")
+	}
+	if !strings.Contains(err.Error(), "a -> c -> b -> a") {
+		t.Errorf("error %q, want the cycle named", err)
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	if cycle := findCycle([][]int{nil, {0}, {0, 1}}); cycle != nil {
+		t.Errorf("cycle %v, want none", cycle)
+	}
+	if cycle := findCycle([][]int{nil, {2}, {3}, {1}}); !reflect.DeepEqual(cycle, []int{1, 2, 3, 1}) {
+		t.Errorf("cycle %v, want [1 2 3 1]", cycle)
+	}
+}
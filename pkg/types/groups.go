@@ -0,0 +1,50 @@
+package types
+
+import "fmt"
+
+const (
+	// GroupResize shrinks the target size of the group
+	GroupResize = "resize"
+	// GroupAbandon removes the sampled instances from the group while leaving them running
+	GroupAbandon = "abandon"
+	// GroupRecreate forces the group to recreate the sampled instances
+	GroupRecreate = "recreate"
+	// GroupRestart performs a rolling restart of every instance within the group
+	GroupRestart = "restart"
+)
+
+// InstanceGroup is a zonal managed instance group
+type InstanceGroup struct {
+	Name       string
+	Zone       string
+	Project    string
+	TargetSize int64
+}
+
+// Resource returns the identifier used when reporting on the instance group
+func (g *InstanceGroup) Resource() Resource {
+	return Resource{
+		Kind:    "instance-group",
+		Project: g.Project,
+		Zone:    g.Zone,
+		Name:    g.Name,
+	}
+}
+
+// GroupSettings configures how the mig minion disrupts managed instance groups
+type GroupSettings struct {
+	Action   string `json:"action" yaml:"action" description:"one of resize, abandon, recreate or restart"`
+	ShrinkBy int64  `json:"shrinkBy,omitempty" yaml:"shrinkBy" description:"how many instances a resize removes from each group, defaults to 1"`
+}
+
+func (g GroupSettings) validate() error {
+	switch g.Action {
+	case "", GroupResize, GroupAbandon, GroupRecreate, GroupRestart:
+	default:
+		return fmt.Errorf("has unknown group action %s", g.Action)
+	}
+	if g.ShrinkBy < 0 {
+		return fmt.Errorf("has a negative group shrinkBy")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Policy is the IAM policy of a project, the etag guards against concurrent changes
+type Policy struct {
+	Project  string
+	Etag     string
+	Bindings []Binding
+}
+
+// Binding grants the role to its members, conditional bindings keep their exact condition so they are written back unchanged
+type Binding struct {
+	Role      string          `json:"role"`
+	Members   []string        `json:"members"`
+	Condition json.RawMessage `json:"condition,omitempty"`
+}
+
+// Grant is a single role granted to a member, such as roles/pubsub.publisher to serviceAccount:orders@project.iam.gserviceaccount.com
+type Grant struct {
+	Role   string `json:"role" yaml:"role" description:"the role to revoke, such as roles/pubsub.publisher"`
+	Member string `json:"member" yaml:"member" description:"the member to revoke it from, such as serviceAccount:orders@project.iam.gserviceaccount.com"`
+}
+
+// Resource returns the identifier used when reporting on the grant
+func (g Grant) Resource(project string) Resource {
+	return Resource{
+		Kind:    "iam",
+		Project: project,
+		Name:    g.Role + " " + g.Member,
+	}
+}
+
+// IAMSettings configures which project level grants the iam minion revokes
+type IAMSettings struct {
+	Revoke []Grant `json:"revoke" yaml:"revoke" description:"the role and member pairs to remove from the project policy"`
+}
+
+func (i IAMSettings) validate() error {
+	for _, g := range i.Revoke {
+		if g.Role == "" {
+			return fmt.Errorf("has an iam grant without a role")
+		}
+		if !strings.Contains(g.Member, ":") {
+			return fmt.Errorf("has iam member %q without a type such as user: or serviceAccount:", g.Member)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	// OperatorIn matches when the label's value is one of the values
+	OperatorIn = "in"
+	// OperatorNotIn matches when the label is missing or its value is none of the values
+	OperatorNotIn = "notin"
+	// OperatorExists matches when the label is set to any value
+	OperatorExists = "exists"
+)
+
+// Include narrows the instances a step targets before any exclusions are applied,
+// every field that is set has to match while any entry within a list can match.
+type Include struct {
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels" description:"the labels the instance is required to have"`
+	Expressions []LabelExpression `json:"expressions,omitempty" yaml:"expressions" description:"set based label requirements"`
+	Zones       []string          `json:"zones,omitempty" yaml:"zones" description:"define the full zone names to target, such as australia-southeast1-a"`
+	Regions     []string          `json:"regions,omitempty" yaml:"regions" description:"define the regions to target, matching any region they prefix"`
+	Wildcards   []string          `json:"wildcards,omitempty" yaml:"wildcards" description:"the regular expressions the instance name can match"`
+	Tags        []string          `json:"tags,omitempty" yaml:"tags" description:"the network tags the instance can have"`
+}
+
+// LabelExpression is a set based requirement on a label
+type LabelExpression struct {
+	Key      string   `json:"key" yaml:"key"`
+	Operator string   `json:"operator" yaml:"operator" description:"one of in, notin or exists"`
+	Values   []string `json:"values,omitempty" yaml:"values"`
+}
+
+// Matches reports if the labels satisfy the expression
+func (e LabelExpression) Matches(labels map[string]string) bool {
+	value, exists := labels[e.Key]
+	switch e.Operator {
+	case OperatorExists:
+		return exists
+	case OperatorIn, OperatorNotIn:
+		found := false
+		for _, v := range e.Values {
+			if exists && v == value {
+				found = true
+			}
+		}
+		return found == (e.Operator == OperatorIn)
+	default:
+		return false
+	}
+}
+
+func (i Include) validate() error {
+	for _, wildcard := range i.Wildcards {
+		if _, err := regexp.Compile(wildcard); err != nil {
+			return fmt.Errorf("has invalid include wildcard %s: %v", wildcard, err)
+		}
+	}
+	for _, e := range i.Expressions {
+		if e.Key == "" {
+			return fmt.Errorf("has an include expression without a key")
+		}
+		switch e.Operator {
+		case OperatorIn, OperatorNotIn:
+			if len(e.Values) == 0 {
+				return fmt.Errorf("has include expression on %s that requires values for %s", e.Key, e.Operator)
+			}
+		case OperatorExists:
+			if len(e.Values) != 0 {
+				return fmt.Errorf("has include expression on %s that can not have values for %s", e.Key, e.Operator)
+			}
+		default:
+			return fmt.Errorf("has include expression on %s with unknown operator %s", e.Key, e.Operator)
+		}
+	}
+	return validateZones("include", i.Zones)
+}
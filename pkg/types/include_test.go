@@ -0,0 +1,46 @@
+package types
+
+import "testing"
+
+func TestLabelExpressionMatches(t *testing.T) {
+	labels := map[string]string{"app": "web"}
+	for name, test := range map[string]struct {
+		expression LabelExpression
+		matches    bool
+	}{
+		"in":             {LabelExpression{Key: "app", Operator: OperatorIn, Values: []string{"db", "web"}}, true},
+		"not in values":  {LabelExpression{Key: "app", Operator: OperatorIn, Values: []string{"db"}}, false},
+		"in missing":     {LabelExpression{Key: "tier", Operator: OperatorIn, Values: []string{"web"}}, false},
+		"notin":          {LabelExpression{Key: "app", Operator: OperatorNotIn, Values: []string{"db"}}, true},
+		"notin values":   {LabelExpression{Key: "app", Operator: OperatorNotIn, Values: []string{"web"}}, false},
+		"notin missing":  {LabelExpression{Key: "tier", Operator: OperatorNotIn, Values: []string{"web"}}, true},
+		"exists":         {LabelExpression{Key: "app", Operator: OperatorExists}, true},
+		"exists missing": {LabelExpression{Key: "tier", Operator: OperatorExists}, false},
+		"unknown":        {LabelExpression{Key: "app", Operator: "equals", Values: []string{"web"}}, false},
+	} {
+		if matches := test.expression.Matches(labels); matches != test.matches {
+			t.Errorf("%s matched %t, want %t", name, matches, test.matches)
+		}
+	}
+}
+
+func TestIncludeValidate(t *testing.T) {
+	valid := Include{
+		Wildcards:   []string{"^web-"},
+		Expressions: []LabelExpression{{Key: "app", Operator: OperatorIn, Values: []string{"web"}}, {Key: "tier", Operator: OperatorExists}},
+	}
+	if err := valid.validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, include := range map[string]Include{
+		"wildcard":     {Wildcards: []string{"web-("}},
+		"key":          {Expressions: []LabelExpression{{Operator: OperatorExists}}},
+		"operator":     {Expressions: []LabelExpression{{Key: "app", Operator: "equals"}}},
+		"in values":    {Expressions: []LabelExpression{{Key: "app", Operator: OperatorIn}}},
+		"exists value": {Expressions: []LabelExpression{{Key: "app", Operator: OperatorExists, Values: []string{"web"}}}},
+	} {
+		if err := include.validate(); err == nil {
+			t.Errorf("invalid %s should fail", name)
+		}
+	}
+}
@@ -3,14 +3,42 @@ package types
 // Instance defines all the required values for the internal structure
 // so that the orchestrator can restore it back the original state.
 type Instance struct {
-	Id      uint64
-	Name    string
-	Zone    string
-	Region  string
-	Project string
-	Labels  map[string]string
+	Id               uint64
+	Name             string
+	Zone             string
+	Region           string
+	Project          string
+	Status           string
+	InternalIP       string
+	Labels           map[string]string
+	LabelFingerprint string
+	Tags             []string
+	TagFingerprint   string
+	Disks            []AttachedDisk
+	Scheduling       Scheduling
+}
+
+// Scheduling is how the instance behaves during host maintenance
+type Scheduling struct {
+	OnHostMaintenance string `json:"onHostMaintenance"`
+	AutomaticRestart  bool   `json:"automaticRestart"`
 }
 
 func (i *Instance) CompleteZone() string {
 	return i.Region + "-" + i.Zone
 }
+
+// Resource returns the identifier used when reporting on the instance
+func (i *Instance) Resource() Resource {
+	return Resource{
+		Kind:    "instance",
+		Project: i.Project,
+		Zone:    i.CompleteZone(),
+		Name:    i.Name,
+	}
+}
+
+// Running reports if the instance is currently serving
+func (i *Instance) Running() bool {
+	return i.Status == "RUNNING"
+}
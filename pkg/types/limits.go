@@ -0,0 +1,60 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits caps the blast radius of a step regardless of how instances are sampled
+type Limits struct {
+	MaxTargets           int            `json:"maxTargets,omitempty" yaml:"maxTargets" description:"the most instances the step can affect, unlimited when unset"`
+	MaxPercent           float32        `json:"maxPercent,omitempty" yaml:"maxPercent" description:"the most of the matching instances the step can affect as a percentage (0.0,100.0]"`
+	MaxPerZone           int            `json:"maxPerZone,omitempty" yaml:"maxPerZone" description:"the most instances the step can affect within a single zone"`
+	MinRemainingPerLabel map[string]int `json:"minRemainingPerLabel,omitempty" yaml:"minRemainingPerLabel" description:"the instances that must be left running for each key=value label"`
+}
+
+// limitless are the operations that don't select instances, so the step's limits can never be applied to them
+var limitless = map[string]bool{
+	"mig":      true,
+	"gke":      true,
+	"backend":  true,
+	"cloudsql": true,
+	"route":    true,
+	"iam":      true,
+	"proxy":    true,
+}
+
+// LabelSelector splits the key=value label used by MinRemainingPerLabel
+func LabelSelector(label string) (key, value string, err error) {
+	parts := strings.SplitN(label, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("label %q is required to be in the form key=value", label)
+	}
+	return parts[0], parts[1], nil
+}
+
+// Set reports if any of the limits are configured
+func (l Limits) Set() bool {
+	return l.MaxTargets > 0 || l.MaxPercent > 0 || l.MaxPerZone > 0 || len(l.MinRemainingPerLabel) > 0
+}
+
+func (l Limits) validate() error {
+	if l.MaxTargets < 0 {
+		return fmt.Errorf("has a negative maxTargets")
+	}
+	if l.MaxPerZone < 0 {
+		return fmt.Errorf("has a negative maxPerZone")
+	}
+	if l.MaxPercent < 0.0 || l.MaxPercent > 100.0 {
+		return fmt.Errorf("has invalid maxPercent, maxPercent is required to be within (0.0, 100.0]")
+	}
+	for label, min := range l.MinRemainingPerLabel {
+		if _, _, err := LabelSelector(label); err != nil {
+			return fmt.Errorf("has invalid minRemainingPerLabel, %v", err)
+		}
+		if min < 1 {
+			return fmt.Errorf("has invalid minRemainingPerLabel, %s must keep at least 1 instance", label)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package types
+
+const (
+	// MaintenanceMigrate live migrates the instance during host maintenance
+	MaintenanceMigrate = "MIGRATE"
+	// MaintenanceTerminate stops the instance during host maintenance
+	MaintenanceTerminate = "TERMINATE"
+)
+
+// MaintenanceSettings configures the maintenance minion
+type MaintenanceSettings struct {
+	Terminate bool `json:"terminate,omitempty" yaml:"terminate" description:"terminate the instances without restarting them during the maintenance event rather than migrating them"`
+}
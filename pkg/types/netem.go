@@ -0,0 +1,73 @@
+package types
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+)
+
+// FaultNetem shapes the traffic leaving the host using tc netem
+const FaultNetem = "netem"
+
+var netemRate = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?([kmgt]?(bit|bps))$`)
+
+// Netem describes how the traffic leaving a host is degraded, only the traffic to the ranges or ports is
+// affected when either are set otherwise all of the traffic leaving the device is.
+type Netem struct {
+	Device  string        `json:"device,omitempty" yaml:"device" description:"the network interface to shape, defaults to the interface of the default route"`
+	Delay   time.Duration `json:"delay,omitempty" yaml:"delay" description:"the latency added to each packet"`
+	Jitter  time.Duration `json:"jitter,omitempty" yaml:"jitter" description:"the random variation of the delay"`
+	Loss    float64       `json:"loss,omitempty" yaml:"loss" description:"the percentage [0.0,100.0] of packets dropped"`
+	Corrupt float64       `json:"corrupt,omitempty" yaml:"corrupt" description:"the percentage [0.0,100.0] of packets with a corrupted bit"`
+	Rate    string        `json:"rate,omitempty" yaml:"rate" description:"the bandwidth limit in tc units, such as 1mbit"`
+	Ranges  []string      `json:"ranges,omitempty" yaml:"ranges" description:"the destination CIDR ranges to shape the traffic to"`
+	Ports   []int         `json:"ports,omitempty" yaml:"ports" description:"the destination ports to shape the traffic to"`
+}
+
+// Enabled reports if the netem degrades traffic at all
+func (n Netem) Enabled() bool {
+	return n.Delay > 0 || n.Loss > 0 || n.Corrupt > 0 || n.Rate != ""
+}
+
+func (n Netem) validate() error {
+	if n.Delay < 0 || n.Jitter < 0 {
+		return fmt.Errorf("has a negative netem delay or jitter")
+	}
+	if n.Jitter > 0 && n.Delay == 0 {
+		return fmt.Errorf("has netem jitter without a delay")
+	}
+	if n.Loss < 0 || n.Loss > 100 {
+		return fmt.Errorf("has netem loss %v outside of [0, 100]", n.Loss)
+	}
+	if n.Corrupt < 0 || n.Corrupt > 100 {
+		return fmt.Errorf("has netem corrupt %v outside of [0, 100]", n.Corrupt)
+	}
+	if n.Rate != "" && !netemRate.MatchString(n.Rate) {
+		return fmt.Errorf("has invalid netem rate %s", n.Rate)
+	}
+	for _, cidr := range n.Ranges {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("has invalid netem range %s", cidr)
+		}
+	}
+	for _, port := range n.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("has netem port %d outside of [1, 65535]", port)
+		}
+	}
+	return nil
+}
+
+// NetemSettings configures how the netem minion has the agents degrade the network of each instance
+type NetemSettings struct {
+	Netem `yaml:",inline"`
+	TTL   time.Duration `json:"ttl,omitempty" yaml:"ttl" description:"how long until the agent removes the netem by itself, defaults to the step's wait plus a minute"`
+}
+
+func (n NetemSettings) validate() error {
+	if n.TTL < 0 {
+		return fmt.Errorf("has a negative netem ttl")
+	}
+	return n.Netem.validate()
+}
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"fmt"
+	"net"
+)
+
+// NetworkSettings configures the firewalls the ingress and egress minions create in a project
+type NetworkSettings struct {
+	Project               string   `json:"project" yaml:"project"`
+	Network               string   `json:"network" yaml:"network"`
+	Deny                  []Deny   `json:"deny" yaml:"deny"`
+	SourceRanges          []string `json:"sourceRanges,omitempty" yaml:"sourceRanges" description:"the CIDR ranges denied traffic comes from, otherwise ingress rules deny the other targeted instances"`
+	DestinationRanges     []string `json:"destinationRanges,omitempty" yaml:"destinationRanges" description:"the CIDR ranges denied traffic goes to, otherwise egress rules deny every destination"`
+	TargetServiceAccounts []string `json:"targetServiceAccounts,omitempty" yaml:"targetServiceAccounts" description:"target instances running as these service accounts instead of the selected instances"`
+	Priority              *int64   `json:"priority,omitempty" yaml:"priority" description:"the priority of the deny rules, defaults to 1 and allow rules are given one less"`
+	Log                   bool     `json:"log,omitempty" yaml:"log" description:"enable firewall logging on the created rules"`
+	Allow                 []Allow  `json:"allow,omitempty" yaml:"allow" description:"traffic that is still let through while everything else is denied"`
+}
+
+// Allow is an exception to the deny rules, it is created as an allow rule with a higher priority
+type Allow struct {
+	Ranges   []string `json:"ranges" yaml:"ranges" description:"the destination CIDR ranges for egress, or source CIDR ranges for ingress"`
+	Protocol string   `json:"protocol,omitempty" yaml:"protocol" description:"defaults to all"`
+	Ports    []string `json:"ports,omitempty" yaml:"ports"`
+}
+
+func (n NetworkSettings) validate() error {
+	if p := n.Priority; p != nil {
+		if *p < 0 || *p > 65535 {
+			return fmt.Errorf("has network priority %d outside of [0, 65535]", *p)
+		}
+		// Allow rules are given one less than the deny priority so they take precedence
+		if *p < 1 && len(n.Allow) > 0 {
+			return fmt.Errorf("has network priority %d which leaves no higher priority for the allow rules", *p)
+		}
+	}
+	ranges := append(append([]string(nil), n.SourceRanges...), n.DestinationRanges...)
+	for _, allow := range n.Allow {
+		if len(allow.Ranges) == 0 {
+			return fmt.Errorf("has a network allow rule without any ranges")
+		}
+		ranges = append(ranges, allow.Ranges...)
+	}
+	for _, r := range ranges {
+		if _, _, err := net.ParseCIDR(r); err != nil {
+			return fmt.Errorf("has invalid network range %s", r)
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"time"
 
@@ -13,36 +14,56 @@ type Plan struct {
 	Mode     string   `json:"mode" yaml:"mode" description:"defines how aggressive each step is preformed"`
 	Projects []string `json:"projects" yaml:"projects" description:"define each Google Cloud Project to operate in"`
 	Steps    []Step   `json:"steps" yaml:"steps"`
+	Seed     int64    `json:"seed" yaml:"seed" description:"makes the sampling of every step deterministic, a random seed is used when unset"`
+	// SteadyState is checked for every step in addition to the step's own
+	SteadyState SteadyState `json:"steadyState" yaml:"steadyState"`
 }
 
 // Step defines what operations to run during the war game
 type Step struct {
+	Id          string        `json:"id,omitempty" yaml:"id" description:"the identifier other steps depend on, defaults to the name"`
 	Name        string        `json:"name" yaml:"name"`
 	Description string        `json:"description" yaml:"description"`
+	DependsOn   []string      `json:"dependsOn,omitempty" yaml:"dependsOn" description:"the steps that have to finish and be restored before this step starts"`
+	Parallel    string        `json:"parallel,omitempty" yaml:"parallel" description:"steps within the same group start at the same time"`
 	Operations  []string      `json:"operations" yaml:"operations" description:"It is the name of the loaded minions in the orchestrator"`
 	Projects    []string      `json:"projects" yaml:"projects"`
+	Include     Include       `json:"include" yaml:"include" description:"define the only things to target, everything is targeted when unset"`
 	Exclude     Exclude       `json:"exclude" yaml:"exclude" description:"define all the things to exclude on"`
 	Settings    Settings      `json:"settings" yaml:"settings"`
 	Wait        time.Duration `json:"wait" yaml:"wait"`
+	Timeout     time.Duration `json:"timeout" yaml:"timeout" description:"Timeout is the deadline for all operations to finish before the step continues to wait"`
 	Sample      float32       `json:"sample" yaml:"sample" description:"Sample is rate [0.0,100.0] that will determine the likely hood of an instance being affected"`
+	SteadyState SteadyState   `json:"steadyState" yaml:"steadyState" description:"the probes to check the system is healthy before, during and after the step"`
+	Seed        int64         `json:"seed" yaml:"seed" description:"makes the sampling of the step deterministic, derived from the plan seed when unset"`
+	// Limits are applied once the instances have been sampled
+	Limits `yaml:",inline"`
 }
 
 // Exclude defines the values / properties to avoid when running this
 type Exclude struct {
 	Labels    map[string]string `json:"labels" yaml:"labels" description:"define the labels to ignore resource "`
-	Zones     []string          `json:"zones" yaml:"zones" description:"define the zones to ignore"`
-	Regions   []string          `json:"regions" yaml:"regions" description:"define the regions to ignore"`
+	Zones     []string          `json:"zones" yaml:"zones" description:"define the full zone names to ignore, such as australia-southeast1-a"`
+	Regions   []string          `json:"regions" yaml:"regions" description:"define the regions to ignore, matching any region they prefix"`
 	Wildcards []string          `json:"wildcards" yaml:"wildcards" description:"If the affected resources doesn't match, see if its name matches the wildcard'"`
 }
 
 // Settings defines all the required info to either give to the minions
 // or ensure that the minions don't use that data
 type Settings struct {
-	Network []struct {
-		Project string `json:"project" yaml:"project"`
-		Network string `json:"network" yaml:"network"`
-		Deny    []Deny `json:"deny" yaml:"deny"`
-	}
+	Network     []NetworkSettings   `json:"network" yaml:"network"`
+	Netem       NetemSettings       `json:"netem" yaml:"netem"`
+	Group       GroupSettings       `json:"group" yaml:"group"`
+	ZoneOutage  ZoneOutageSettings  `json:"zoneOutage" yaml:"zoneOutage"`
+	Disk        DiskSettings        `json:"disk" yaml:"disk"`
+	Maintenance MaintenanceSettings `json:"maintenance" yaml:"maintenance"`
+	Route       RouteSettings       `json:"route" yaml:"route"`
+	CloudSQL    DatabaseSettings    `json:"cloudsql" yaml:"cloudsql"`
+	GKE         GKESettings         `json:"gke" yaml:"gke"`
+	Backend     BackendSettings     `json:"backend" yaml:"backend"`
+	IAM         IAMSettings         `json:"iam" yaml:"iam"`
+	Agent       AgentSettings       `json:"agent" yaml:"agent"`
+	Proxy       []ProxySettings     `json:"proxy" yaml:"proxy"`
 }
 
 // Deny is allow setting of network controls
@@ -59,6 +80,9 @@ func (p *Plan) validate() error {
 	default:
 		return fmt.Errorf("unknown mode %s", p.Mode)
 	}
+	if err := p.SteadyState.validate(); err != nil {
+		return fmt.Errorf("plan %v", err)
+	}
 	// Validate that each step has a valid component
 	for index, s := range p.Steps {
 		if s.Name == "" {
@@ -70,9 +94,74 @@ func (p *Plan) validate() error {
 		if len(s.Operations) == 0 {
 			return fmt.Errorf("step %d requires a operations to run", index)
 		}
+		if s.Timeout < 0 {
+			return fmt.Errorf("step %d has a negative timeout", index)
+		}
+		if err := s.SteadyState.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
 		if s.Sample < 0.0 || s.Sample > 100.0 {
 			return fmt.Errorf("step %d has invalid sample, sample is require to be within [0.0, 100.0]", index)
 		}
+		if err := s.Settings.Group.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		if err := s.Settings.ZoneOutage.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		if err := s.Settings.Disk.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		if err := s.Settings.Backend.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		if err := s.Settings.IAM.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		if err := s.Settings.Agent.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		if err := s.Settings.Netem.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		if err := s.Settings.GKE.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		if err := s.Settings.CloudSQL.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		if err := s.Settings.Route.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		listens := make(map[string]bool, len(s.Settings.Proxy))
+		for _, p := range s.Settings.Proxy {
+			if err := p.validate(); err != nil {
+				return fmt.Errorf("step %d %v", index, err)
+			}
+			if listens[p.Listen] {
+				return fmt.Errorf("step %d has more than one proxy listening on %s", index, p.Listen)
+			}
+			listens[p.Listen] = true
+		}
+		for _, n := range s.Settings.Network {
+			if err := n.validate(); err != nil {
+				return fmt.Errorf("step %d %v", index, err)
+			}
+		}
+		if err := s.Include.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		if err := validateZones("exclude", s.Exclude.Zones); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		if err := s.Limits.validate(); err != nil {
+			return fmt.Errorf("step %d %v", index, err)
+		}
+		for _, op := range s.Operations {
+			if s.Limits.Set() && limitless[op] {
+				return fmt.Errorf("step %d has limits that the %s operation can not apply", index, op)
+			}
+		}
 		for _, project := range s.Projects {
 			found := false
 			for _, p := range p.Projects {
@@ -85,6 +174,9 @@ func (p *Plan) validate() error {
 			}
 		}
 	}
+	if _, err := p.Dependencies(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -94,15 +186,29 @@ func LoadPlan(filepath string) (*Plan, error) {
 	if err != nil {
 		return nil, err
 	}
+	return ParsePlan(buff)
+}
+
+// ParsePlan will try to load the YAML or JSON encoded buffer into a valid plan
+func ParsePlan(buff []byte) (*Plan, error) {
 	var p Plan
 	if err := yaml.Unmarshal(buff, &p); err != nil {
 		return nil, err
 	}
-	for _, step := range p.Steps {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	for i := range p.Steps {
+		step := &p.Steps[i]
 		if step.Sample == 0.0 {
 			step.Sample = 100.0
 		}
 		step.Sample = step.Sample / 100.0
+		if step.Seed == 0 && p.Seed != 0 {
+			h := fnv.New64a()
+			h.Write([]byte(step.Name))
+			step.Seed = p.Seed ^ int64(h.Sum64())
+		}
 	}
-	return &p, (&p).validate()
+	return &p, nil
 }
@@ -0,0 +1,88 @@
+package types
+
+import "testing"
+
+const seeded = `
+mode: repairable
+projects: [p]
+seed: 42
+steps:
+- name: first
+  operations: [instance]
+  projects: [p]
+- name: second
+  operations: [instance]
+  projects: [p]
+  sample: 25
+- name: pinned
+  operations: [instance]
+  projects: [p]
+  seed: 7
+`
+
+func TestParsePlanDerivesStepSeeds(t *testing.T) {
+	plan, err := ParsePlan([]byte(seeded))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	again, err := ParsePlan([]byte(seeded))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first, second := plan.Steps[0].Seed, plan.Steps[1].Seed
+	if first == 0 || first == second {
+		t.Errorf("steps seeded with %d and %d, want distinct seeds derived from the plan", first, second)
+	}
+	if again.Steps[0].Seed != first || again.Steps[1].Seed != second {
+		t.Error("the same plan seed should always derive the same step seeds")
+	}
+	if plan.Steps[2].Seed != 7 {
+		t.Errorf("step seeded with %d, want the seed it set", plan.Steps[2].Seed)
+	}
+}
+
+func TestParsePlanScalesSample(t *testing.T) {
+	plan, err := ParsePlan([]byte(seeded))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plan.Steps[0].Sample != 1 {
+		t.Errorf("unset sample is %v, want every instance sampled", plan.Steps[0].Sample)
+	}
+	if plan.Steps[1].Sample != 0.25 {
+		t.Errorf("sample is %v, want 0.25", plan.Steps[1].Sample)
+	}
+}
+
+func TestParsePlanRejectsInvalidPlans(t *testing.T) {
+	for name, plan := range map[string]string{
+		"mode":           "mode: everything\nprojects: [p]\n",
+		"name":           "mode: dryrun\nprojects: [p]\nsteps:\n- operations: [instance]\n  projects: [p]\n",
+		"project":        "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [instance]\n  projects: [q]\n",
+		"sample":         "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [instance]\n  projects: [p]\n  sample: 101\n",
+		"operation":      "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  projects: [p]\n",
+		"network range":  "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [ingress]\n  projects: [p]\n  settings:\n    network:\n    - project: p\n      sourceRanges: [10.0.0.0]\n",
+		"allow ranges":   "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [ingress]\n  projects: [p]\n  settings:\n    network:\n    - project: p\n      allow: [{protocol: tcp}]\n",
+		"deny priority":  "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [ingress]\n  projects: [p]\n  settings:\n    network:\n    - project: p\n      priority: 0\n      allow: [{ranges: [10.0.0.0/8]}]\n",
+		"next hop":       "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [route]\n  projects: [p]\n  settings:\n    route:\n      ranges: [10.0.0.0/8]\n",
+		"route range":    "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [route]\n  projects: [p]\n  settings:\n    route:\n      ranges: [10.0.0.0]\n      nextHopIp: 10.255.255.254\n",
+		"gke cluster":    "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [gke]\n  projects: [p]\n  settings:\n    gke:\n      action: drain\n",
+		"iam member":     "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [iam]\n  projects: [p]\n  settings:\n    iam:\n      revoke: [{role: roles/viewer, member: orders}]\n",
+		"agent fault":    "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [agent]\n  projects: [p]\n  settings:\n    agent:\n      faults: [{kind: memory}]\n",
+		"netem loss":     "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [netem]\n  projects: [p]\n  settings:\n    netem:\n      loss: 150\n",
+		"proxy upstream": "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [proxy]\n  projects: [p]\n  settings:\n    proxy:\n    - listen: 127.0.0.1:9000\n      latency: 1s\n",
+		"proxy listen":   "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [proxy]\n  projects: [p]\n  settings:\n    proxy:\n    - {listen: 127.0.0.1:9000, upstream: 127.0.0.1:5432}\n    - {listen: 127.0.0.1:9000, upstream: 127.0.0.1:6379}\n",
+		"maxPercent":     "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [instance]\n  projects: [p]\n  maxPercent: 150\n",
+		"maxTargets":     "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [instance]\n  projects: [p]\n  maxTargets: -1\n",
+		"label":          "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [instance]\n  projects: [p]\n  minRemainingPerLabel: {web: 1}\n",
+		"remaining":      "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [instance]\n  projects: [p]\n  minRemainingPerLabel: {app=web: 0}\n",
+		"include zone":   "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [instance]\n  projects: [p]\n  include:\n    zones: [a]\n",
+		"exclude zone":   "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [instance]\n  projects: [p]\n  exclude:\n    zones: [us-central1]\n",
+		"mig limits":     "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [instance, mig]\n  projects: [p]\n  maxTargets: 1\n",
+		"outage zone":    "mode: dryrun\nprojects: [p]\nsteps:\n- name: a\n  operations: [zone-outage]\n  projects: [p]\n  settings:\n    zoneOutage:\n      zones: [b]\n",
+	} {
+		if _, err := ParsePlan([]byte(plan)); err == nil {
+			t.Errorf("plan with an invalid %s should fail", name)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	// ProbeBefore is the phase used for probes run before a step starts
+	ProbeBefore = "before"
+	// ProbeDuring is the phase used for probes run while a step waits
+	ProbeDuring = "during"
+	// ProbeAfter is the phase used for probes run once a step has been restored
+	ProbeAfter = "after"
+)
+
+// SteadyState defines the hypothesis of what a healthy system looks like
+type SteadyState struct {
+	Interval  time.Duration `json:"interval" yaml:"interval" description:"how often the probes are run while a step waits, defaults to 30s"`
+	Tolerance int           `json:"tolerance" yaml:"tolerance" description:"the number of consecutive failures a probe can have before the step is aborted"`
+	Probes    []Probe       `json:"probes" yaml:"probes"`
+}
+
+// Probe defines a single check of the system, only one of HTTP, TCP or Command can be set
+type Probe struct {
+	Name       string        `json:"name" yaml:"name"`
+	Timeout    time.Duration `json:"timeout" yaml:"timeout" description:"how long to wait for the probe to respond, defaults to 10s"`
+	MaxLatency time.Duration `json:"maxLatency" yaml:"maxLatency" description:"the longest the probe can take before it is considered failed"`
+	HTTP       *HTTPProbe    `json:"http,omitempty" yaml:"http,omitempty"`
+	TCP        *TCPProbe     `json:"tcp,omitempty" yaml:"tcp,omitempty"`
+	Command    *CommandProbe `json:"command,omitempty" yaml:"command,omitempty"`
+}
+
+// HTTPProbe checks that an endpoint responds as expected
+type HTTPProbe struct {
+	URL     string            `json:"url" yaml:"url"`
+	Method  string            `json:"method" yaml:"method" description:"defaults to GET"`
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	Status  []int             `json:"status" yaml:"status" description:"the accepted status codes, defaults to any status below 400"`
+	Body    string            `json:"body" yaml:"body" description:"a regular expression the response body must match"`
+}
+
+// TCPProbe checks that a connection can be established
+type TCPProbe struct {
+	Address string `json:"address" yaml:"address"`
+}
+
+// CommandProbe checks that a command exits as expected
+type CommandProbe struct {
+	Path     string   `json:"path" yaml:"path"`
+	Args     []string `json:"args" yaml:"args"`
+	ExitCode int      `json:"exitCode" yaml:"exitCode"`
+	Output   string   `json:"output" yaml:"output" description:"a regular expression the combined output must match"`
+}
+
+// Merge combines the plan wide steady state with the step's, the step's settings take precedence
+func (s SteadyState) Merge(step SteadyState) SteadyState {
+	merged := SteadyState{
+		Interval:  s.Interval,
+		Tolerance: s.Tolerance,
+		Probes:    append(append([]Probe(nil), s.Probes...), step.Probes...),
+	}
+	if step.Interval > 0 {
+		merged.Interval = step.Interval
+	}
+	if step.Tolerance > 0 {
+		merged.Tolerance = step.Tolerance
+	}
+	return merged
+}
+
+func (s SteadyState) validate() error {
+	if s.Interval < 0 {
+		return fmt.Errorf("steady state has a negative interval")
+	}
+	if s.Tolerance < 0 {
+		return fmt.Errorf("steady state has a negative tolerance")
+	}
+	for index, p := range s.Probes {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("probe %d: %v", index, err)
+		}
+	}
+	return nil
+}
+
+func (p Probe) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("requires a name")
+	}
+	count := 0
+	if p.HTTP != nil {
+		count++
+		if p.HTTP.URL == "" {
+			return fmt.Errorf("%s requires a url", p.Name)
+		}
+		if _, err := regexp.Compile(p.HTTP.Body); err != nil {
+			return fmt.Errorf("%s has an invalid body expression: %v", p.Name, err)
+		}
+	}
+	if p.TCP != nil {
+		count++
+		if p.TCP.Address == "" {
+			return fmt.Errorf("%s requires an address", p.Name)
+		}
+	}
+	if p.Command != nil {
+		count++
+		if p.Command.Path == "" {
+			return fmt.Errorf("%s requires a path", p.Name)
+		}
+		if _, err := regexp.Compile(p.Command.Output); err != nil {
+			return fmt.Errorf("%s has an invalid output expression: %v", p.Name, err)
+		}
+	}
+	if count != 1 {
+		return fmt.Errorf("%s requires exactly one of http, tcp or command", p.Name)
+	}
+	return nil
+}
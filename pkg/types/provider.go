@@ -0,0 +1,112 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned by a provider when the resource does not exist
+	ErrNotFound = errors.New("resource not found")
+	// ErrConflict is returned by a provider when the resource was modified since it was read
+	ErrConflict = errors.New("resource fingerprint conflict")
+	// ErrUnfinished is returned by a provider when a change was accepted but not seen to finish, it may still be applied
+	ErrUnfinished = errors.New("operation did not finish")
+)
+
+// Provider abstracts the cloud that the minions operate against
+// so that they are not tied to a single API client.
+// Zones are expected to be the complete zone name, ie: australia-southeast1-a
+type Provider interface {
+	// ListZones returns the names of every zone available to the project
+	ListZones(ctx context.Context, project string) ([]string, error)
+	// ListRegions returns the names of every region available to the project
+	ListRegions(ctx context.Context, project string) ([]string, error)
+
+	// ListInstances returns every instance within the project's zone
+	ListInstances(ctx context.Context, project, zone string) ([]*Instance, error)
+	// GetInstance returns the current state of the instance
+	GetInstance(ctx context.Context, project, zone, name string) (*Instance, error)
+	// StopInstance will stop the instance so that it can be started again
+	StopInstance(ctx context.Context, project, zone, name string) error
+	// StartInstance will start a stopped instance
+	StartInstance(ctx context.Context, project, zone, name string) error
+	// DeleteInstance will permanently remove the instance
+	DeleteInstance(ctx context.Context, project, zone, name string) error
+	// SetInstanceLabels replaces the instance labels, the fingerprint must match the current labels
+	SetInstanceLabels(ctx context.Context, project, zone, name string, labels map[string]string, fingerprint string) error
+	// SetInstanceTags replaces the instance network tags, the fingerprint must match the current tags
+	SetInstanceTags(ctx context.Context, project, zone, name string, tags []string, fingerprint string) error
+	// SimulateMaintenanceEvent triggers a host maintenance event for the instance
+	SimulateMaintenanceEvent(ctx context.Context, project, zone, name string) error
+	// SetInstanceScheduling changes how the instance behaves during host maintenance
+	SetInstanceScheduling(ctx context.Context, project, zone, name string, scheduling Scheduling) error
+	// AttachDisk attaches the disk to the instance
+	AttachDisk(ctx context.Context, project, zone, name string, disk AttachedDisk) error
+	// DetachDisk detaches the disk attached as the device name from the instance
+	DetachDisk(ctx context.Context, project, zone, name, device string) error
+	// SnapshotDisk creates a snapshot of the disk, returning once the snapshot is ready to restore the disk from
+	SnapshotDisk(ctx context.Context, project, zone, disk, snapshot string) error
+	// DeleteDisk will permanently remove the disk
+	DeleteDisk(ctx context.Context, project, zone, disk string) error
+
+	// ListInstanceGroups returns every managed instance group within the project's zone
+	ListInstanceGroups(ctx context.Context, project, zone string) ([]*InstanceGroup, error)
+	// ListGroupInstances returns the names of the instances managed by the group
+	ListGroupInstances(ctx context.Context, project, zone, group string) ([]string, error)
+	// ResizeInstanceGroup sets the target size of the group
+	ResizeInstanceGroup(ctx context.Context, project, zone, group string, size int64) error
+	// AbandonGroupInstances removes the instances from the group without deleting them
+	AbandonGroupInstances(ctx context.Context, project, zone, group string, instances []string) error
+	// RecreateGroupInstances has the group delete and recreate the instances
+	RecreateGroupInstances(ctx context.Context, project, zone, group string, instances []string) error
+	// RestartInstanceGroup restarts every instance of the group by proactively rolling it out
+	RestartInstanceGroup(ctx context.Context, project, zone, group string) error
+	// GetGroupUpdatePolicy returns the update policy of the group exactly as the API describes it
+	GetGroupUpdatePolicy(ctx context.Context, project, zone, group string) (json.RawMessage, error)
+	// SetGroupUpdatePolicy replaces the update policy of the group with one returned by GetGroupUpdatePolicy
+	SetGroupUpdatePolicy(ctx context.Context, project, zone, group string, policy json.RawMessage) error
+
+	// InsertFirewall creates the firewall rule within the project
+	InsertFirewall(ctx context.Context, project string, rule *FirewallRule) error
+	// DeleteFirewall removes the named firewall rule from the project
+	DeleteFirewall(ctx context.Context, project, name string) error
+
+	// ListDatabases returns every Cloud SQL instance within the project
+	ListDatabases(ctx context.Context, project string) ([]*Database, error)
+	// FailoverDatabase fails the primary over to its standby, the settings version guards against concurrent changes
+	FailoverDatabase(ctx context.Context, project, name string, settingsVersion int64) error
+	// RestartDatabase restarts the database
+	RestartDatabase(ctx context.Context, project, name string) error
+	// SetDatabaseAuthorizedNetworks replaces the networks allowed to connect to the database
+	SetDatabaseAuthorizedNetworks(ctx context.Context, project, name string, networks []AuthorizedNetwork) error
+
+	// GetBackendService returns the backend service, the region is empty for global services
+	GetBackendService(ctx context.Context, project, region, name string) (*BackendService, error)
+	// UpdateBackendService replaces the backends of the service, the fingerprint guards against concurrent changes
+	UpdateBackendService(ctx context.Context, project, region, name string, backends []Backend, fingerprint string) error
+
+	// Identity returns the IAM member the provider is authenticated as, such as serviceAccount:skirmish@project.iam.gserviceaccount.com
+	Identity(ctx context.Context) (string, error)
+	// GetIamPolicy returns the IAM policy of the project
+	GetIamPolicy(ctx context.Context, project string) (*Policy, error)
+	// SetIamBindings replaces the bindings of the project's IAM policy, the etag guards against concurrent changes
+	SetIamBindings(ctx context.Context, project string, bindings []Binding, etag string) error
+	// RolePermissions returns the permissions included in the predefined or custom role
+	RolePermissions(ctx context.Context, role string) ([]string, error)
+
+	// ListNodePools returns the node pools of the GKE cluster
+	ListNodePools(ctx context.Context, project, location, cluster string) ([]*NodePool, error)
+	// ResizeNodePool sets the number of nodes within each zone of the pool
+	ResizeNodePool(ctx context.Context, project, location, cluster, pool string, size int64) error
+	// SetNodeSchedulable cordons or uncordons the kubernetes node
+	SetNodeSchedulable(ctx context.Context, project, location, cluster, node string, schedulable bool) error
+	// DrainNode evicts every pod from the kubernetes node other than those run by daemon sets
+	DrainNode(ctx context.Context, project, location, cluster, node string) error
+
+	// InsertRoute creates the route within the project
+	InsertRoute(ctx context.Context, project string, route *Route) error
+	// DeleteRoute removes the named route from the project
+	DeleteRoute(ctx context.Context, project, name string) error
+}
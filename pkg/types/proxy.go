@@ -0,0 +1,71 @@
+package types
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// ProxyUpstream applies the faults to the data sent from the client to the upstream
+	ProxyUpstream = "upstream"
+	// ProxyDownstream applies the faults to the data sent from the upstream back to the client
+	ProxyDownstream = "downstream"
+	// ProxyBoth applies the faults in both directions
+	ProxyBoth = "both"
+)
+
+// ProxyFaults describes how the proxy degrades the connections passing through it
+type ProxyFaults struct {
+	Latency    time.Duration `json:"latency,omitempty" yaml:"latency" description:"the delay added before forwarding each read"`
+	Jitter     time.Duration `json:"jitter,omitempty" yaml:"jitter" description:"the random variation added to the latency"`
+	Bandwidth  int64         `json:"bandwidth,omitempty" yaml:"bandwidth" description:"the limit in KB per second of each connection"`
+	Reset      float64       `json:"reset,omitempty" yaml:"reset" description:"the percentage [0.0,100.0] of new connections that are reset straight away"`
+	Timeout    time.Duration `json:"timeout,omitempty" yaml:"timeout" description:"stops forwarding any data and closes the connection once the duration has passed"`
+	SliceSize  int           `json:"sliceSize,omitempty" yaml:"sliceSize" description:"the size in bytes of the slices the data is split into"`
+	SliceDelay time.Duration `json:"sliceDelay,omitempty" yaml:"sliceDelay" description:"the delay between each slice"`
+	Direction  string        `json:"direction,omitempty" yaml:"direction" description:"one of upstream, downstream or both, defaults to both"`
+}
+
+// Affects reports if the faults apply to the direction
+func (f ProxyFaults) Affects(direction string) bool {
+	return f.Direction == "" || f.Direction == ProxyBoth || f.Direction == direction
+}
+
+// ProxySettings is a listen and upstream pair the proxy minion forwards with the faults applied
+type ProxySettings struct {
+	Listen      string `json:"listen" yaml:"listen" description:"the address the proxy listens on, such as 127.0.0.1:15432"`
+	Upstream    string `json:"upstream" yaml:"upstream" description:"the address the proxy forwards connections to, such as 127.0.0.1:5432"`
+	ProxyFaults `yaml:",inline"`
+}
+
+// Resource returns the identifier used when reporting on the proxy
+func (p ProxySettings) Resource() Resource {
+	return Resource{
+		Kind: "proxy",
+		Name: p.Listen + " -> " + p.Upstream,
+	}
+}
+
+func (p ProxySettings) validate() error {
+	for _, address := range []string{p.Listen, p.Upstream} {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("has invalid proxy address %q", address)
+		}
+	}
+	if p.Latency < 0 || p.Jitter < 0 || p.Timeout < 0 || p.SliceDelay < 0 {
+		return fmt.Errorf("has a negative proxy duration")
+	}
+	if p.Bandwidth < 0 || p.SliceSize < 0 {
+		return fmt.Errorf("has a negative proxy bandwidth or slice size")
+	}
+	if p.Reset < 0 || p.Reset > 100 {
+		return fmt.Errorf("has proxy reset %v outside of [0, 100]", p.Reset)
+	}
+	switch p.Direction {
+	case "", ProxyUpstream, ProxyDownstream, ProxyBoth:
+	default:
+		return fmt.Errorf("has unknown proxy direction %s", p.Direction)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package types
+
+import "time"
+
+// Resource identifies a single cloud resource that a minion has operated on
+type Resource struct {
+	Kind    string `json:"kind" yaml:"kind"`
+	Project string `json:"project" yaml:"project"`
+	Zone    string `json:"zone,omitempty" yaml:"zone,omitempty"`
+	Name    string `json:"name" yaml:"name"`
+}
+
+// Outcome records what happened to a resource and why
+type Outcome struct {
+	Resource `yaml:",inline"`
+	Action   string    `json:"action,omitempty" yaml:"action,omitempty"`
+	Reason   string    `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Error    string    `json:"error,omitempty" yaml:"error,omitempty"`
+	Time     time.Time `json:"time" yaml:"time"`
+}
+
+// MinionResult is the structured account of everything a minion did during a step
+type MinionResult struct {
+	Minion   string    `json:"minion" yaml:"minion"`
+	Affected []Outcome `json:"affected,omitempty" yaml:"affected,omitempty"`
+	Skipped  []Outcome `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+	Failed   []Outcome `json:"failed,omitempty" yaml:"failed,omitempty"`
+	Restored []Outcome `json:"restored,omitempty" yaml:"restored,omitempty"`
+	Error    string    `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// StepResult aggregates the results of all the minions run as part of the step
+type StepResult struct {
+	Name        string         `json:"name" yaml:"name"`
+	Description string         `json:"description" yaml:"description"`
+	Start       time.Time      `json:"start" yaml:"start"`
+	End         time.Time      `json:"end" yaml:"end"`
+	Seed        int64          `json:"seed" yaml:"seed"`
+	Minions     []MinionResult `json:"minions" yaml:"minions"`
+	Probes      []ProbeResult  `json:"probes,omitempty" yaml:"probes,omitempty"`
+	Aborted     bool           `json:"aborted,omitempty" yaml:"aborted,omitempty"`
+	Error       string         `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ProbeResult is the outcome of checking a steady state probe once
+type ProbeResult struct {
+	Probe   string        `json:"probe" yaml:"probe"`
+	Phase   string        `json:"phase" yaml:"phase"`
+	Time    time.Time     `json:"time" yaml:"time"`
+	Latency time.Duration `json:"latency" yaml:"latency"`
+	Ok      bool          `json:"ok" yaml:"ok"`
+	Error   string        `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// PlanResult is the account of an entire game day
+type PlanResult struct {
+	Mode  string       `json:"mode" yaml:"mode"`
+	Start time.Time    `json:"start" yaml:"start"`
+	End   time.Time    `json:"end" yaml:"end"`
+	Steps []StepResult `json:"steps" yaml:"steps"`
+}
+
+// Affect records that action was successfully applied to the resource
+func (r *MinionResult) Affect(res Resource, action string) {
+	r.Affected = append(r.Affected, Outcome{Resource: res, Action: action, Time: time.Now()})
+}
+
+// Skip records that the resource was left alone and the reason why
+func (r *MinionResult) Skip(res Resource, reason string) {
+	r.Skipped = append(r.Skipped, Outcome{Resource: res, Reason: reason, Time: time.Now()})
+}
+
+// Fail records that action could not be applied to the resource
+func (r *MinionResult) Fail(res Resource, action string, err error) {
+	r.Failed = append(r.Failed, Outcome{Resource: res, Action: action, Error: errString(err), Time: time.Now()})
+}
+
+// Restore returns the outcome of putting the resource back,
+// a nil err implies that the resource was successfully restored.
+func Restore(res Resource, action string, err error) Outcome {
+	return Outcome{Resource: res, Action: action, Error: errString(err), Time: time.Now()}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
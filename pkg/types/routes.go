@@ -0,0 +1,56 @@
+package types
+
+import (
+	"fmt"
+	"net"
+)
+
+// Route is the provider independent definition of a route to create
+type Route struct {
+	Name            string
+	Network         string
+	DestRange       string
+	Priority        int64
+	NextHopIp       string
+	NextHopInstance string
+}
+
+// Resource returns the identifier used when reporting on the route
+func (r *Route) Resource(project string) Resource {
+	return Resource{
+		Kind:    "route",
+		Project: project,
+		Name:    r.Name,
+	}
+}
+
+// RouteSettings configures the routes the route minion inserts to blackhole traffic
+type RouteSettings struct {
+	Network         string   `json:"network,omitempty" yaml:"network" description:"the network the routes are created in, defaults to the default network"`
+	Ranges          []string `json:"ranges" yaml:"ranges" description:"the CIDR ranges to blackhole"`
+	Priority        int64    `json:"priority,omitempty" yaml:"priority" description:"the priority of the routes, defaults to 0 which is the highest"`
+	NextHopIp       string   `json:"nextHopIp,omitempty" yaml:"nextHopIp" description:"an internal address that isn't assigned to anything so the traffic is dropped"`
+	NextHopInstance string   `json:"nextHopInstance,omitempty" yaml:"nextHopInstance" description:"an instance that doesn't forward traffic so the traffic is dropped"`
+}
+
+func (r RouteSettings) validate() error {
+	if r.Priority < 0 || r.Priority > 65535 {
+		return fmt.Errorf("has route priority %d outside of [0, 65535]", r.Priority)
+	}
+	// Routes always require a next hop, one that can't deliver the traffic is what blackholes it
+	if len(r.Ranges) > 0 && r.NextHopIp == "" && r.NextHopInstance == "" {
+		return fmt.Errorf("has route ranges without a nextHopIp or nextHopInstance to blackhole them")
+	}
+	if r.NextHopIp != "" && r.NextHopInstance != "" {
+		return fmt.Errorf("has both route nextHopIp and nextHopInstance, only one can be set")
+	}
+	if r.NextHopIp != "" && net.ParseIP(r.NextHopIp) == nil {
+		return fmt.Errorf("has invalid route nextHopIp %s", r.NextHopIp)
+	}
+	for _, cidr := range r.Ranges {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("has invalid route range %s", cidr)
+		}
+	}
+	return nil
+}
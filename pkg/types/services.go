@@ -1,7 +1,19 @@
 package types
 
-import "google.golang.org/api/compute/v1"
+import (
+	"github.com/MovieStoreGuy/skirmish/pkg/journal"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/sqladmin/v1beta4"
+)
 
 type Services struct {
-	Compute *compute.Service
+	Compute   *compute.Service
+	SQLAdmin  *sqladmin.Service
+	Container *container.Service
+	Resources *cloudresourcemanager.Service
+	Provider  Provider
+	Journal   *journal.Journal
 }
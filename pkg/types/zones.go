@@ -0,0 +1,43 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// fullZone matches a complete zone name such as australia-southeast1-a
+var fullZone = regexp.MustCompile(`^[a-z]+(-[a-z]+)*[0-9]+-[a-z]$`)
+
+// validateZones ensures every zone is a complete zone name since zones are never matched by a prefix,
+// a short name such as "a" would otherwise silently match nothing.
+func validateZones(field string, zones []string) error {
+	for _, zone := range zones {
+		if !fullZone.MatchString(zone) {
+			return fmt.Errorf("has %s zone %q that isn't a full zone name such as australia-southeast1-a", field, zone)
+		}
+	}
+	return nil
+}
+
+// ZoneOutageSettings configures which zones the zone-outage minion takes down
+type ZoneOutageSettings struct {
+	Zones   []string      `json:"zones,omitempty" yaml:"zones" description:"the complete zone names to take down, chosen at random when unset"`
+	Count   int           `json:"count,omitempty" yaml:"count" description:"how many zones to choose at random, defaults to 1"`
+	Deny    bool          `json:"deny,omitempty" yaml:"deny" description:"deny all traffic to and from the instances within the zones"`
+	Network string        `json:"network,omitempty" yaml:"network" description:"the network the deny rules are created in, defaults to the default network"`
+	Stagger time.Duration `json:"stagger,omitempty" yaml:"stagger" description:"how long to wait between restoring each zone"`
+}
+
+func (z ZoneOutageSettings) validate() error {
+	if z.Count < 0 {
+		return fmt.Errorf("has a negative zone outage count")
+	}
+	if z.Count > 0 && len(z.Zones) > 0 {
+		return fmt.Errorf("has both zone outage zones and count, only one can be set")
+	}
+	if z.Stagger < 0 {
+		return fmt.Errorf("has a negative zone outage stagger")
+	}
+	return validateZones("zone outage", z.Zones)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/orchestra"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// plan prints the instances each step of the plan would select without making any changes,
+// steps without a seed select differently every run which is called out in the output.
+func plan(log *zap.Logger, args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	fs.StringVar(&planPath, "plan-path", planPath, "the path to the plan to preview")
+	fs.StringVar(&providerName, "provider", providerName, "the cloud to operate against, either gce or fake for an in memory demo")
+	fs.Parse(args)
+
+	p, err := types.LoadPlan(planPath)
+	if err != nil {
+		log.Error("Invalid plan path defined", zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Nothing is changed by a preview so there is nothing worth journaling
+	services, _, err := newServices(ctx, providerName, os.DevNull)
+	if err != nil {
+		log.Panic("Failed to configure services", zap.Error(err))
+	}
+	defer services.Journal.Close()
+	orc, err := orchestra.NewRunner(ctx, cancel, log, services)
+	if err != nil {
+		log.Panic("Failed to create new orchestra runner", zap.Error(err))
+	}
+	result, err := orc.Preview(p)
+	if err != nil {
+		log.Error("Issue previewing plan", zap.Error(err))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	for i, step := range result.Steps {
+		seeded := "seeded"
+		if p.Steps[i].Seed == 0 {
+			seeded = "unseeded, selection changes every run"
+		}
+		fmt.Fprintf(w, "STEP %s\tseed %d (%s)\n", step.Name, step.Seed, seeded)
+		for _, selection := range step.Minions {
+			if selection.Error != "" {
+				fmt.Fprintf(w, "  error\t%s\n", selection.Error)
+			}
+			fmt.Fprintln(w, "  PROJECT\tZONE\tINSTANCE\tOUTCOME")
+			for _, o := range selection.Affected {
+				fmt.Fprintf(w, "  %s\t%s\t%s\tselected\n", o.Project, o.Zone, o.Name)
+			}
+			for _, o := range selection.Skipped {
+				fmt.Fprintf(w, "  %s\t%s\t%s\tskipped (%s)\n", o.Project, o.Zone, o.Name, o.Reason)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
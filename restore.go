@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/journal"
+	"github.com/MovieStoreGuy/skirmish/pkg/minions"
+	"github.com/MovieStoreGuy/skirmish/pkg/provider"
+	"github.com/MovieStoreGuy/skirmish/pkg/types"
+
+	"go.uber.org/zap"
+)
+
+// restore will read back the journal and undo every change
+// that was not restored by the skirmish that made it.
+func restore(log *zap.Logger, args []string) {
+	var path string
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.StringVar(&path, "journal", "skirmish.journal", "the path of the journal to restore from")
+	fs.Parse(args)
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Error("Unable to open journal", zap.Error(err), zap.String("journal", path))
+		return
+	}
+	entries, err := journal.Read(f)
+	f.Close()
+	if err != nil {
+		log.Error("Unable to read journal", zap.Error(err), zap.String("journal", path))
+		return
+	}
+	outstanding := journal.Outstanding(entries)
+	if len(outstanding) == 0 {
+		log.Info("Nothing to restore", zap.String("journal", path))
+		return
+	}
+
+	ctx := context.Background()
+	svc := &types.Services{}
+	for _, e := range outstanding {
+		if minions.Offline(e.Kind) {
+			continue
+		}
+		if err := provider.Connect(ctx, svc); err != nil {
+			log.Error("Unable to create google services", zap.Error(err))
+			return
+		}
+		svc.Provider = provider.NewGCE(svc.Compute, svc.SQLAdmin, svc.Container, svc.Resources)
+		break
+	}
+	if svc.Journal, err = journal.Open(path); err != nil {
+		log.Error("Unable to open journal", zap.Error(err), zap.String("journal", path))
+		return
+	}
+	defer svc.Journal.Close()
+	for _, e := range outstanding {
+		if err := minions.Revert(ctx, svc, e); err != nil {
+			log.Error("Failed to restore change", zap.Error(err), zap.String("kind", e.Kind), zap.String("project", e.Project), zap.String("name", e.Name))
+			continue
+		}
+		log.Info("Restored change", zap.String("kind", e.Kind), zap.String("project", e.Project), zap.String("name", e.Name))
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"syscall"
+
+	"github.com/MovieStoreGuy/skirmish/pkg/server"
+	"github.com/MovieStoreGuy/skirmish/pkg/signal"
+
+	"go.uber.org/zap"
+)
+
+// serve will run the control API until the process is signaled to stop,
+// at which point every running execution is aborted and restored.
+func serve(log *zap.Logger, args []string) {
+	var listen string
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&listen, "listen", "127.0.0.1:8080", "the address to serve the control API on")
+	fs.StringVar(&journalPath, "journal", journalPath, "the path to record every change made so it can be restored")
+	fs.StringVar(&providerName, "provider", providerName, "the cloud to operate against, either gce or fake for an in memory demo")
+	fs.Parse(args)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go signal.GlobalHandler().Await(ctx, cancel, syscall.SIGABRT, syscall.SIGTERM, syscall.SIGINT)
+
+	services, _, err := newServices(ctx, providerName, journalPath)
+	if err != nil {
+		log.Panic("Failed to configure services", zap.Error(err))
+	}
+	defer services.Journal.Close()
+	defer signal.GlobalHandler().Finalise()
+	defer cancel()
+
+	srv, err := server.New(ctx, log, os.Getenv(server.TokenEnv), services)
+	if err != nil {
+		log.Error("Unable to start control API", zap.Error(err))
+		return
+	}
+	signal.GlobalHandler().Register(srv.Shutdown)
+
+	httpServer := &http.Server{
+		Addr:    listen,
+		Handler: srv.Handler(),
+	}
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+	log.Info("Serving control API", zap.String("listen", listen))
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Error("Issue serving control API", zap.Error(err))
+	}
+}